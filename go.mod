@@ -6,6 +6,7 @@ require (
 	github.com/Knetic/govaluate v3.0.0+incompatible
 	github.com/dop251/goja v0.0.0-20220927172339-ea66e911853d
 	github.com/dop251/goja_nodejs v0.0.0-20220905124449-678b33ca5009
+	github.com/go-logr/logr v1.2.3
 	github.com/golangci/golangci-lint v1.51.2
 	github.com/google/go-cmp v0.5.9
 	github.com/onsi/ginkgo v1.16.5
@@ -94,7 +95,6 @@ require (
 	github.com/fzipp/gocyclo v0.6.0 // indirect
 	github.com/go-critic/go-critic v0.6.7 // indirect
 	github.com/go-errors/errors v1.0.1 // indirect
-	github.com/go-logr/logr v1.2.3 // indirect
 	github.com/go-logr/zapr v1.2.0 // indirect
 	github.com/go-openapi/jsonpointer v0.19.5 // indirect
 	github.com/go-openapi/jsonreference v0.19.6 // indirect
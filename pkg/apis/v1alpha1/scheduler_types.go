@@ -57,8 +57,13 @@ type Score struct {
 
 // ScoreSpec ...
 type ScoreSpec struct {
-	// Weight of the Score
+	// Weight of the Score, a negative weight makes the Score a penalty subtracted from the weighted score.
+	// Score with zero weight is ignored.
 	Weight int64 `json:"weight,omitempty"`
+	// ProfileWeights overrides Weight for the pods of a profile keyed by profile, e.g. batch or latency-sensitive,
+	// the profile of a pod is its arbiter.k8s.com.cn/profile label or annotation.
+	// +optional
+	ProfileWeights map[string]int64 `json:"profileWeights,omitempty"`
 	// Logic is the Javascript code
 	Logic string `json:"logic"`
 }
@@ -629,7 +629,7 @@ func (in *Score) DeepCopyInto(out *Score) {
 	*out = *in
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
-	out.Spec = in.Spec
+	in.Spec.DeepCopyInto(&out.Spec)
 	in.Status.DeepCopyInto(&out.Status)
 	return
 }
@@ -688,6 +688,13 @@ func (in *ScoreList) DeepCopyObject() runtime.Object {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *ScoreSpec) DeepCopyInto(out *ScoreSpec) {
 	*out = *in
+	if in.ProfileWeights != nil {
+		in, out := &in.ProfileWeights, &out.ProfileWeights
+		*out = make(map[string]int64, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
 	return
 }
 
@@ -21,6 +21,7 @@ import (
 	"context"
 	"fmt"
 	"sort"
+	"time"
 
 	corev1 "k8s.io/api/core/v1"
 	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -158,6 +159,11 @@ func (c *controller) addMetric(metricName string, data *v1alpha1.ObservabilityIn
 			metrics[metricName][0].Records = append(metrics[metricName][0].Records, data.Records...)
 			metrics[metricName][0].StartTime = data.StartTime
 			metrics[metricName][0].EndTime = data.EndTime
+			// the time range covers the retained history, not only the last fetch window, otherwise the
+			// consumers drop all records out of it.
+			if oldest := metrics[metricName][0].Records[0].Timestamp; !data.StartTime.IsZero() && oldest < data.StartTime.UnixMilli() {
+				metrics[metricName][0].StartTime = meta.NewTime(time.UnixMilli(oldest))
+			}
 		}
 
 		instance.Status.Metrics = metrics
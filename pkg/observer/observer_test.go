@@ -17,15 +17,21 @@ limitations under the License.
 package observer
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"reflect"
 	"testing"
 	"time"
 
+	corev1 "k8s.io/api/core/v1"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	kubefake "k8s.io/client-go/kubernetes/fake"
 
 	"github.com/kube-arbiter/arbiter/pkg/apis/v1alpha1"
+	"github.com/kube-arbiter/arbiter/pkg/generated/clientset/versioned/fake"
+	"github.com/kube-arbiter/arbiter/pkg/scheduler/manager"
 )
 
 type KeyFunc func(string, *v1alpha1.ObservabilityIndicant) error
@@ -67,6 +73,7 @@ func TestControllerKeyFunc(t *testing.T) {
 		"testAddMetric":  testAddMetric,
 		"testLoopUpdate": testLoopUpdate,
 		"testOneRecord":  testOneRecord,
+		"testHistory":    testHistory,
 	}
 	for funcName, fn := range testKeyFuncs {
 		if err := fn(funcName, baseCr.DeepCopy()); err != nil {
@@ -368,3 +375,47 @@ func testOneRecord(name string, instance *v1alpha1.ObservabilityIndicant) error
 
 	return nil
 }
+
+func testHistory(name string, instance *v1alpha1.ObservabilityIndicant) error {
+	log.Printf("%s start to test...\n", name)
+	now := time.Now().Truncate(time.Second)
+	// each fetch covers the last MetricIntervalSeconds only.
+	for i := 0; i < 3; i++ {
+		end := now.Add(time.Duration(3*i) * time.Second)
+		new(controller).addMetric("cpu", &v1alpha1.ObservabilityIndicantStatusMetricInfo{
+			Unit:       "m",
+			TargetItem: "pod1",
+			StartTime:  v1.NewTime(end.Add(-3 * time.Second)),
+			EndTime:    v1.NewTime(end),
+			Records:    []v1alpha1.Record{{Timestamp: end.UnixMilli(), Value: fmt.Sprint(i)}},
+		})(instance)
+	}
+	m := instance.Status.Metrics["cpu"][0]
+	if len(m.Records) != 3 {
+		return fmt.Errorf("expect 3 records get %v", m.Records)
+	}
+	// the time range covers the history kept in records.
+	if !m.StartTime.Time.Equal(now) || !m.EndTime.Time.Equal(now.Add(6*time.Second)) {
+		return fmt.Errorf("expect time range [%v, %v] get [%v, %v]", now, now.Add(6*time.Second), m.StartTime, m.EndTime)
+	}
+
+	// the scheduler aggregates the whole history, not only the last fetch.
+	factory := informers.NewSharedInformerFactory(kubefake.NewSimpleClientset(), 0)
+	mgr := manager.NewManager(fake.NewSimpleClientset(), nil, factory.Core().V1().Pods(), factory.Core().V1().Nodes())
+	defer mgr.Close()
+	mgr.ObservabilityIndicantAdd(instance)
+	pod := &corev1.Pod{ObjectMeta: v1.ObjectMeta{Namespace: "default", Name: "pod1"}}
+	obi, err := mgr.GetPodOBI(context.Background(), pod)
+	if err != nil {
+		return err
+	}
+	if len(obi) != 1 {
+		return fmt.Errorf("expect the obi of pod1 get %v", obi)
+	}
+	for _, o := range obi {
+		if cpu := o.Metric["cpu"]; cpu.Count != 3 || cpu.Avg != 1 {
+			return fmt.Errorf("expect avg 1 of 3 records get %+v", cpu)
+		}
+	}
+	return nil
+}
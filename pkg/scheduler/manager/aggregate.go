@@ -0,0 +1,405 @@
+/*
+Copyright 2022 The Arbiter Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manager
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+
+	schedv1alpha1 "github.com/kube-arbiter/arbiter/pkg/apis/v1alpha1"
+)
+
+// sample is one parsed value of a record, Timestamp is the unix milliseconds of the record.
+// Weight is how much it contributes to FullMetrics.WeightedAvg, see WithWeightLabels.
+type sample struct {
+	Timestamp int64
+	Value     float64
+	Weight    float64
+}
+
+// parseSamples parses records by parse to samples ordered by timestamp, unparseable records are skipped
+// with a log to logger. parse returns the values of a record along with their weights.
+// Non-finite values, e.g. "+Inf" or "NaN" of a prometheus ratio with a zero denominator, are skipped too,
+// nonFinite is the number of them.
+func parseSamples(logger klog.Logger, records []schedv1alpha1.Record, parse func(value string) (values, weights []float64, err error)) (samples []sample, nonFinite int) {
+	samples = make([]sample, 0, len(records))
+	for _, r := range records {
+		values, weights, err := parse(r.Value)
+		if err != nil {
+			logger.V(5).Info(ManagerLogPrefix+"Failed to parse float", "Value", r.Value, "err", err)
+			continue
+		}
+		for i, val := range values {
+			if math.IsInf(val, 0) || math.IsNaN(val) {
+				nonFinite++
+				continue
+			}
+			samples = append(samples, sample{Timestamp: r.Timestamp, Value: val, Weight: weights[i]})
+		}
+	}
+	if nonFinite != 0 {
+		logger.V(5).Info(ManagerLogPrefix+"skip non-finite values", "count", nonFinite)
+	}
+	// OBI status order is not guaranteed, stable sort keeps the record order for equal timestamps.
+	sort.SliceStable(samples, func(i, j int) bool {
+		return samples[i].Timestamp < samples[j].Timestamp
+	})
+	return samples, nonFinite
+}
+
+// mergeMetricInfo merges all entries of metricType into one, e.g. one OBI reports the metric of several target items.
+// Records of each entry out of its own time range are dropped, see windowRecords, e.g. late-arriving samples
+// appended by a controller, the rest are deduplicated by timestamp, see dedupRecords, then concatenated and sorted by timestamp,
+// see sortRecords. Entries of different target items may share timestamps, they are not deduplicated with each other,
+// and the time-ordered aggregations of the merged records are combined from each target item instead, see
+// combineTargetItems.
+// The time range covers all merged entries. TargetItem is the one of the first entry.
+// Entries in different units, e.g. "C" and "m", are converted to the canonical unit of the first entry in a known
+// unit, see normalizeUnit and convertRecords, which is then the Unit of the merged entry; entries in an unknown
+// unit or one which can not be converted to it are skipped with a log. Otherwise Unit is the one of the entries.
+func mergeMetricInfo(logger klog.Logger, metricType string, infos []schedv1alpha1.ObservabilityIndicantStatusMetricInfo) schedv1alpha1.ObservabilityIndicantStatusMetricInfo {
+	merged := *infos[0].DeepCopy()
+	merged.Records = nil
+	merged.StartTime, merged.EndTime = metav1.Time{}, metav1.Time{}
+	canonical, convert := mergedUnit(infos)
+	if convert {
+		merged.Unit = canonical
+	}
+	included := 0
+	for _, info := range infos {
+		records := dedupRecords(windowRecords(info))
+		if convert {
+			c, factor, ok := normalizeUnit(info.Unit)
+			if !ok || c != canonical {
+				logger.V(2).Info(ManagerLogPrefix+"skip metric entry in a unit which can not be converted", "metricType", metricType, "unit", info.Unit, "expectUnit", canonical, "targetItem", info.TargetItem)
+				continue
+			}
+			records = convertRecords(records, factor)
+		} else if info.Unit != merged.Unit {
+			logger.V(2).Info(ManagerLogPrefix+"skip metric entry in a different unit", "metricType", metricType, "unit", info.Unit, "expectUnit", merged.Unit, "targetItem", info.TargetItem)
+			continue
+		}
+		merged.Records = append(merged.Records, records...)
+		if included == 0 {
+			merged.StartTime, merged.EndTime = info.StartTime, info.EndTime
+		} else {
+			if !info.StartTime.IsZero() && (merged.StartTime.IsZero() || info.StartTime.Before(&merged.StartTime)) {
+				merged.StartTime = info.StartTime
+			}
+			if merged.EndTime.Before(&info.EndTime) {
+				merged.EndTime = info.EndTime
+			}
+		}
+		included++
+	}
+	sortRecords(merged.Records)
+	return merged
+}
+
+// mergedUnit returns the canonical unit of the first of infos in a known unit, and whether the records of infos
+// are converted to it, that is unless all of infos are in the same unit or none of them is in a known unit.
+func mergedUnit(infos []schedv1alpha1.ObservabilityIndicantStatusMetricInfo) (canonical string, convert bool) {
+	same, known := true, false
+	for _, info := range infos {
+		same = same && info.Unit == infos[0].Unit
+		if c, _, ok := normalizeUnit(info.Unit); ok && !known {
+			canonical, known = c, true
+		}
+	}
+	return canonical, known && !same
+}
+
+// windowRecords returns a copy of the records of info within [StartTime, EndTime], a zero StartTime or EndTime
+// leaves that side unbounded. Record timestamps are unix milliseconds.
+func windowRecords(info schedv1alpha1.ObservabilityIndicantStatusMetricInfo) []schedv1alpha1.Record {
+	res := make([]schedv1alpha1.Record, 0, len(info.Records))
+	for _, r := range info.Records {
+		if !info.StartTime.IsZero() && r.Timestamp < info.StartTime.UnixMilli() {
+			continue
+		}
+		if !info.EndTime.IsZero() && r.Timestamp > info.EndTime.UnixMilli() {
+			continue
+		}
+		res = append(res, r)
+	}
+	return res
+}
+
+// dedupRecords keeps one record for each timestamp in place, the last seen one wins, e.g. a source reporting
+// twice corrects itself. Otherwise duplicates skew Count, Rate and EWMA, and make Latest ambiguous.
+// The value is not checked, so an unparseable last record still replaces a parseable earlier one.
+func dedupRecords(records []schedv1alpha1.Record) []schedv1alpha1.Record {
+	index := make(map[int64]int, len(records))
+	res := records[:0]
+	for _, r := range records {
+		if i, ok := index[r.Timestamp]; ok {
+			res[i] = r
+			continue
+		}
+		index[r.Timestamp] = len(res)
+		res = append(res, r)
+	}
+	return res
+}
+
+// sortRecords sorts records ascending by timestamp, so the cached records are in chronological order.
+// OBI status order is not guaranteed, records with equal timestamps are ordered by value to be deterministic.
+func sortRecords(records []schedv1alpha1.Record) {
+	sort.SliceStable(records, func(i, j int) bool {
+		if records[i].Timestamp != records[j].Timestamp {
+			return records[i].Timestamp < records[j].Timestamp
+		}
+		return records[i].Value < records[j].Value
+	})
+}
+
+// aggregate parses the records of m and computes all aggregations of metricType over the parsed values,
+// values are converted to the canonical unit of m.Unit first.
+// The Buckets of m count as their Count values for Count, Sum, Avg, Max and Min, and as Count times their mean
+// for WeightedAvg and the percentiles, the time-ordered aggregations, e.g. EWMA and Slope, take each one as
+// a single value of its mean at its timestamp.
+// Records which can not be parsed are logged to logger.
+// It returns false if the unit is unknown or none of the records can be parsed, m should not be used in that case.
+func (mgr *manager) aggregate(logger klog.Logger, metricType string, m *FullMetrics) bool {
+	canonical, _, ok := normalizeUnit(m.Unit)
+	if !ok {
+		logger.V(2).Info(ManagerLogPrefix+"unknown metric unit, skip records", "metricType", metricType, "unit", m.Unit)
+		return false
+	}
+	samples, nonFinite := parseSamples(logger, m.Records, mgr.valueParser(metricType, m.Unit))
+	m.NonFinite = nonFinite
+	if len(samples) == 0 {
+		return false
+	}
+	m.CanonicalUnit = canonical
+	// seed Max and Min with the first parsed value, so neither is stuck at 0 whatever the sign of the values is.
+	m.Max, m.Min, m.Avg = samples[0].Value, samples[0].Value, 0
+	var sum float64
+	count := len(samples)
+	values := make([]float64, 0, len(samples))
+	for _, s := range samples {
+		val := s.Value
+		if val > m.Max {
+			m.Max = val
+		}
+		if val < m.Min {
+			m.Min = val
+		}
+		sum += val
+		values = append(values, val)
+	}
+	m.MaxGap = maxGap(samples)
+	m.HasGap = mgr.gapThreshold > 0 && m.MaxGap > mgr.gapThreshold
+	if len(m.Buckets) != 0 {
+		bucketSamples := make([]sample, 0, len(m.Buckets)+len(samples))
+		for _, b := range m.Buckets {
+			if b.Max > m.Max {
+				m.Max = b.Max
+			}
+			if b.Min < m.Min {
+				m.Min = b.Min
+			}
+			sum += b.Sum
+			count += b.Count
+			mean := b.mean()
+			for i := 0; i < b.Count; i++ {
+				values = append(values, mean)
+			}
+			bucketSamples = append(bucketSamples, sample{Timestamp: b.Timestamp, Value: mean, Weight: float64(b.Count)})
+		}
+		// buckets are older than any record.
+		samples = append(bucketSamples, samples...)
+	}
+	m.Count, m.Sum = count, sum
+	m.Avg = sum / float64(count)
+	m.WeightedAvg = weightedAvg(samples, m.Avg)
+	setPercentiles(m, values)
+	m.EWMA = ewma(samples, mgr.ewmaHalfLife)
+	m.Flaps, m.Frozen = 0, false
+	if policy, ok := mgr.flapPolicies[metricType]; ok {
+		m.Flaps = countFlaps(samples, policy)
+	}
+	m.Latest = samples[len(samples)-1].Value
+	m.Rate = 0
+	if _, ok := mgr.counterMetrics[metricType]; ok {
+		m.Rate = rate(samples)
+	}
+	m.Slope = slope(samples)
+	m.Primary = mgr.primaryOf(logger, metricType, *m)
+	return true
+}
+
+// primaryOf returns the aggregation of m set for metricType by WithPrimaryAggregations, Avg if it is not set
+// or unknown.
+func (mgr *manager) primaryOf(logger klog.Logger, metricType string, m FullMetrics) float64 {
+	name, ok := mgr.primaryAggregations[metricType]
+	if !ok {
+		return m.Avg
+	}
+	value, ok := m.Aggregation(name)
+	if !ok {
+		logger.V(2).Info(ManagerLogPrefix+"unknown primary aggregation, use avg instead", "metricType", metricType, "aggregation", name)
+		return m.Avg
+	}
+	return value
+}
+
+// weightedAvg returns the average of samples weighted by their Weight, avg if all weights are zero.
+func weightedAvg(samples []sample, avg float64) float64 {
+	var sum, total float64
+	for _, s := range samples {
+		sum += s.Value * s.Weight
+		total += s.Weight
+	}
+	if total == 0 {
+		return avg
+	}
+	return sum / total
+}
+
+// valueParser returns the parser of the record values of metricType in unit, see parseMetricValue.
+// Values are parsed by the suffixes set by WithValueSuffixes, the enum values set by WithEnumValues and the
+// weight label set by WithWeightLabels of metricType.
+func (mgr *manager) valueParser(metricType, unit string) func(value string) (values, weights []float64, err error) {
+	format := valueFormat{
+		suffixes:    mgr.valueSuffixes[metricType],
+		enums:       mgr.enumValues[metricType],
+		weightLabel: mgr.weightLabels[metricType],
+	}
+	return func(value string) ([]float64, []float64, error) {
+		return parseMetricValue(value, unit, format)
+	}
+}
+
+// rate returns the per-second increase of a counter over samples ordered by timestamp.
+// A decreasing value is treated as a counter reset, the counter is considered to restart from 0.
+func rate(samples []sample) float64 {
+	if len(samples) < 2 {
+		return 0
+	}
+	span := float64(samples[len(samples)-1].Timestamp-samples[0].Timestamp) / 1000
+	if span <= 0 {
+		return 0
+	}
+	var increase float64
+	for i := 1; i < len(samples); i++ {
+		delta := samples[i].Value - samples[i-1].Value
+		if delta < 0 {
+			delta = samples[i].Value
+		}
+		increase += delta
+	}
+	return increase / span
+}
+
+// maxGap returns the longest interval between the timestamps of consecutive samples ordered by timestamp.
+func maxGap(samples []sample) time.Duration {
+	var gap int64
+	for i := 1; i < len(samples); i++ {
+		if d := samples[i].Timestamp - samples[i-1].Timestamp; d > gap {
+			gap = d
+		}
+	}
+	return time.Duration(gap) * time.Millisecond
+}
+
+// slope returns the per-second slope of the least squares line of samples over their timestamps,
+// 0 if samples do not have two distinct timestamps.
+func slope(samples []sample) float64 {
+	if len(samples) < 2 {
+		return 0
+	}
+	// seconds since the first sample, keeps the sums small for unix millisecond timestamps.
+	origin := samples[0].Timestamp
+	var meanX, meanY float64
+	for _, s := range samples {
+		meanX += float64(s.Timestamp-origin) / 1000
+		meanY += s.Value
+	}
+	n := float64(len(samples))
+	meanX, meanY = meanX/n, meanY/n
+	var cov, variance float64
+	for _, s := range samples {
+		dx := float64(s.Timestamp-origin)/1000 - meanX
+		cov += dx * (s.Value - meanY)
+		variance += dx * dx
+	}
+	if variance == 0 {
+		return 0
+	}
+	return cov / variance
+}
+
+// ewma returns the exponentially time-weighted moving average of samples ordered by timestamp.
+// The weight of a sample halves every halfLife before the newest sample.
+func ewma(samples []sample, halfLife time.Duration) float64 {
+	if len(samples) == 0 {
+		return 0
+	}
+	if halfLife <= 0 {
+		return samples[len(samples)-1].Value
+	}
+	newest := samples[len(samples)-1].Timestamp
+	var sum, weights float64
+	for _, s := range samples {
+		age := time.Duration(newest-s.Timestamp) * time.Millisecond
+		w := math.Exp2(-float64(age) / float64(halfLife))
+		sum += w * s.Value
+		weights += w
+	}
+	return sum / weights
+}
+
+// setPercentiles computes Median and P50/P90/P95/P99 of values into m.
+func setPercentiles(m *FullMetrics, values []float64) {
+	sorted := make([]float64, len(values))
+	copy(sorted, values)
+	sort.Float64s(sorted)
+	m.Median = median(sorted)
+	m.P50 = percentile(sorted, 50)
+	m.P90 = percentile(sorted, 90)
+	m.P95 = percentile(sorted, 95)
+	m.P99 = percentile(sorted, 99)
+}
+
+// median returns the median of the ascending sorted values.
+func median(sorted []float64) float64 {
+	n := len(sorted)
+	if n == 0 {
+		return 0
+	}
+	if n%2 == 1 {
+		return sorted[n/2]
+	}
+	return (sorted[n/2-1] + sorted[n/2]) / 2
+}
+
+// percentile returns the p-th (0 <= p <= 100) percentile of the ascending sorted values.
+// It uses linear interpolation between the two closest ranks, the same as the default method of numpy.
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := p / 100 * float64(len(sorted)-1)
+	lower := int(math.Floor(rank))
+	upper := int(math.Ceil(rank))
+	return sorted[lower] + (sorted[upper]-sorted[lower])*(rank-float64(lower))
+}
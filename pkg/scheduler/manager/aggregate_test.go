@@ -0,0 +1,486 @@
+/*
+Copyright 2022 The Arbiter Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manager
+
+import (
+	"math"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	schedv1alpha1 "github.com/kube-arbiter/arbiter/pkg/apis/v1alpha1"
+)
+
+func floatEqual(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func TestPercentile(t *testing.T) {
+	// 1..100 shuffled, the percentile of linear interpolation is 1+0.99*p.
+	values := make([]string, 0, 100)
+	for i := 0; i < 100; i++ {
+		values = append(values, strconv.Itoa((i*37)%100+1))
+	}
+	mgr := newTestManager(t)
+	obi := newNodeOBI("obi", "node1", map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo{
+		"cpu": {{Records: newRecords(values...)}},
+	})
+	mgr.ObservabilityIndicantAdd(obi)
+	m := getNodeMetric(t, mgr, obi, "node1", "cpu")
+	for name, tc := range map[string]struct{ get, exp float64 }{
+		"p50": {m.P50, 50.5},
+		"p90": {m.P90, 90.1},
+		"p95": {m.P95, 95.05},
+		"p99": {m.P99, 99.01},
+	} {
+		if !floatEqual(tc.get, tc.exp) {
+			t.Fatalf("%s expect %v get %v", name, tc.exp, tc.get)
+		}
+	}
+
+	for _, tc := range []struct {
+		sorted []float64
+		p      float64
+		exp    float64
+	}{
+		{sorted: nil, p: 50, exp: 0},
+		{sorted: []float64{7}, p: 95, exp: 7},
+		{sorted: []float64{1, 2, 3, 4}, p: 50, exp: 2.5},
+		{sorted: []float64{1, 2, 3, 4}, p: 100, exp: 4},
+		{sorted: []float64{1, 2, 3, 4}, p: 0, exp: 1},
+	} {
+		if r := percentile(tc.sorted, tc.p); !floatEqual(r, tc.exp) {
+			t.Fatalf("percentile(%v, %v) expect %v get %v", tc.sorted, tc.p, tc.exp, r)
+		}
+	}
+}
+
+func TestEWMA(t *testing.T) {
+	mgr := newTestManager(t, WithEWMAHalfLife(time.Minute))
+	// ramp up from 1 to 10, one record every minute, records are shuffled.
+	records := make([]schedv1alpha1.Record, 0, 10)
+	for _, i := range []int{3, 1, 10, 7, 2, 9, 5, 4, 8, 6} {
+		records = append(records, schedv1alpha1.Record{Timestamp: int64(i) * 60000, Value: strconv.Itoa(i)})
+	}
+	obi := newNodeOBI("obi", "node1", map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo{
+		"cpu": {{Records: records}},
+	})
+	mgr.ObservabilityIndicantAdd(obi)
+	m := getNodeMetric(t, mgr, obi, "node1", "cpu")
+	if m.Avg != 5.5 {
+		t.Fatalf("expect avg 5.5 get %v", m.Avg)
+	}
+	if m.EWMA <= m.Avg || m.EWMA >= 10 {
+		t.Fatalf("expect ewma between avg and newest value, get %v", m.EWMA)
+	}
+	// weights are 2^-(10-i), sum(i*w)/sum(w)
+	var sum, weights float64
+	for i := 1; i <= 10; i++ {
+		w := math.Exp2(float64(i - 10))
+		sum += w * float64(i)
+		weights += w
+	}
+	if !floatEqual(m.EWMA, sum/weights) {
+		t.Fatalf("expect ewma %v get %v", sum/weights, m.EWMA)
+	}
+
+	for _, tc := range []struct {
+		samples  []sample
+		halfLife time.Duration
+		exp      float64
+	}{
+		{samples: nil, halfLife: time.Minute, exp: 0},
+		{samples: []sample{{Timestamp: 0, Value: 1}, {Timestamp: 60000, Value: 3}}, halfLife: 0, exp: 3},
+		{samples: []sample{{Timestamp: 0, Value: 1}, {Timestamp: 60000, Value: 4}}, halfLife: time.Minute, exp: 3},
+	} {
+		if r := ewma(tc.samples, tc.halfLife); !floatEqual(r, tc.exp) {
+			t.Fatalf("ewma(%v, %v) expect %v get %v", tc.samples, tc.halfLife, tc.exp, r)
+		}
+	}
+}
+
+func TestLatest(t *testing.T) {
+	mgr := newTestManager(t)
+	obi := newNodeOBI("obi", "node1", map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo{
+		"cpu": {{Records: []schedv1alpha1.Record{
+			{Timestamp: 3000, Value: "3"},
+			{Timestamp: 5000, Value: "bad"},
+			{Timestamp: 1000, Value: "1"},
+			{Timestamp: 4000, Value: "4"},
+			{Timestamp: 2000, Value: "2"},
+		}}},
+	})
+	mgr.ObservabilityIndicantAdd(obi)
+	if m := getNodeMetric(t, mgr, obi, "node1", "cpu"); m.Latest != 4 {
+		t.Fatalf("expect latest 4 get %v", m.Latest)
+	}
+}
+
+func TestCountAndSum(t *testing.T) {
+	mgr := newTestManager(t)
+	obi := newNodeOBI("obi", "node1", map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo{
+		"cpu": {{Records: newRecords("1.5", "bad", "2.5", "", "6")}},
+	})
+	mgr.ObservabilityIndicantAdd(obi)
+	m := getNodeMetric(t, mgr, obi, "node1", "cpu")
+	if m.Count != 3 {
+		t.Fatalf("expect count 3 without unparseable records get %d", m.Count)
+	}
+	if !floatEqual(m.Sum, 10) {
+		t.Fatalf("expect sum 10 get %v", m.Sum)
+	}
+}
+
+func TestMedian(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		values []string
+		exp    float64
+	}{
+		{name: "single", values: []string{"7"}, exp: 7},
+		{name: "odd", values: []string{"9", "1", "bad", "5"}, exp: 5},
+		{name: "even", values: []string{"8", "2", "100", "4", "bad"}, exp: 6},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			mgr := newTestManager(t)
+			obi := newNodeOBI("obi", "node1", map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo{
+				"cpu": {{Records: newRecords(tc.values...)}},
+			})
+			mgr.ObservabilityIndicantAdd(obi)
+			if m := getNodeMetric(t, mgr, obi, "node1", "cpu"); !floatEqual(m.Median, tc.exp) {
+				t.Fatalf("expect median %v get %v", tc.exp, m.Median)
+			}
+		})
+	}
+}
+
+func TestRate(t *testing.T) {
+	mgr := newTestManager(t, WithCounterMetrics("network"))
+	// one record every minute.
+	ramp := newRecords("0", "600", "1200", "1800")
+	obi := newNodeOBI("obi", "node1", map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo{
+		"network": {{Records: ramp}},
+		"cpu":     {{Records: ramp}},
+		// reset after 1200: increase is 600 + 600 + 300 + 600.
+		"reset": {{Records: newRecords("0", "600", "1200", "300", "900")}},
+	})
+	mgr.ObservabilityIndicantAdd(obi)
+	if m := getNodeMetric(t, mgr, obi, "node1", "network"); !floatEqual(m.Rate, 10) {
+		t.Fatalf("expect network rate 10 get %v", m.Rate)
+	}
+	if m := getNodeMetric(t, mgr, obi, "node1", "cpu"); m.Rate != 0 {
+		t.Fatalf("gauge should not have rate, get %v", m.Rate)
+	}
+
+	mgr = newTestManager(t, WithCounterMetrics("reset"))
+	mgr.ObservabilityIndicantAdd(obi)
+	if m := getNodeMetric(t, mgr, obi, "node1", "reset"); !floatEqual(m.Rate, 2100.0/240) {
+		t.Fatalf("expect reset rate %v get %v", 2100.0/240, m.Rate)
+	}
+	if r := rate([]sample{{Timestamp: 1000, Value: 1}}); r != 0 {
+		t.Fatalf("expect single sample rate 0 get %v", r)
+	}
+}
+
+func TestSlope(t *testing.T) {
+	mgr := newTestManager(t)
+	// one record every minute.
+	obi := newNodeOBI("obi", "node1", map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo{
+		"rising":  {{Records: newRecords("10", "16", "22", "28")}},
+		"falling": {{Records: newRecords("90", "60", "30", "0")}},
+		"flat":    {{Records: newRecords("5", "5", "5")}},
+		// least squares line of 7 per minute.
+		"noisy": {{Records: newRecords("10", "25", "20", "35")}},
+	})
+	mgr.ObservabilityIndicantAdd(obi)
+	for metricType, expect := range map[string]float64{"rising": 0.1, "falling": -0.5, "flat": 0, "noisy": 7.0 / 60} {
+		if m := getNodeMetric(t, mgr, obi, "node1", metricType); !floatEqual(m.Slope, expect) {
+			t.Fatalf("expect %s slope %v get %v", metricType, expect, m.Slope)
+		}
+	}
+
+	if s := slope([]sample{{Timestamp: 1000, Value: 1}}); s != 0 {
+		t.Fatalf("expect single sample slope 0 get %v", s)
+	}
+	if s := slope([]sample{{Timestamp: 1000, Value: 1}, {Timestamp: 1000, Value: 9}}); s != 0 {
+		t.Fatalf("expect slope 0 without distinct timestamps get %v", s)
+	}
+}
+
+func TestMaxGap(t *testing.T) {
+	gappy := newRecords("10", "12", "11")
+	// the source stops reporting for 10 minutes.
+	gappy = append(gappy, schedv1alpha1.Record{Timestamp: 13 * 60000, Value: "30"})
+	obi := newNodeOBI("obi", "node1", map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo{
+		"contiguous": {{Records: newRecords("10", "12", "11", "13")}},
+		"gappy":      {{Records: gappy}},
+		"single":     {{Records: newRecords("10")}},
+	})
+	for _, tc := range []struct {
+		name      string
+		threshold time.Duration
+		expGaps   map[string]bool
+	}{
+		{name: "threshold", threshold: 3 * time.Minute, expGaps: map[string]bool{"gappy": true}},
+		{name: "no threshold", expGaps: map[string]bool{}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			mgr := newTestManager(t, WithGapThreshold(tc.threshold))
+			mgr.ObservabilityIndicantAdd(obi)
+			for metricType, expGap := range map[string]time.Duration{"contiguous": time.Minute, "gappy": 10 * time.Minute, "single": 0} {
+				m := getNodeMetric(t, mgr, obi, "node1", metricType)
+				if m.MaxGap != expGap || m.HasGap != tc.expGaps[metricType] {
+					t.Fatalf("expect %s max gap %v has gap %v get %v %v", metricType, expGap, tc.expGaps[metricType], m.MaxGap, m.HasGap)
+				}
+			}
+		})
+	}
+}
+
+func TestObservabilityIndicantAddMultipleEntries(t *testing.T) {
+	mgr := newTestManager(t)
+	obi := newNodeOBI("obi", "node1", map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo{
+		"cpu": {
+			{TargetItem: "item1", Records: newRecords("1", "3")},
+			{TargetItem: "item2", Records: newRecords("5", "7")},
+			{TargetItem: "item3", Unit: "C", Records: newRecords("100")},
+		},
+	})
+	mgr.ObservabilityIndicantAdd(obi)
+	m := getNodeMetric(t, mgr, obi, "node1", "cpu")
+	if len(m.Records) != 4 {
+		t.Fatalf("expect records of item1 and item2, get %v", m.Records)
+	}
+	if m.Avg != 4 || m.Max != 7 || m.Min != 1 {
+		t.Fatalf("expect avg 4 max 7 min 1 get %+v", m)
+	}
+	if len(obi.Status.Metrics["cpu"][0].Records) != 2 {
+		t.Fatalf("expect obi in informer cache not modified")
+	}
+}
+
+func TestObservabilityIndicantAddConvertibleUnits(t *testing.T) {
+	mgr := newTestManager(t)
+	obi := newNodeOBI("obi", "node1", map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo{
+		"cpu": {
+			{TargetItem: "item1", Unit: "C", Records: newRecords("0.5", "1.5")},
+			{TargetItem: "item2", Unit: "m", Records: newRecords("250", `[{"metric":{},"value":[180,"750"]}]`)},
+			// neither can be converted to millicores.
+			{TargetItem: "item3", Unit: "byte", Records: newRecords("100")},
+			{TargetItem: "item4", Unit: "furlong", Records: newRecords("100")},
+		},
+	})
+	mgr.ObservabilityIndicantAdd(obi)
+	m := getNodeMetric(t, mgr, obi, "node1", "cpu")
+	if m.Unit != MilliCPUUnit || len(m.Records) != 4 {
+		t.Fatalf("expect records of item1 and item2 in %s get %s %v", MilliCPUUnit, m.Unit, m.Records)
+	}
+	if m.Count != 4 || m.Avg != 750 || m.Max != 1500 || m.Min != 250 {
+		t.Fatalf("expect avg 750 max 1500 min 250 get %+v", m)
+	}
+	if records := obi.Status.Metrics["cpu"][0].Records; records[0].Value != "0.5" {
+		t.Fatalf("expect obi in informer cache not modified get %v", records)
+	}
+}
+
+func TestObservabilityIndicantAddWeighted(t *testing.T) {
+	// 10 is aggregated from 3 underlying samples and 50 from 1, 90 has no weight and weighs 1.
+	records := []schedv1alpha1.Record{
+		{Timestamp: 60000, Value: `[{"metric":{"samples":"3"},"value":[60,"10"]}]`},
+		{Timestamp: 120000, Value: `[{"metric":{"samples":"1"},"value":[120,"50"]}]`},
+		{Timestamp: 180000, Value: "90"},
+	}
+	obi := newNodeOBI("obi", "node1", map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo{
+		"cpu": {{Records: records}},
+	})
+
+	mgr := newTestManager(t, WithWeightLabels(map[string]string{"cpu": "samples"}))
+	mgr.ObservabilityIndicantAdd(obi)
+	m := getNodeMetric(t, mgr, obi, "node1", "cpu")
+	if m.Avg != 50 {
+		t.Fatalf("expect unweighted avg 50 get %v", m.Avg)
+	}
+	// (3*10 + 1*50 + 1*90) / 5
+	if m.WeightedAvg != 34 {
+		t.Fatalf("expect weighted avg 34 get %v", m.WeightedAvg)
+	}
+
+	// values weigh equally by default.
+	mgr = newTestManager(t)
+	mgr.ObservabilityIndicantAdd(obi)
+	if m := getNodeMetric(t, mgr, obi, "node1", "cpu"); m.WeightedAvg != m.Avg {
+		t.Fatalf("expect weighted avg the same as avg %v get %v", m.Avg, m.WeightedAvg)
+	}
+}
+
+func TestPrimaryAggregation(t *testing.T) {
+	metrics := map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo{
+		"cpu":      {{Records: newRecords("10", "20", "30", "40")}},
+		"latency":  {{Records: newRecords("1", "2", "3", "4", "5", "6", "7", "8", "9", "100")}},
+		"capacity": {{Records: newRecords("8", "16")}},
+		"disk":     {{Records: newRecords("1", "3")}},
+	}
+	obi := newNodeOBI("obi", "node1", metrics)
+	mgr := newTestManager(t, WithPrimaryAggregations(map[string]string{"cpu": "avg", "latency": "p95", "capacity": "latest", "disk": "unknown"}))
+	mgr.ObservabilityIndicantAdd(obi)
+	for metricType, exp := range map[string]float64{"cpu": 25, "capacity": 16, "disk": 2} {
+		if m := getNodeMetric(t, mgr, obi, "node1", metricType); m.Primary != exp {
+			t.Fatalf("expect primary of %s %v get %+v", metricType, exp, m)
+		}
+	}
+	if m := getNodeMetric(t, mgr, obi, "node1", "latency"); m.Primary != m.P95 || m.Primary == m.Avg {
+		t.Fatalf("expect primary of latency the p95 %v get %v", m.P95, m.Primary)
+	}
+
+	// avg by default.
+	mgr = newTestManager(t)
+	mgr.ObservabilityIndicantAdd(obi)
+	if m := getNodeMetric(t, mgr, obi, "node1", "latency"); m.Primary != m.Avg {
+		t.Fatalf("expect primary of latency the avg %v get %v", m.Avg, m.Primary)
+	}
+	if _, ok := (FullMetrics{}).Aggregation("unknown"); ok {
+		t.Fatalf("expect no aggregation named unknown")
+	}
+}
+
+func TestObservabilityIndicantAddSortRecords(t *testing.T) {
+	mgr := newTestManager(t)
+	obi := newNodeOBI("obi", "node1", map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo{
+		"cpu": {{Records: []schedv1alpha1.Record{
+			{Timestamp: 3000, Value: "3"},
+			{Timestamp: 1000, Value: "1"},
+			{Timestamp: 4000, Value: "4"},
+			{Timestamp: 2000, Value: "2"},
+		}}},
+	})
+	mgr.ObservabilityIndicantAdd(obi)
+	exp := []schedv1alpha1.Record{
+		{Timestamp: 1000, Value: "1"},
+		{Timestamp: 2000, Value: "2"},
+		{Timestamp: 3000, Value: "3"},
+		{Timestamp: 4000, Value: "4"},
+	}
+	if m := getNodeMetric(t, mgr, obi, "node1", "cpu"); !reflect.DeepEqual(exp, m.Records) {
+		t.Fatalf("expect records %v get %v", exp, m.Records)
+	}
+	if obi.Status.Metrics["cpu"][0].Records[0].Timestamp != 3000 {
+		t.Fatalf("expect obi in informer cache not modified")
+	}
+}
+
+func TestObservabilityIndicantAddDuplicateTimestamps(t *testing.T) {
+	mgr := newTestManager(t)
+	obi := newNodeOBI("obi", "node1", map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo{
+		"cpu": {
+			{TargetItem: "item1", Records: []schedv1alpha1.Record{
+				{Timestamp: 1000, Value: "1"},
+				{Timestamp: 2000, Value: "2"},
+				{Timestamp: 1000, Value: "10"},
+				{Timestamp: 3000, Value: "3"},
+				{Timestamp: 3000, Value: "30"},
+			}},
+			// another target item at the same timestamp is not a duplicate.
+			{TargetItem: "item2", Records: []schedv1alpha1.Record{{Timestamp: 1000, Value: "5"}}},
+		},
+	})
+	mgr.ObservabilityIndicantAdd(obi)
+	m := getNodeMetric(t, mgr, obi, "node1", "cpu")
+	exp := []schedv1alpha1.Record{
+		{Timestamp: 1000, Value: "10"},
+		{Timestamp: 1000, Value: "5"},
+		{Timestamp: 2000, Value: "2"},
+		{Timestamp: 3000, Value: "30"},
+	}
+	if !reflect.DeepEqual(exp, m.Records) {
+		t.Fatalf("expect records %v get %v", exp, m.Records)
+	}
+	if m.Count != 4 || !floatEqual(m.Sum, 47) || m.Latest != 30 {
+		t.Fatalf("expect count 4 sum 47 latest 30 get %+v", m)
+	}
+	if records := obi.Status.Metrics["cpu"][0].Records; len(records) != 5 || records[2].Value != "10" {
+		t.Fatalf("expect obi in informer cache not modified get %v", records)
+	}
+}
+
+func TestObservabilityIndicantAddTimeWindow(t *testing.T) {
+	start, end := metav1.NewTime(time.UnixMilli(60000)), metav1.NewTime(time.UnixMilli(180000))
+	for _, tc := range []struct {
+		name       string
+		start, end metav1.Time
+		expCount   int
+		expMax     float64
+		expMin     float64
+		expAvg     float64
+	}{
+		{name: "window", start: start, end: end, expCount: 3, expMax: 3, expMin: 1, expAvg: 2},
+		{name: "no end", start: start, expCount: 4, expMax: 90, expMin: 1, expAvg: 24},
+		{name: "no start", end: end, expCount: 4, expMax: 3, expMin: -50, expAvg: -11},
+		{name: "no window", expCount: 5, expMax: 90, expMin: -50, expAvg: 9.2},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			mgr := newTestManager(t)
+			obi := newNodeOBI("obi", "node1", map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo{
+				"cpu": {{StartTime: tc.start, EndTime: tc.end, Records: []schedv1alpha1.Record{
+					// late-arriving samples out of the window.
+					{Timestamp: 0, Value: "-50"},
+					{Timestamp: 60000, Value: "1"},
+					{Timestamp: 120000, Value: "2"},
+					{Timestamp: 180000, Value: "3"},
+					{Timestamp: 240000, Value: "90"},
+				}}},
+			})
+			mgr.ObservabilityIndicantAdd(obi)
+			m := getNodeMetric(t, mgr, obi, "node1", "cpu")
+			if m.Count != tc.expCount || m.Max != tc.expMax || m.Min != tc.expMin || !floatEqual(m.Avg, tc.expAvg) {
+				t.Fatalf("expect count %d max %v min %v avg %v get %+v", tc.expCount, tc.expMax, tc.expMin, tc.expAvg, m)
+			}
+		})
+	}
+}
+
+func TestMaxRecordsPerMetric(t *testing.T) {
+	mgr := newTestManager(t, WithMaxRecordsPerMetric(3))
+	values := make([]string, 0, 10)
+	for i := 1; i <= 10; i++ {
+		values = append(values, strconv.Itoa(i))
+	}
+	records := newRecords(values...)
+	// the newest records are kept by timestamp, not by the order in OBI status.
+	records[0], records[9] = records[9], records[0]
+	obi := newNodeOBI("obi", "node1", map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo{
+		"cpu": {{Records: records}},
+	})
+	mgr.ObservabilityIndicantAdd(obi)
+	m := getNodeMetric(t, mgr, obi, "node1", "cpu")
+	exp := []schedv1alpha1.Record{
+		{Timestamp: 480000, Value: "8"},
+		{Timestamp: 540000, Value: "9"},
+		{Timestamp: 600000, Value: "10"},
+	}
+	if !reflect.DeepEqual(exp, m.Records) {
+		t.Fatalf("expect the 3 newest records %v get %v", exp, m.Records)
+	}
+	if m.Count != 3 || m.Avg != 9 || m.Min != 8 || m.Max != 10 {
+		t.Fatalf("expect aggregations over the kept records get %+v", m)
+	}
+	if len(obi.Status.Metrics["cpu"][0].Records) != 10 {
+		t.Fatalf("expect obi in informer cache not modified")
+	}
+}
@@ -0,0 +1,111 @@
+/*
+Copyright 2022 The Arbiter Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manager
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Aggregates is the summary of a FullMetrics without its records, see GetNodeAggregates.
+type Aggregates struct {
+	CanonicalUnit string
+	Primary       float64
+	Avg           float64
+	Max           float64
+	Min           float64
+	Count         int
+	Sum           float64
+	WeightedAvg   float64
+	Median        float64
+	P50           float64
+	P90           float64
+	P95           float64
+	P99           float64
+	EWMA          float64
+	Latest        float64
+	Rate          float64
+	Slope         float64
+}
+
+// AggregatesOf returns the summary of m.
+func AggregatesOf(m FullMetrics) Aggregates {
+	return Aggregates{
+		CanonicalUnit: m.CanonicalUnit,
+		Primary:       m.Primary,
+		Avg:           m.Avg,
+		Max:           m.Max,
+		Min:           m.Min,
+		Count:         m.Count,
+		Sum:           m.Sum,
+		WeightedAvg:   m.WeightedAvg,
+		Median:        m.Median,
+		P50:           m.P50,
+		P90:           m.P90,
+		P95:           m.P95,
+		P99:           m.P99,
+		EWMA:          m.EWMA,
+		Latest:        m.Latest,
+		Rate:          m.Rate,
+		Slope:         m.Slope,
+	}
+}
+
+// GetNodeAggregates returns the summary of all metrics of the node keyed by metric type, the same metrics
+// as GetNodeMetrics, but neither the OBI nor the records are copied, see GetNodeOBI for the raw data.
+func (mgr *manager) GetNodeAggregates(ctx context.Context, nodeName string) (map[string]Aggregates, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("node %s: %w", nodeName, err)
+	}
+	mgr.RLock()
+	defer mgr.RUnlock()
+	nodeCache, ok := mgr.nodeMetric[nodeName]
+	if !ok {
+		err := fmt.Errorf("node %s: %w", nodeName, ErrNotFoundInCache)
+		mgr.contextLogger(ctx).V(4).Info("Failed to get node aggregates", "node", nodeName, "err", err)
+		return nil, err
+	}
+	type chosen struct {
+		key     string
+		endTime metav1.Time
+	}
+	aggregates := make(map[string]Aggregates)
+	chosenOf := make(map[string]chosen)
+	now := time.Now().UnixNano()
+	for k, v := range nodeCache.Items() {
+		data, ok := v.Object.(cachedOBI)
+		if !ok {
+			continue
+		}
+		for metricType, m := range data.metric {
+			if data.expired(metricType, now) {
+				continue
+			}
+			if cur, ok := chosenOf[metricType]; ok && !preferEndTime(m.EndTime, k, cur.endTime, cur.key) {
+				continue
+			}
+			aggregates[metricType], chosenOf[metricType] = AggregatesOf(m), chosen{key: k, endTime: m.EndTime}
+		}
+	}
+	if len(aggregates) == 0 {
+		return nil, fmt.Errorf("node %s: %w", nodeName, ErrNotFoundInCache)
+	}
+	return aggregates, nil
+}
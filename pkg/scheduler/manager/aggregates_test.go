@@ -0,0 +1,99 @@
+/*
+Copyright 2022 The Arbiter Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	schedv1alpha1 "github.com/kube-arbiter/arbiter/pkg/apis/v1alpha1"
+)
+
+func TestGetNodeAggregates(t *testing.T) {
+	mgr := newTestManager(t)
+	end := metav1.NewTime(time.Unix(1000, 0))
+	mgr.ObservabilityIndicantAdd(newNodeOBI("old", "node1", map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo{
+		"cpu":    {{Records: newRecords("100", "200"), EndTime: end}},
+		"memory": {{Records: newRecords("1", "3")}},
+	}))
+	mgr.ObservabilityIndicantAdd(newNodeOBI("new", "node1", map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo{
+		"cpu": {{Records: newRecords("1", "2", "3"), EndTime: metav1.NewTime(end.Add(time.Minute))}},
+	}))
+
+	aggregates, err := mgr.GetNodeAggregates(context.Background(), "node1")
+	if err != nil {
+		t.Fatalf("GetNodeAggregates get err: %v", err)
+	}
+	metrics, err := mgr.GetNodeMetrics(context.Background(), "node1")
+	if err != nil {
+		t.Fatalf("GetNodeMetrics get err: %v", err)
+	}
+	exp := make(map[string]Aggregates, len(metrics))
+	for metricType, m := range metrics {
+		exp[metricType] = AggregatesOf(m)
+	}
+	if !reflect.DeepEqual(exp, aggregates) {
+		t.Fatalf("expect the same as GetNodeMetrics %+v get %+v", exp, aggregates)
+	}
+	if cpu := aggregates["cpu"]; cpu.Avg != 2 || cpu.Max != 3 || cpu.Count != 3 {
+		t.Fatalf("expect cpu of the obi with the latest end time get %+v", cpu)
+	}
+
+	if _, err := mgr.GetNodeAggregates(context.Background(), "node2"); !errors.Is(err, ErrNotFoundInCache) {
+		t.Fatalf("expect ErrNotFoundInCache get %v", err)
+	}
+}
+
+// BenchmarkGetNodeAggregates compares GetNodeAggregates with GetNodeMetrics of a node with a few OBIs
+// of many records.
+func BenchmarkGetNodeAggregates(b *testing.B) {
+	mgr := newTestManager(b)
+	values := make([]string, 500)
+	for i := range values {
+		values[i] = strconv.Itoa(i)
+	}
+	for i := 0; i < 5; i++ {
+		mgr.ObservabilityIndicantAdd(newNodeOBI(fmt.Sprintf("obi%d", i), "node1", map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo{
+			fmt.Sprintf("cpu%d", i):    {{Records: newRecords(values...)}},
+			fmt.Sprintf("memory%d", i): {{Records: newRecords(values...)}},
+		}))
+	}
+	ctx := context.Background()
+	b.Run("GetNodeAggregates", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := mgr.GetNodeAggregates(ctx, "node1"); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("GetNodeMetrics", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := mgr.GetNodeMetrics(ctx, "node1"); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,95 @@
+/*
+Copyright 2022 The Arbiter Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manager
+
+import (
+	"sort"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+
+	schedv1alpha1 "github.com/kube-arbiter/arbiter/pkg/apis/v1alpha1"
+)
+
+const (
+	// DefaultUnresolvedBackoff is the first backoff of an OBI whose target can't be resolved, see WithUnresolvedBackoff.
+	DefaultUnresolvedBackoff = time.Second
+	// DefaultMaxUnresolvedBackoff bounds the doubling backoff of an OBI whose target can't be resolved.
+	DefaultMaxUnresolvedBackoff = 5 * time.Minute
+)
+
+// unresolvedOBI is the backoff state of an OBI whose target can't be resolved, the updates of the same spec
+// and target items are skipped until retryAt.
+type unresolvedOBI struct {
+	spec        schedv1alpha1.ObservabilityIndicantSpec
+	targetItems []string
+	backoff     time.Duration
+	retryAt     time.Time
+}
+
+// backingOff returns true if obi of cacheKey can't be resolved before and should not be processed again now,
+// a changed spec or changed target items in the status are always processed, as a node obi without the node
+// name is resolved by its target items, see getTargetName. mgr.Lock must be held.
+func (mgr *manager) backingOff(cacheKey string, obi *schedv1alpha1.ObservabilityIndicant, now time.Time) bool {
+	state, ok := mgr.unresolved[cacheKey]
+	if !ok {
+		return false
+	}
+	if !equality.Semantic.DeepEqual(state.spec, obi.Spec) || !equality.Semantic.DeepEqual(state.targetItems, statusTargetItems(obi)) {
+		delete(mgr.unresolved, cacheKey)
+		return false
+	}
+	return now.Before(state.retryAt)
+}
+
+// backOffUnresolved records obi of cacheKey can't be resolved at now, the backoff doubles on every failed retry
+// of the same spec and target items up to mgr.maxUnresolvedBackoff. Nothing is recorded if backoff is disabled. mgr.Lock must be held.
+func (mgr *manager) backOffUnresolved(cacheKey string, obi *schedv1alpha1.ObservabilityIndicant, now time.Time) {
+	if mgr.unresolvedBackoff <= 0 {
+		return
+	}
+	backoff := mgr.unresolvedBackoff
+	if state, ok := mgr.unresolved[cacheKey]; ok {
+		backoff = state.backoff * 2
+	}
+	if backoff > mgr.maxUnresolvedBackoff {
+		backoff = mgr.maxUnresolvedBackoff
+	}
+	mgr.unresolved[cacheKey] = unresolvedOBI{
+		spec:        *obi.Spec.DeepCopy(),
+		targetItems: statusTargetItems(obi),
+		backoff:     backoff,
+		retryAt:     now.Add(backoff),
+	}
+}
+
+// statusTargetItems returns the sorted distinct non-empty TargetItems of the status metrics of obi.
+func statusTargetItems(obi *schedv1alpha1.ObservabilityIndicant) []string {
+	seen := make(map[string]struct{})
+	var items []string
+	for _, infos := range obi.Status.Metrics {
+		for _, info := range infos {
+			if _, ok := seen[info.TargetItem]; ok || info.TargetItem == "" {
+				continue
+			}
+			seen[info.TargetItem] = struct{}{}
+			items = append(items, info.TargetItem)
+		}
+	}
+	sort.Strings(items)
+	return items
+}
@@ -0,0 +1,99 @@
+/*
+Copyright 2022 The Arbiter Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manager
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	schedv1alpha1 "github.com/kube-arbiter/arbiter/pkg/apis/v1alpha1"
+)
+
+func TestUnresolvedBackoff(t *testing.T) {
+	kind := TargetKind{Group: "apps", Version: "v1", Kind: "Deployment"}
+	resolves := 0
+	mgr := newTestManager(t, WithUnresolvedBackoff(50*time.Millisecond, time.Hour), WithTargetKind(kind, func(obi *schedv1alpha1.ObservabilityIndicant) string {
+		resolves++
+		return obi.Spec.TargetRef.Name
+	}))
+	obi := newNodeOBI("obi", "", map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo{
+		"cpu": {{Records: newRecords("1")}},
+	})
+	obi.Spec.TargetRef.Group, obi.Spec.TargetRef.Kind = kind.Group, kind.Kind
+
+	for i := 0; i < 3; i++ {
+		mgr.ObservabilityIndicantAdd(obi)
+	}
+	if resolves != 1 {
+		t.Fatalf("expect identical updates throttled, resolved %d times", resolves)
+	}
+	backoff := mgr.unresolved[getMetricCacheKey(obi)].backoff
+
+	time.Sleep(backoff)
+	mgr.ObservabilityIndicantAdd(obi)
+	if resolves != 2 {
+		t.Fatalf("expect retry once backoff elapsed, resolved %d times", resolves)
+	}
+	if next := mgr.unresolved[getMetricCacheKey(obi)].backoff; next != 2*backoff {
+		t.Fatalf("expect backoff doubled to %v get %v", 2*backoff, next)
+	}
+
+	// a changed spec is retried at once, and resolving clears the backoff.
+	obi = obi.DeepCopy()
+	obi.Spec.TargetRef.Name = "deploy1"
+	mgr.ObservabilityIndicantAdd(obi)
+	if resolves != 3 {
+		t.Fatalf("expect changed spec retried, resolved %d times", resolves)
+	}
+	if _, ok := mgr.unresolved[getMetricCacheKey(obi)]; ok {
+		t.Fatalf("expect backoff cleared once resolved")
+	}
+	if _, err := mgr.GetTargetOBI(context.Background(), kind, "deploy1"); err != nil {
+		t.Fatalf("expect obi cached get %v", err)
+	}
+
+	mgr = newTestManager(t, WithUnresolvedBackoff(0, 0))
+	mgr.ObservabilityIndicantAdd(newNodeOBI("obi", "", map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo{
+		"cpu": {{Records: newRecords("1")}},
+	}))
+	if len(mgr.unresolved) != 0 {
+		t.Fatalf("expect no backoff state when disabled get %v", mgr.unresolved)
+	}
+}
+
+func TestUnresolvedBackoffStatusUpdate(t *testing.T) {
+	mgr := newTestManager(t, WithUnresolvedBackoff(time.Hour, time.Hour))
+	obi := newNodeOBI("obi", "", map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo{
+		"cpu": {{Records: newRecords("1")}},
+	})
+	mgr.ObservabilityIndicantAdd(obi)
+	if _, ok := mgr.unresolved[getMetricCacheKey(obi)]; !ok {
+		t.Fatalf("expect backoff of obi without target")
+	}
+
+	// only the status changes, its target item resolves the node while the backoff is still active.
+	obi = obi.DeepCopy()
+	obi.Status.Metrics["cpu"][0].TargetItem = "node1"
+	mgr.ObservabilityIndicantAdd(obi)
+	if _, ok := mgr.unresolved[getMetricCacheKey(obi)]; ok {
+		t.Fatalf("expect backoff cleared once resolved")
+	}
+	if m := getNodeMetric(t, mgr, obi, "node1", "cpu"); m.Avg != 1 {
+		t.Fatalf("expect metric of node1 cached get %+v", m)
+	}
+}
@@ -0,0 +1,81 @@
+/*
+Copyright 2022 The Arbiter Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manager
+
+import (
+	"context"
+	"sort"
+)
+
+// ClusterMetric is the aggregation of one metric type over the nodes, the value of a node is the Avg of
+// its metric, see MergeOBIMetrics.
+type ClusterMetric struct {
+	Mean float64 `json:"mean"`
+	Max  float64 `json:"max"`
+	Min  float64 `json:"min"`
+	// Count is the number of nodes which have the metric type.
+	Count int `json:"count"`
+}
+
+// ClusterMetrics is the cluster-wide view of the node metrics exposed to score logic as cluster,
+// e.g. cluster.metric.cpu.mean, so that a node can be scored relative to the others.
+type ClusterMetrics struct {
+	// Metric is keyed by metric type.
+	Metric map[string]ClusterMetric `json:"metric"`
+}
+
+// ClusterMetrics aggregates the metrics of all cached nodes, it is O(nodes), so it is meant to be computed
+// once for a scheduling cycle rather than for each node. Nothing is aggregated once ctx is done.
+func (mgr *manager) ClusterMetrics(ctx context.Context) ClusterMetrics {
+	mgr.RLock()
+	nodeNames := make([]string, 0, len(mgr.nodeMetric))
+	for nodeName := range mgr.nodeMetric {
+		nodeNames = append(nodeNames, nodeName)
+	}
+	mgr.RUnlock()
+	// the same order every time, so the floating point sums are deterministic.
+	sort.Strings(nodeNames)
+
+	res := ClusterMetrics{Metric: make(map[string]ClusterMetric)}
+	sums := make(map[string]float64)
+	for _, nodeName := range nodeNames {
+		if ctx.Err() != nil {
+			return ClusterMetrics{Metric: map[string]ClusterMetric{}}
+		}
+		obi, err := mgr.GetNodeOBI(ctx, nodeName)
+		if err != nil {
+			continue
+		}
+		for metricType, m := range MergeOBIMetrics(obi) {
+			c, ok := res.Metric[metricType]
+			if !ok || m.Avg > c.Max {
+				c.Max = m.Avg
+			}
+			if !ok || m.Avg < c.Min {
+				c.Min = m.Avg
+			}
+			c.Count++
+			sums[metricType] += m.Avg
+			res.Metric[metricType] = c
+		}
+	}
+	for metricType, c := range res.Metric {
+		c.Mean = sums[metricType] / float64(c.Count)
+		res.Metric[metricType] = c
+	}
+	return res
+}
@@ -0,0 +1,105 @@
+/*
+Copyright 2022 The Arbiter Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manager
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+
+	schedv1alpha1 "github.com/kube-arbiter/arbiter/pkg/apis/v1alpha1"
+	"github.com/kube-arbiter/arbiter/pkg/generated/clientset/versioned/fake"
+)
+
+func TestClusterMetrics(t *testing.T) {
+	mgr := newTestManager(t)
+	if c := mgr.ClusterMetrics(context.Background()); len(c.Metric) != 0 {
+		t.Fatalf("expect no cluster metric without node get %+v", c)
+	}
+	for node, values := range map[string][]string{"node1": {"10", "30"}, "node2": {"40"}, "node3": {"90"}} {
+		mgr.ObservabilityIndicantAdd(newNodeOBI("cpu", node, map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo{
+			"cpu": {{Records: newRecords(values...)}},
+		}))
+	}
+	// only node3 reports mem, and a negative value is the min and max.
+	mgr.ObservabilityIndicantAdd(newNodeOBI("mem", "node3", map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo{
+		"mem": {{Records: newRecords("-5")}},
+	}))
+	exp := ClusterMetrics{Metric: map[string]ClusterMetric{
+		"cpu": {Mean: 50, Max: 90, Min: 20, Count: 3},
+		"mem": {Mean: -5, Max: -5, Min: -5, Count: 1},
+	}}
+	if c := mgr.ClusterMetrics(context.Background()); !reflect.DeepEqual(exp, c) {
+		t.Fatalf("expect %+v get %+v", exp, c)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if c := mgr.ClusterMetrics(ctx); len(c.Metric) != 0 {
+		t.Fatalf("expect nothing once ctx is done get %+v", c)
+	}
+}
+
+func TestPreviewScoresClusterMean(t *testing.T) {
+	factory := informers.NewSharedInformerFactory(kubefake.NewSimpleClientset(), 0)
+	for _, name := range []string{"node1", "node2", "node3"} {
+		if err := factory.Core().V1().Nodes().Informer().GetIndexer().Add(&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: name}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mgr := NewManager(fake.NewSimpleClientset(), nil, factory.Core().V1().Pods(), factory.Core().V1().Nodes())
+	for node, cpu := range map[string]string{"node1": "20", "node2": "40", "node3": "90"} {
+		mgr.ObservabilityIndicantAdd(newNodeOBI("cpu", node, map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo{
+			"cpu": {{Records: newRecords(cpu)}},
+		}))
+	}
+	// the cluster mean of cpu is 50.
+	mgr.ScoreAdd(newScore("ns1", "below-mean", 1, `function score() {
+		if (node.metric.cpu.avg < cluster.metric.cpu.mean) { return 100; }
+		return 10;
+	}`))
+	mgr.ScoreAdd(newScore("ns1", "unknown-metric", 1, `function score() {
+		return cluster.metric.gpu === undefined ? 100 : 0;
+	}`))
+
+	pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "ns1", Name: "pod1"}}
+	res, err := mgr.PreviewScores(context.Background(), pod, []string{"node1", "node2", "node3"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	get := make(map[string]int64, len(res))
+	for _, r := range res {
+		for _, d := range r.Details {
+			if d.Err != nil {
+				t.Fatalf("expect no error of %s on %s get %v", d.NameKey, r.NodeName, d.Err)
+			}
+		}
+		get[r.NodeName] = r.Result
+	}
+	if exp := map[string]int64{"node1": 100, "node2": 100, "node3": 55}; !reflect.DeepEqual(exp, get) {
+		t.Fatalf("expect %v get %v", exp, get)
+	}
+
+	// without cluster metrics, e.g. EvaluateScoreResult, cluster.metric is empty.
+	if score, err := EvaluateLogic("function score() { return Object.keys(cluster.metric).length; }", "", &PodWithOBI{}, &NodeWithOBI{}); err != nil || score != 0 {
+		t.Fatalf("expect empty cluster.metric get %d %v", score, err)
+	}
+}
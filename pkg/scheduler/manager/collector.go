@@ -0,0 +1,126 @@
+/*
+Copyright 2022 The Arbiter Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manager
+
+import (
+	"time"
+
+	"k8s.io/component-base/metrics"
+)
+
+// FallbackLevelNone is the level of arbiter_manager_score_fallbacks_total when GetScore finds no Score
+// in the requested namespace nor any fallback namespace.
+const FallbackLevelNone = "none"
+
+var (
+	descCachedNodes = metrics.NewDesc(
+		"arbiter_manager_cached_nodes",
+		"Number of nodes which have metrics in the arbiter manager cache.",
+		nil, nil,
+		metrics.ALPHA,
+		"",
+	)
+	descCachedPods = metrics.NewDesc(
+		"arbiter_manager_cached_pods",
+		"Number of pods which have metrics in the arbiter manager cache.",
+		nil, nil,
+		metrics.ALPHA,
+		"",
+	)
+	descCachedScores = metrics.NewDesc(
+		"arbiter_manager_cached_scores",
+		"Number of Score CRs in the arbiter manager cache.",
+		[]string{"namespace"}, nil,
+		metrics.ALPHA,
+		"",
+	)
+	descScoreFallbacks = metrics.NewDesc(
+		"arbiter_manager_score_fallbacks_total",
+		"Number of GetScore falling back to another namespace, by the namespace reached or none if no Score is found.",
+		[]string{"level"}, nil,
+		metrics.ALPHA,
+		"",
+	)
+	descNodeMetricValue = metrics.NewDesc(
+		"arbiter_manager_node_metric_value",
+		"Last computed aggregation of a node metric in the arbiter manager cache.",
+		[]string{"node", "obi", "metric_type", "aggregation"}, nil,
+		metrics.ALPHA,
+		"",
+	)
+)
+
+type managerCollector struct {
+	metrics.BaseStableCollector
+
+	mgr *manager
+}
+
+// Check if managerCollector implements necessary interface
+var _ metrics.StableCollector = &managerCollector{}
+
+// NewManagerCollector implements the metrics.StableCollector interface and
+// exposes metrics about what the manager has cached.
+func NewManagerCollector(mgr *manager) metrics.StableCollector {
+	return &managerCollector{
+		mgr: mgr,
+	}
+}
+
+// DescribeWithStability implements the metrics.StableCollector interface.
+func (c *managerCollector) DescribeWithStability(ch chan<- *metrics.Desc) {
+	ch <- descCachedNodes
+	ch <- descCachedPods
+	ch <- descCachedScores
+	ch <- descScoreFallbacks
+	ch <- descNodeMetricValue
+}
+
+// CollectWithStability implements the metrics.StableCollector interface.
+func (c *managerCollector) CollectWithStability(ch chan<- metrics.Metric) {
+	c.mgr.scoreLock.RLock()
+	for ns, scoreCache := range c.mgr.score {
+		ch <- metrics.NewLazyConstMetric(descCachedScores, metrics.GaugeValue, float64(scoreCache.ItemCount()), ns)
+	}
+	c.mgr.scoreLock.RUnlock()
+
+	c.mgr.fallbackLock.Lock()
+	for level, count := range c.mgr.fallbackCounts {
+		ch <- metrics.NewLazyConstMetric(descScoreFallbacks, metrics.CounterValue, float64(count), level)
+	}
+	c.mgr.fallbackLock.Unlock()
+
+	c.mgr.RLock()
+	defer c.mgr.RUnlock()
+	ch <- metrics.NewLazyConstMetric(descCachedNodes, metrics.GaugeValue, float64(len(c.mgr.nodeMetric)))
+	ch <- metrics.NewLazyConstMetric(descCachedPods, metrics.GaugeValue, float64(len(c.mgr.podMetric)))
+	now := time.Now().UnixNano()
+	for nodeName, nodeCache := range c.mgr.nodeMetric {
+		for obiKey, item := range nodeCache.Items() {
+			cached, ok := item.Object.(cachedOBI)
+			if !ok {
+				continue
+			}
+			data, _ := cached.unexpired(now)
+			for metricType, m := range data.Metric {
+				ch <- metrics.NewLazyConstMetric(descNodeMetricValue, metrics.GaugeValue, m.Avg, nodeName, obiKey, metricType, "avg")
+				ch <- metrics.NewLazyConstMetric(descNodeMetricValue, metrics.GaugeValue, m.Max, nodeName, obiKey, metricType, "max")
+				ch <- metrics.NewLazyConstMetric(descNodeMetricValue, metrics.GaugeValue, m.Min, nodeName, obiKey, metricType, "min")
+			}
+		}
+	}
+}
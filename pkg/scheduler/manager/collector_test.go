@@ -0,0 +1,94 @@
+/*
+Copyright 2022 The Arbiter Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manager
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/component-base/metrics"
+	"k8s.io/component-base/metrics/testutil"
+
+	schedv1alpha1 "github.com/kube-arbiter/arbiter/pkg/apis/v1alpha1"
+)
+
+func TestManagerCollector(t *testing.T) {
+	mgr := newTestManager(t)
+	mgr.ObservabilityIndicantAdd(newNodeOBI("obi", "node1", map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo{
+		"cpu": {{Records: newRecords("1", "3")}},
+	}))
+	mgr.ObservabilityIndicantAdd(newPodOBI("obi", "ns1", "pod1", map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo{
+		"cpu": {{Records: newRecords("1")}},
+	}))
+	mgr.ScoreAdd(newScore("ns1", "score1", 1, "function score(){return 1}"))
+	mgr.ScoreAdd(newScore("ns1", "score2", 1, "function score(){return 1}"))
+	mgr.ScoreAdd(newScore("ns2", "score1", 1, "function score(){return 1}"))
+
+	registry := metrics.NewKubeRegistry()
+	registry.CustomMustRegister(NewManagerCollector(mgr))
+	expected := `
+# HELP arbiter_manager_cached_nodes [ALPHA] Number of nodes which have metrics in the arbiter manager cache.
+# TYPE arbiter_manager_cached_nodes gauge
+arbiter_manager_cached_nodes 1
+# HELP arbiter_manager_cached_pods [ALPHA] Number of pods which have metrics in the arbiter manager cache.
+# TYPE arbiter_manager_cached_pods gauge
+arbiter_manager_cached_pods 1
+# HELP arbiter_manager_cached_scores [ALPHA] Number of Score CRs in the arbiter manager cache.
+# TYPE arbiter_manager_cached_scores gauge
+arbiter_manager_cached_scores{namespace="ns1"} 2
+arbiter_manager_cached_scores{namespace="ns2"} 1
+# HELP arbiter_manager_node_metric_value [ALPHA] Last computed aggregation of a node metric in the arbiter manager cache.
+# TYPE arbiter_manager_node_metric_value gauge
+arbiter_manager_node_metric_value{aggregation="avg",metric_type="cpu",node="node1",obi="default-obi"} 2
+arbiter_manager_node_metric_value{aggregation="max",metric_type="cpu",node="node1",obi="default-obi"} 3
+arbiter_manager_node_metric_value{aggregation="min",metric_type="cpu",node="node1",obi="default-obi"} 1
+`
+	if err := testutil.GatherAndCompare(registry, strings.NewReader(expected)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestManagerCollectorScoreFallbacks(t *testing.T) {
+	t.Setenv("POD_NAMESPACE", "arbiter")
+	mgr := newTestManager(t)
+	registry := metrics.NewKubeRegistry()
+	registry.CustomMustRegister(NewManagerCollector(mgr))
+	ctx := context.Background()
+
+	mgr.GetScore(ctx, "ns1")
+	mgr.ScoreAdd(newScore(metav1.NamespaceSystem, "score1", 1, "function score(){return 1}"))
+	mgr.GetScore(ctx, "ns1")
+	mgr.GetScore(ctx, "ns2")
+	mgr.ScoreAdd(newScore("arbiter", "score1", 1, "function score(){return 1}"))
+	mgr.GetScore(ctx, "ns1")
+	// no fallback is counted for a namespace which has Score.
+	mgr.ScoreAdd(newScore("ns1", "score1", 1, "function score(){return 1}"))
+	mgr.GetScore(ctx, "ns1")
+
+	expected := `
+# HELP arbiter_manager_score_fallbacks_total [ALPHA] Number of GetScore falling back to another namespace, by the namespace reached or none if no Score is found.
+# TYPE arbiter_manager_score_fallbacks_total counter
+arbiter_manager_score_fallbacks_total{level="arbiter"} 1
+arbiter_manager_score_fallbacks_total{level="kube-system"} 2
+arbiter_manager_score_fallbacks_total{level="none"} 1
+`
+	if err := testutil.GatherAndCompare(registry, strings.NewReader(expected), "arbiter_manager_score_fallbacks_total"); err != nil {
+		t.Fatal(err)
+	}
+}
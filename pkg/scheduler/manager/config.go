@@ -0,0 +1,188 @@
+/*
+Copyright 2022 The Arbiter Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manager
+
+import (
+	"time"
+
+	gocache "github.com/patrickmn/go-cache"
+	informerv1 "k8s.io/client-go/informers/core/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog/v2"
+	"k8s.io/kubernetes/pkg/scheduler/framework"
+
+	clientset "github.com/kube-arbiter/arbiter/pkg/generated/clientset/versioned"
+)
+
+// ManagerConfig is the typed configuration of NewManagerFromConfig. Each setting behaves the same as
+// the Option referred to, and the zero value of a setting keeps the default of the manager.
+type ManagerConfig struct {
+	Client               clientset.Interface
+	SnapshotSharedLister framework.SharedLister
+	PodInformer          informerv1.PodInformer
+	NodeInformer         informerv1.NodeInformer
+
+	// DisableNamespaceFallback disables the namespace fallback of GetScore, see WithNamespaceFallback.
+	DisableNamespaceFallback bool
+	// FallbackNamespaces is the fallback chain of GetScore, see WithFallbackNamespaces.
+	FallbackNamespaces []string
+	// MergeScores, see WithScoreMerge.
+	MergeScores bool
+	// MetricTTL and MetricCleanupInterval, see WithMetricTTL.
+	MetricTTL             time.Duration
+	MetricCleanupInterval time.Duration
+	// MetricTypeTTL, see WithMetricTypeTTL.
+	MetricTypeTTL map[string]time.Duration
+	// PrimaryAggregations, see WithPrimaryAggregations.
+	PrimaryAggregations map[string]string
+	// WeightLabels, see WithWeightLabels.
+	WeightLabels map[string]string
+	// FlapPolicies, see WithFlapDetection.
+	FlapPolicies map[string]FlapPolicy
+	// UpdateDebounce, see WithUpdateDebounce.
+	UpdateDebounce time.Duration
+	// StaleThreshold, see WithStaleThreshold.
+	StaleThreshold time.Duration
+	// GapThreshold, see WithGapThreshold.
+	GapThreshold time.Duration
+	// DownsampleAge and DownsampleBucket, see WithDownsampling.
+	DownsampleAge    time.Duration
+	DownsampleBucket time.Duration
+	// MaxRecordsPerMetric, see WithMaxRecordsPerMetric.
+	MaxRecordsPerMetric int
+	// EWMAHalfLife, see WithEWMAHalfLife. Use a negative one to make EWMA the newest value.
+	EWMAHalfLife time.Duration
+	// CounterMetrics, see WithCounterMetrics.
+	CounterMetrics []string
+	// ValueSuffixes, see WithValueSuffixes.
+	ValueSuffixes map[string][]string
+	// EnumValues, see WithEnumValues.
+	EnumValues map[string]map[string]float64
+	// ScoreEvaluators are registered by name, see WithScoreEvaluator.
+	ScoreEvaluators map[string]ScoreEvaluator
+	// ScoreTimeout, see WithScoreTimeout. Use a negative one for no limit.
+	ScoreTimeout time.Duration
+	// UnresolvedBackoff and MaxUnresolvedBackoff, see WithUnresolvedBackoff. Use a negative UnresolvedBackoff
+	// to disable the backoff.
+	UnresolvedBackoff    time.Duration
+	MaxUnresolvedBackoff time.Duration
+	// MetricScales, see WithMetricScales.
+	MetricScales map[string]MetricScale
+	// AggregateHistoryDepth, see WithAggregateHistory.
+	AggregateHistoryDepth int
+	// EventRecorder, see WithEventRecorder.
+	EventRecorder record.EventRecorder
+	// Logger, see WithLogger.
+	Logger klog.Logger
+}
+
+// Options returns the Option of each setting in c which is not the zero value.
+func (c ManagerConfig) Options() []Option {
+	var opts []Option
+	if c.DisableNamespaceFallback {
+		opts = append(opts, WithNamespaceFallback(false))
+	}
+	if c.FallbackNamespaces != nil {
+		opts = append(opts, WithFallbackNamespaces(c.FallbackNamespaces...))
+	}
+	if c.MergeScores {
+		opts = append(opts, WithScoreMerge(true))
+	}
+	if c.MetricTTL != 0 || c.MetricCleanupInterval != 0 {
+		ttl, interval := c.MetricTTL, c.MetricCleanupInterval
+		if ttl == 0 {
+			ttl = gocache.NoExpiration
+		}
+		if interval == 0 {
+			interval = gocache.NoExpiration
+		}
+		opts = append(opts, WithMetricTTL(ttl, interval))
+	}
+	if c.MetricTypeTTL != nil {
+		opts = append(opts, WithMetricTypeTTL(c.MetricTypeTTL))
+	}
+	if c.PrimaryAggregations != nil {
+		opts = append(opts, WithPrimaryAggregations(c.PrimaryAggregations))
+	}
+	if c.WeightLabels != nil {
+		opts = append(opts, WithWeightLabels(c.WeightLabels))
+	}
+	if c.FlapPolicies != nil {
+		opts = append(opts, WithFlapDetection(c.FlapPolicies))
+	}
+	if c.UpdateDebounce != 0 {
+		opts = append(opts, WithUpdateDebounce(c.UpdateDebounce))
+	}
+	if c.StaleThreshold != 0 {
+		opts = append(opts, WithStaleThreshold(c.StaleThreshold))
+	}
+	if c.GapThreshold != 0 {
+		opts = append(opts, WithGapThreshold(c.GapThreshold))
+	}
+	if c.DownsampleAge != 0 {
+		opts = append(opts, WithDownsampling(c.DownsampleAge, c.DownsampleBucket))
+	}
+	if c.MaxRecordsPerMetric != 0 {
+		opts = append(opts, WithMaxRecordsPerMetric(c.MaxRecordsPerMetric))
+	}
+	if c.EWMAHalfLife != 0 {
+		opts = append(opts, WithEWMAHalfLife(c.EWMAHalfLife))
+	}
+	if len(c.CounterMetrics) != 0 {
+		opts = append(opts, WithCounterMetrics(c.CounterMetrics...))
+	}
+	if c.ValueSuffixes != nil {
+		opts = append(opts, WithValueSuffixes(c.ValueSuffixes))
+	}
+	if c.EnumValues != nil {
+		opts = append(opts, WithEnumValues(c.EnumValues))
+	}
+	for name, evaluator := range c.ScoreEvaluators {
+		opts = append(opts, WithScoreEvaluator(name, evaluator))
+	}
+	if c.ScoreTimeout != 0 {
+		opts = append(opts, WithScoreTimeout(c.ScoreTimeout))
+	}
+	if c.MetricScales != nil {
+		opts = append(opts, WithMetricScales(c.MetricScales))
+	}
+	if c.AggregateHistoryDepth != 0 {
+		opts = append(opts, WithAggregateHistory(c.AggregateHistoryDepth))
+	}
+	if c.UnresolvedBackoff != 0 || c.MaxUnresolvedBackoff != 0 {
+		initial, max := c.UnresolvedBackoff, c.MaxUnresolvedBackoff
+		if initial == 0 {
+			initial = DefaultUnresolvedBackoff
+		}
+		if max == 0 {
+			max = DefaultMaxUnresolvedBackoff
+		}
+		opts = append(opts, WithUnresolvedBackoff(initial, max))
+	}
+	if c.EventRecorder != nil {
+		opts = append(opts, WithEventRecorder(c.EventRecorder))
+	}
+	if c.Logger.GetSink() != nil {
+		opts = append(opts, WithLogger(c.Logger))
+	}
+	return opts
+}
+
+// NewManagerFromConfig creates the manager by config, opts are applied after the settings of config.
+func NewManagerFromConfig(config ManagerConfig, opts ...Option) *manager {
+	return NewManager(config.Client, config.SnapshotSharedLister, config.PodInformer, config.NodeInformer, append(config.Options(), opts...)...)
+}
@@ -0,0 +1,109 @@
+/*
+Copyright 2022 The Arbiter Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manager
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	gocache "github.com/patrickmn/go-cache"
+	"k8s.io/client-go/informers"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+
+	"github.com/kube-arbiter/arbiter/pkg/generated/clientset/versioned/fake"
+)
+
+func TestNewManagerFromConfig(t *testing.T) {
+	factory := informers.NewSharedInformerFactory(kubefake.NewSimpleClientset(), 0)
+	recorder := record.NewFakeRecorder(1)
+	mgr := NewManagerFromConfig(ManagerConfig{
+		Client:                   fake.NewSimpleClientset(),
+		PodInformer:              factory.Core().V1().Pods(),
+		NodeInformer:             factory.Core().V1().Nodes(),
+		DisableNamespaceFallback: true,
+		FallbackNamespaces:       []string{"policy"},
+		MergeScores:              true,
+		MetricTTL:                time.Minute,
+		MetricTypeTTL:            map[string]time.Duration{"disk": time.Hour},
+		FlapPolicies:             map[string]FlapPolicy{"cpu": {Threshold: 3}},
+		UpdateDebounce:           time.Second,
+		EWMAHalfLife:             -1,
+		CounterMetrics:           []string{"requests"},
+		ScoreEvaluators:          map[string]ScoreEvaluator{"number": numberEvaluator{}},
+		ScoreTimeout:             -1,
+		MaxUnresolvedBackoff:     time.Hour,
+		AggregateHistoryDepth:    10,
+		DownsampleAge:            time.Hour,
+		GapThreshold:             time.Minute,
+		MetricScales:             map[string]MetricScale{"memory": {Scale: 2}},
+		EventRecorder:            recorder,
+	}, WithFallbackNamespaces("override"))
+
+	if mgr.namespaceFallback {
+		t.Fatalf("expect namespace fallback disabled")
+	}
+	if !mgr.mergeScores {
+		t.Fatalf("expect score merge enabled")
+	}
+	if exp := []string{"override"}; !reflect.DeepEqual(exp, mgr.fallbackNamespaces) {
+		t.Fatalf("expect opts applied after config, get %v", mgr.fallbackNamespaces)
+	}
+	if mgr.metricTTL != time.Minute || mgr.metricCleanupInterval != gocache.NoExpiration {
+		t.Fatalf("expect metric ttl 1m without cleanup get %v %v", mgr.metricTTL, mgr.metricCleanupInterval)
+	}
+	if mgr.metricTypeTTL["disk"] != time.Hour || mgr.debounceWindow != time.Second || mgr.ewmaHalfLife != -1 {
+		t.Fatalf("expect metric type ttl, debounce and ewma set get %v %v %v", mgr.metricTypeTTL, mgr.debounceWindow, mgr.ewmaHalfLife)
+	}
+	if _, ok := mgr.counterMetrics["requests"]; !ok {
+		t.Fatalf("expect counter metrics set get %v", mgr.counterMetrics)
+	}
+	if _, ok := mgr.evaluators["number"]; !ok || mgr.evaluators[DefaultScoreEvaluator] == nil {
+		t.Fatalf("expect number evaluator along with the default one get %v", mgr.evaluators)
+	}
+	if mgr.flapPolicies["cpu"].Threshold != 3 {
+		t.Fatalf("expect flap policy of cpu set get %v", mgr.flapPolicies)
+	}
+	if mgr.scoreTimeout != -1 {
+		t.Fatalf("expect score timeout disabled get %v", mgr.scoreTimeout)
+	}
+	if mgr.unresolvedBackoff != DefaultUnresolvedBackoff || mgr.maxUnresolvedBackoff != time.Hour {
+		t.Fatalf("expect unresolved backoff %v up to 1h get %v up to %v", DefaultUnresolvedBackoff, mgr.unresolvedBackoff, mgr.maxUnresolvedBackoff)
+	}
+	if mgr.historyDepth != 10 {
+		t.Fatalf("expect aggregate history depth 10 get %d", mgr.historyDepth)
+	}
+	if mgr.gapThreshold != time.Minute {
+		t.Fatalf("expect gap threshold 1m get %v", mgr.gapThreshold)
+	}
+	if mgr.downsampleAge != time.Hour || mgr.downsampleBucket != DefaultDownsampleBucket {
+		t.Fatalf("expect downsampling of records older than 1h get %v %v", mgr.downsampleAge, mgr.downsampleBucket)
+	}
+	if mgr.metricScales["memory"].Scale != 2 {
+		t.Fatalf("expect memory scale 2 get %v", mgr.metricScales)
+	}
+	if mgr.recorder != recorder {
+		t.Fatalf("expect event recorder set")
+	}
+
+	// the zero config keeps the defaults of NewManager.
+	def := NewManagerFromConfig(ManagerConfig{PodInformer: factory.Core().V1().Pods(), NodeInformer: factory.Core().V1().Nodes()})
+	if !def.namespaceFallback || def.metricTTL != gocache.NoExpiration || def.ewmaHalfLife != DefaultEWMAHalfLife || def.debounceWindow != 0 || def.scoreTimeout != DefaultScoreTimeout {
+		t.Fatalf("expect defaults with zero config get %+v", def)
+	}
+}
@@ -0,0 +1,86 @@
+/*
+Copyright 2022 The Arbiter Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manager
+
+import (
+	"time"
+
+	schedv1alpha1 "github.com/kube-arbiter/arbiter/pkg/apis/v1alpha1"
+)
+
+// debounceUpdate holds the updated obi until the debounce window of its cache key ends, a later update
+// in the window replaces the held one, so only the last one is aggregated, see WithUpdateDebounce.
+// It returns false if debouncing is disabled, obj should be added right away in that case.
+func (mgr *manager) debounceUpdate(obj interface{}) bool {
+	if mgr.debounceWindow <= 0 {
+		return false
+	}
+	obi, ok := obj.(*schedv1alpha1.ObservabilityIndicant)
+	if !ok {
+		return false
+	}
+	key := getMetricCacheKey(obi)
+	mgr.debounceLock.Lock()
+	defer mgr.debounceLock.Unlock()
+	if mgr.closed() {
+		// no timer is started after Close, add it right away.
+		return false
+	}
+	mgr.pendingUpdates[key] = obi
+	if _, scheduled := mgr.debounceTimers[key]; !scheduled {
+		mgr.workers.Add(1)
+		mgr.debounceTimers[key] = time.AfterFunc(mgr.debounceWindow, func() {
+			defer mgr.workers.Done()
+			mgr.flushUpdate(key)
+		})
+	}
+	return true
+}
+
+// flushUpdate adds the held obi of key. debounceLock is held during the add,
+// so a delete of the obi can not be overwritten by a held update.
+func (mgr *manager) flushUpdate(key string) {
+	mgr.debounceLock.Lock()
+	defer mgr.debounceLock.Unlock()
+	delete(mgr.debounceTimers, key)
+	obi, ok := mgr.pendingUpdates[key]
+	if !ok {
+		return
+	}
+	delete(mgr.pendingUpdates, key)
+	mgr.ObservabilityIndicantAdd(obi)
+}
+
+// stopUpdateLocked stops the debounce timer of key and drops its held update, mgr.debounceLock must be held.
+func (mgr *manager) stopUpdateLocked(key string) {
+	delete(mgr.pendingUpdates, key)
+	if timer, ok := mgr.debounceTimers[key]; ok && timer.Stop() {
+		// the timer never fires, so it is done here instead.
+		mgr.workers.Done()
+	}
+	delete(mgr.debounceTimers, key)
+}
+
+// cancelUpdate drops the held update of obi once it is deleted.
+func (mgr *manager) cancelUpdate(obi *schedv1alpha1.ObservabilityIndicant) {
+	if mgr.debounceWindow <= 0 {
+		return
+	}
+	mgr.debounceLock.Lock()
+	defer mgr.debounceLock.Unlock()
+	mgr.stopUpdateLocked(getMetricCacheKey(obi))
+}
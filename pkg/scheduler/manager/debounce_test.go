@@ -0,0 +1,75 @@
+/*
+Copyright 2022 The Arbiter Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manager
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	schedv1alpha1 "github.com/kube-arbiter/arbiter/pkg/apis/v1alpha1"
+)
+
+func TestUpdateDebounce(t *testing.T) {
+	newValueOBI := func(value string) *schedv1alpha1.ObservabilityIndicant {
+		return newNodeOBI("obi", "node1", map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo{
+			"cpu": {{Records: newRecords(value)}},
+		})
+	}
+	mgr := newTestManager(t, WithUpdateDebounce(100*time.Millisecond))
+	var aggregations int32
+	mgr.RegisterOnMetricUpdate(func(string, string) {
+		atomic.AddInt32(&aggregations, 1)
+	})
+	mgr.ObservabilityIndicantAdd(newValueOBI("0"))
+	for i := 1; i <= 100; i++ {
+		mgr.ObservabilityIndicantUpdate(nil, newValueOBI(strconv.Itoa(i)))
+	}
+	if m, err := mgr.GetNodeMetric(context.Background(), "node1", "cpu"); err != nil || m.Avg != 0 {
+		t.Fatalf("expect updates held in the window get %+v %v", m, err)
+	}
+
+	time.Sleep(300 * time.Millisecond)
+	if m, err := mgr.GetNodeMetric(context.Background(), "node1", "cpu"); err != nil || m.Avg != 100 {
+		t.Fatalf("expect the last update aggregated get %+v %v", m, err)
+	}
+	// one for the add, and the updates are coalesced into a few windows.
+	if n := atomic.LoadInt32(&aggregations); n < 2 || n > 4 {
+		t.Fatalf("expect bounded aggregations get %d", n)
+	}
+
+	// a delete drops the held update.
+	mgr.ObservabilityIndicantUpdate(nil, newValueOBI("1"))
+	mgr.ObservabilityIndicantDelete(newValueOBI("1"))
+	time.Sleep(200 * time.Millisecond)
+	if _, err := mgr.GetNodeOBI(context.Background(), "node1"); !errors.Is(err, ErrNotFoundInCache) {
+		t.Fatalf("expect deleted obi not added back get %v", err)
+	}
+}
+
+func TestUpdateWithoutDebounce(t *testing.T) {
+	mgr := newTestManager(t)
+	mgr.ObservabilityIndicantUpdate(nil, newNodeOBI("obi", "node1", map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo{
+		"cpu": {{Records: newRecords("5")}},
+	}))
+	if m, err := mgr.GetNodeMetric(context.Background(), "node1", "cpu"); err != nil || m.Avg != 5 {
+		t.Fatalf("expect the update aggregated at once get %+v %v", m, err)
+	}
+}
@@ -0,0 +1,89 @@
+/*
+Copyright 2022 The Arbiter Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manager
+
+import (
+	"time"
+
+	"k8s.io/klog/v2"
+
+	schedv1alpha1 "github.com/kube-arbiter/arbiter/pkg/apis/v1alpha1"
+)
+
+// DefaultDownsampleBucket is the bucket of WithDownsampling if it is not positive.
+const DefaultDownsampleBucket = 5 * time.Minute
+
+// RecordBucket summarizes the records of a metric in [Timestamp, Timestamp+bucket), Timestamp is unix milliseconds.
+// Sum, Min and Max are of the Count values in the canonical unit, see WithDownsampling.
+type RecordBucket struct {
+	Timestamp int64   `json:"timestamp"`
+	Count     int     `json:"count"`
+	Sum       float64 `json:"sum"`
+	Min       float64 `json:"min"`
+	Max       float64 `json:"max"`
+}
+
+// mean is the average value of b, it stands for the bucket in the time-ordered aggregations, e.g. EWMA and Slope.
+func (b RecordBucket) mean() float64 {
+	return b.Sum / float64(b.Count)
+}
+
+// downsampleRecords replaces the records of info older than mgr.downsampleAge before the newest record by buckets
+// of mgr.downsampleBucket, the newer records are kept as is. The records must be sorted by timestamp, see
+// mergeMetricInfo. Old records which can not be parsed or are not finite are dropped, as they are never aggregated.
+// It returns nil if downsampling is disabled, the unit is unknown or no record is old enough.
+func (mgr *manager) downsampleRecords(logger klog.Logger, metricType string, info *schedv1alpha1.ObservabilityIndicantStatusMetricInfo) []RecordBucket {
+	if mgr.downsampleAge <= 0 || len(info.Records) == 0 {
+		return nil
+	}
+	if _, _, ok := normalizeUnit(info.Unit); !ok {
+		return nil
+	}
+	cutoff := info.Records[len(info.Records)-1].Timestamp - mgr.downsampleAge.Milliseconds()
+	old := 0
+	for old < len(info.Records) && info.Records[old].Timestamp < cutoff {
+		old++
+	}
+	if old == 0 {
+		return nil
+	}
+	samples, _ := parseSamples(logger, info.Records[:old], mgr.valueParser(metricType, info.Unit))
+	info.Records = append([]schedv1alpha1.Record(nil), info.Records[old:]...)
+
+	bucket := mgr.downsampleBucket.Milliseconds()
+	var buckets []RecordBucket
+	for _, s := range samples {
+		start := s.Timestamp - s.Timestamp%bucket
+		if s.Timestamp%bucket < 0 {
+			start -= bucket
+		}
+		if n := len(buckets); n == 0 || buckets[n-1].Timestamp != start {
+			buckets = append(buckets, RecordBucket{Timestamp: start, Min: s.Value, Max: s.Value})
+		}
+		b := &buckets[len(buckets)-1]
+		b.Count++
+		b.Sum += s.Value
+		if s.Value < b.Min {
+			b.Min = s.Value
+		}
+		if s.Value > b.Max {
+			b.Max = s.Value
+		}
+	}
+	logger.V(5).Info(ManagerLogPrefix+"downsample records", "metricType", metricType, "records", old, "buckets", len(buckets))
+	return buckets
+}
@@ -0,0 +1,83 @@
+/*
+Copyright 2022 The Arbiter Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manager
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	schedv1alpha1 "github.com/kube-arbiter/arbiter/pkg/apis/v1alpha1"
+)
+
+func TestDownsampling(t *testing.T) {
+	// records of 1 to 10 at minute 1 to 10.
+	obi := newNodeOBI("cpu", "node1", map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo{
+		"cpu": {{Records: newRecords("1", "2", "3", "4", "5", "6", "7", "8", "9", "10")}},
+	})
+	full := newTestManager(t)
+	full.ObservabilityIndicantAdd(obi)
+	exp := getNodeMetric(t, full, obi, "node1", "cpu")
+	if len(exp.Records) != 10 || exp.Buckets != nil {
+		t.Fatalf("expect all records kept without downsampling get %+v", exp)
+	}
+
+	mgr := newTestManager(t, WithDownsampling(3*time.Minute, 0))
+	mgr.ObservabilityIndicantAdd(obi)
+	m := getNodeMetric(t, mgr, obi, "node1", "cpu")
+	// records before minute 7 are downsampled into the 5 minutes buckets of minute 0 and 5.
+	var timestamps []int64
+	for _, r := range m.Records {
+		timestamps = append(timestamps, r.Timestamp/60000)
+	}
+	if expTimestamps := []int64{7, 8, 9, 10}; !reflect.DeepEqual(expTimestamps, timestamps) {
+		t.Fatalf("expect recent records at minute %v get %v", expTimestamps, timestamps)
+	}
+	expBuckets := []RecordBucket{
+		{Timestamp: 0, Count: 4, Sum: 10, Min: 1, Max: 4},
+		{Timestamp: 5 * 60000, Count: 2, Sum: 11, Min: 5, Max: 6},
+	}
+	if !reflect.DeepEqual(expBuckets, m.Buckets) {
+		t.Fatalf("expect buckets %+v get %+v", expBuckets, m.Buckets)
+	}
+	if m.Count != exp.Count || m.Sum != exp.Sum || m.Avg != exp.Avg || m.Max != exp.Max || m.Min != exp.Min ||
+		m.Median != exp.Median || m.Latest != exp.Latest {
+		t.Fatalf("expect the aggregations of all records %+v get %+v", exp, m)
+	}
+
+	mgr = newTestManager(t, WithDownsampling(time.Hour, 0))
+	mgr.ObservabilityIndicantAdd(obi)
+	if m := getNodeMetric(t, mgr, obi, "node1", "cpu"); len(m.Records) != 10 || m.Buckets != nil {
+		t.Fatalf("expect no record old enough to downsample get %+v", m)
+	}
+}
+
+func TestDownsamplingSubMillisecondBucket(t *testing.T) {
+	mgr := newTestManager(t, WithDownsampling(time.Minute, 500*time.Microsecond))
+	if mgr.downsampleBucket != time.Millisecond {
+		t.Fatalf("expect bucket rounded up to 1ms get %v", mgr.downsampleBucket)
+	}
+	obi := newNodeOBI("cpu", "node1", map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo{
+		"cpu": {{Records: newRecords("1", "2", "3")}},
+	})
+	mgr.ObservabilityIndicantAdd(obi)
+	m := getNodeMetric(t, mgr, obi, "node1", "cpu")
+	// each old record gets a bucket of its own.
+	if len(m.Records) != 2 || len(m.Buckets) != 1 || m.Buckets[0].Timestamp != 60000 || m.Sum != 6 {
+		t.Fatalf("expect the first record downsampled into its own bucket get %+v", m)
+	}
+}
@@ -0,0 +1,396 @@
+/*
+Copyright 2022 The Arbiter Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/dop251/goja"
+	"github.com/dop251/goja_nodejs/console"
+	"github.com/dop251/goja_nodejs/require"
+	"k8s.io/apimachinery/pkg/util/json"
+	"k8s.io/klog/v2"
+	"k8s.io/kubernetes/pkg/scheduler/framework"
+
+	schedv1alpha1 "github.com/kube-arbiter/arbiter/pkg/apis/v1alpha1"
+)
+
+const (
+	DebugLogic = `console.log("[arbiter]", "pod:", JSON.stringify(pod), "node:", JSON.stringify(node));`
+
+	// ScoreEvaluatorAnnotation selects the ScoreEvaluator of a Score by name, see WithScoreEvaluator.
+	ScoreEvaluatorAnnotation = "arbiter.k8s.com.cn/score-evaluator"
+	// DefaultScoreEvaluator is the name of JavaScriptEvaluator, used if a Score has no ScoreEvaluatorAnnotation.
+	DefaultScoreEvaluator = "javascript"
+	// ScoreTimeoutAnnotation is the evaluation timeout of a Score as a duration, e.g. "500ms", see WithScoreTimeout.
+	ScoreTimeoutAnnotation = "arbiter.k8s.com.cn/score-timeout"
+	// DefaultScoreTimeout is the evaluation timeout of a Score without ScoreTimeoutAnnotation.
+	DefaultScoreTimeout = time.Second
+	// PodProfileLabel is the label of a pod, or the annotation if there is no such label, naming its profile,
+	// which selects the weight of each Score in ScoreSpec.ProfileWeights, see GetScoreForPod.
+	PodProfileLabel = "arbiter.k8s.com.cn/profile"
+	// MetricScaleAnnotation scales metric types in the logic of a Score, a json object of MetricScale keyed by
+	// metric type, e.g. {"memory":{"scale":9.313225746154785e-10}} for memory in GiB, see WithMetricScales.
+	MetricScaleAnnotation = "arbiter.k8s.com.cn/metric-scale"
+	// PodSelectorAnnotation limits a Score to the pods whose labels match it, in the label selector syntax,
+	// e.g. "accelerator=nvidia,tier in (training)". A Score without it applies to all pods, see GetScoreForPod.
+	PodSelectorAnnotation = "arbiter.k8s.com.cn/pod-selector"
+)
+
+var (
+	ErrNoScoreFunction       = errors.New("no score function found")
+	ErrUnknownScoreEvaluator = errors.New("unknown score evaluator")
+	ErrScoreTimeout          = errors.New("score evaluation timed out")
+)
+
+// Program is the logic compiled by a ScoreEvaluator.
+// It is shared by concurrent evaluations and should not be modified.
+type Program interface{}
+
+// ScoreContext is what a Program is evaluated against.
+type ScoreContext struct {
+	ScoreKey string
+	Pod      *PodWithOBI
+	Node     *NodeWithOBI
+	// Cluster is the metrics of all nodes, it is the same for every node in a scheduling cycle.
+	Cluster ClusterMetrics
+	// Context is done when the evaluation times out, nil if there is no timeout.
+	Context context.Context
+}
+
+// ScoreEvaluator compiles and evaluates the logic of Score.
+// The logic is compiled once when the Score is cached and evaluated for every pod and node.
+// Eval should return soon after ScoreContext.Context is done, the result is discarded with ErrScoreTimeout.
+type ScoreEvaluator interface {
+	Compile(logic string) (Program, error)
+	// Eval returns the score of the node, it should be in [framework.MinNodeScore, framework.MaxNodeScore].
+	Eval(program Program, ctx ScoreContext) (float64, error)
+}
+
+// JavaScriptEvaluator is the default ScoreEvaluator, the logic is javascript with a score() function, see EvaluateLogic.
+type JavaScriptEvaluator struct{}
+
+var _ ScoreEvaluator = JavaScriptEvaluator{}
+
+type javaScriptProgram struct {
+	program *goja.Program
+	logic   string
+}
+
+func (JavaScriptEvaluator) Compile(logic string) (Program, error) {
+	program, err := goja.Compile("", logic, false)
+	if err != nil {
+		return nil, err
+	}
+	return &javaScriptProgram{program: program, logic: logic}, nil
+}
+
+func (JavaScriptEvaluator) Eval(program Program, ctx ScoreContext) (float64, error) {
+	p, ok := program.(*javaScriptProgram)
+	if !ok {
+		return 0, fmt.Errorf("%w: program is not compiled by JavaScriptEvaluator", ErrTypeAssertion)
+	}
+	return evaluate(p.program, p.logic, ctx)
+}
+
+// EvaluateLogic runs the javascript logic of a Score and returns the result of its score() function.
+// The logic can use the following variables:
+//
+//	pod.raw      the pod to be scheduled
+//	pod.obi      OBI of the pod keyed by obi, e.g. pod.obi[name].metric.cpu.avg
+//	pod.metric   metrics of all OBI of the pod, e.g. pod.metric.cpu.avg, see MergeOBIMetrics
+//	pod.requests resources requested by the pod in the units of node.allocatable, e.g. pod.requests.cpu in millicores
+//	node.raw     the candidate node
+//	node.obi     OBI of the node keyed by obi, e.g. node.obi[name].metric.cpu.avg
+//	node.metric  metrics of all OBI of the node, e.g. node.metric.cpu.avg, see MergeOBIMetrics
+//	node.labels  labels of the node, e.g. node.labels["node.kubernetes.io/instance-type"]
+//	node.taints  taints of the node, e.g. node.taints[0].effect
+//	node.cpuReq  milli cpu requested by pods on the node
+//	node.memReq  memory requested by pods on the node
+//	node.capacity     capacity of the node in the canonical units of the metrics, e.g. node.capacity.cpu in millicores
+//	node.allocatable  allocatable of the node in the same units, e.g. node.allocatable.memory in bytes
+//	cluster.metric  metrics aggregated over all nodes, e.g. cluster.metric.cpu.mean, see ClusterMetric
+//
+// and the following helper functions for ratios, see ratio, percent, clampScore and fitScore:
+//
+//	ratio(part, whole)    part / whole, 0 if whole is not positive
+//	percent(part, whole)  100 * ratio(part, whole), e.g. percent(node.metric.cpu.avg, node.allocatable.cpu) > 80
+//	clampScore(value)     value clamped to [0, 100], the range of a valid score
+//	fitScore(request, free)  the best-fit score of request in free, e.g.
+//	                         fitScore(pod.requests.cpu, node.allocatable.cpu - node.metric.cpu.avg)
+//
+// See FullMetrics for the fields of a metric.
+func EvaluateLogic(logic, scoreKey string, podWithOBI *PodWithOBI, nodeWithOBI *NodeWithOBI) (int64, error) {
+	return evaluateWith(JavaScriptEvaluator{}, nil, logic, ScoreContext{ScoreKey: scoreKey, Pod: podWithOBI, Node: nodeWithOBI})
+}
+
+// EvaluateScore evaluates the logic of spec by the JavaScriptEvaluator against obi as the OBI of the node,
+// without any cache state. The pod and the node are empty, so it is meant to test the logic on hand-built OBI.
+func EvaluateScore(spec schedv1alpha1.ScoreSpec, obi map[string]OBI) (int64, error) {
+	return EvaluateLogic(spec.Logic, "", &PodWithOBI{}, &NodeWithOBI{OBI: obi, Metric: MergeOBIMetrics(obi)})
+}
+
+// EvaluateScoreResult is like EvaluateLogic, but runs the program compiled by the ScoreEvaluator of the Score when it is cached.
+// The cluster metrics are empty, see EvaluateScoreResultInCluster.
+func EvaluateScoreResult(score ScoreResult, podWithOBI *PodWithOBI, nodeWithOBI *NodeWithOBI) (int64, error) {
+	return EvaluateScoreResultInCluster(score, podWithOBI, nodeWithOBI, ClusterMetrics{})
+}
+
+// EvaluateScoreResultInCluster is the same as EvaluateScoreResult, with cluster as the metrics of all nodes.
+// The metric types in score.MetricScales are scaled first. The evaluation is aborted with ErrScoreTimeout after score.Timeout.
+func EvaluateScoreResultInCluster(score ScoreResult, podWithOBI *PodWithOBI, nodeWithOBI *NodeWithOBI, cluster ClusterMetrics) (int64, error) {
+	evaluator := score.Evaluator
+	if evaluator == nil {
+		evaluator = JavaScriptEvaluator{}
+	}
+	if len(score.MetricScales) != 0 {
+		podWithOBI, nodeWithOBI, cluster = scaleScoreContext(podWithOBI, nodeWithOBI, cluster, score.MetricScales)
+	}
+	ctx := ScoreContext{ScoreKey: score.NameKey, Pod: podWithOBI, Node: nodeWithOBI, Cluster: cluster}
+	if score.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx.Context, cancel = context.WithTimeout(context.Background(), score.Timeout)
+		defer cancel()
+	}
+	return evaluateWith(evaluator, score.Program, score.Logic, ctx)
+}
+
+// evaluateWith evaluates program by evaluator against ctx, logic is compiled first if program is nil.
+func evaluateWith(evaluator ScoreEvaluator, program Program, logic string, ctx ScoreContext) (int64, error) {
+	scoreKey, podWithOBI, nodeWithOBI := ctx.ScoreKey, ctx.Pod, ctx.Node
+	if program == nil {
+		var err error
+		if program, err = evaluator.Compile(logic); err != nil {
+			return 0, err
+		}
+	}
+	value, err := evaluator.Eval(program, ctx)
+	if ctx.Context != nil && ctx.Context.Err() != nil {
+		klog.ErrorS(ErrScoreTimeout, ManagerLogPrefix+"Score evaluation is aborted", "pod", klog.KObj(&podWithOBI.Pod), "node", nodeWithOBI.Node.Name, "scoreCR", scoreKey, "err", err)
+		return 0, fmt.Errorf("%w: ScoreCR:%s, %v", ErrScoreTimeout, scoreKey, ctx.Context.Err())
+	}
+	if err != nil {
+		return 0, err
+	}
+	score := int64(value)
+	if score < 0 || score > 100 {
+		msg := fmt.Sprintf("ScoreCR:%s returns an invalid score %d, it should in the range of [%v, %v]", scoreKey, score, framework.MinNodeScore, framework.MaxNodeScore)
+		klog.ErrorS(errors.New(msg), msg, "pod", klog.KObj(&podWithOBI.Pod), "node", nodeWithOBI.Node.Name, "scoreCR", scoreKey, "score", score)
+		return 0, errors.New(msg)
+	}
+	return score, nil
+}
+
+// ratio returns part / whole, 0 if whole is not positive, e.g. a node without the capacity of a resource.
+func ratio(part, whole float64) float64 {
+	if whole <= 0 {
+		return 0
+	}
+	return part / whole
+}
+
+// percent returns part of whole in percentage, see ratio.
+func percent(part, whole float64) float64 {
+	return 100 * ratio(part, whole)
+}
+
+// fitScore returns how tightly request fits in free for best-fit, percent(request, free) if it fits, so the node
+// left with the least free resource scores the highest, and framework.MinNodeScore if it does not fit.
+// A pod without the request, e.g. pod.requests.cpu is undefined, gets NeutralNodeScore on every node.
+func fitScore(request, free float64) float64 {
+	if request <= 0 || math.IsNaN(request) {
+		return float64(NeutralNodeScore)
+	}
+	if request > free {
+		return float64(framework.MinNodeScore)
+	}
+	return percent(request, free)
+}
+
+// clampScore clamps value to [framework.MinNodeScore, framework.MaxNodeScore].
+func clampScore(value float64) float64 {
+	return math.Max(float64(framework.MinNodeScore), math.Min(float64(framework.MaxNodeScore), value))
+}
+
+func evaluate(program *goja.Program, logic string, ctx ScoreContext) (score float64, err error) {
+	scoreKey, podWithOBI, nodeWithOBI := ctx.ScoreKey, ctx.Pod, ctx.Node
+	nodeName := nodeWithOBI.Node.Name
+	registry := new(require.Registry)
+	vm := goja.New()
+	registry.Enable(vm)
+	console.Enable(vm)
+	vm.SetFieldNameMapper(goja.TagFieldNameMapper("json", true))
+	if ctx.Context != nil {
+		stop := make(chan struct{})
+		defer close(stop)
+		go func() {
+			select {
+			case <-ctx.Context.Done():
+				vm.Interrupt(ctx.Context.Err())
+			case <-stop:
+			}
+		}()
+	}
+
+	/*
+		same with node
+	*/
+	pt, err := json.Marshal(podWithOBI)
+	if err != nil {
+		if klog.V(5).Enabled() {
+			klog.V(5).ErrorS(err, ManagerLogPrefix+"pod json.Marshal error", "pod", klog.KObj(&podWithOBI.Pod), "node", nodeName, "scoreCR", scoreKey)
+		} else if klog.V(4).Enabled() {
+			klog.V(4).ErrorS(err, ManagerLogPrefix+"pod json.Marshal error", "pod", klog.KObj(&podWithOBI.Pod), "node", nodeName, "scoreCR", scoreKey, "podWithOBI", podWithOBI)
+		}
+		return 0, err
+	}
+	var po map[string]interface{}
+	if err = json.Unmarshal(pt, &po); err != nil {
+		if klog.V(5).Enabled() {
+			klog.V(5).ErrorS(err, ManagerLogPrefix+"pod json.Unmarshal error", "pod", klog.KObj(&podWithOBI.Pod), "node", nodeName, "scoreCR", scoreKey)
+		} else if klog.V(4).Enabled() {
+			klog.V(4).ErrorS(err, ManagerLogPrefix+"pod json.Unmarshal error", "pod", klog.KObj(&podWithOBI.Pod), "node", nodeName, "scoreCR", scoreKey, "podWithOBI", podWithOBI)
+		}
+		return 0, err
+	}
+
+	err = vm.Set("pod", po)
+	if err != nil {
+		if klog.V(5).Enabled() {
+			klog.V(5).ErrorS(err, ManagerLogPrefix+"js vm set pod get err", "pod", klog.KObj(&podWithOBI.Pod), "node", nodeName, "scoreCR", scoreKey, "logic", logic)
+		} else if klog.V(4).Enabled() {
+			klog.V(4).ErrorS(err, ManagerLogPrefix+"js vm set pod get err", "pod", klog.KObj(&podWithOBI.Pod), "node", nodeName, "scoreCR", scoreKey, "logic", logic, "podWithOBI", podWithOBI)
+		}
+		return 0, err
+	}
+	/*
+		try to resolve 'node.Status.Capacity cant import' issue.
+	*/
+	t, err := nodeWithOBI.marshalJSON()
+	if err != nil {
+		if klog.V(5).Enabled() {
+			klog.V(5).ErrorS(err, ManagerLogPrefix+"node json.Marshal error", "pod", klog.KObj(&podWithOBI.Pod), "node", nodeName, "scoreCR", scoreKey)
+		} else if klog.V(4).Enabled() {
+			klog.V(4).ErrorS(err, ManagerLogPrefix+"node json.Marshal error", "pod", klog.KObj(&podWithOBI.Pod), "node", nodeName, "scoreCR", scoreKey, "nodeWithOBI", nodeWithOBI)
+		}
+		return 0, err
+	}
+	var no map[string]interface{}
+	if err = json.Unmarshal(t, &no); err != nil {
+		if klog.V(5).Enabled() {
+			klog.V(5).ErrorS(err, ManagerLogPrefix+"node json.Unmarshal error", "pod", klog.KObj(&podWithOBI.Pod), "node", nodeName, "scoreCR", scoreKey)
+		} else if klog.V(4).Enabled() {
+			klog.V(4).ErrorS(err, ManagerLogPrefix+"node json.Unmarshal error", "pod", klog.KObj(&podWithOBI.Pod), "node", nodeName, "scoreCR", scoreKey, "nodeWithOBI", nodeWithOBI)
+		}
+		return 0, err
+	}
+
+	err = vm.Set("node", no)
+	if err != nil {
+		if klog.V(5).Enabled() {
+			klog.V(5).ErrorS(err, ManagerLogPrefix+"js vm set node get err", "pod", klog.KObj(&podWithOBI.Pod), "node", nodeName, "scoreCR", scoreKey)
+		} else if klog.V(4).Enabled() {
+			klog.V(4).ErrorS(err, ManagerLogPrefix+"js vm set node get err", "pod", klog.KObj(&podWithOBI.Pod), "node", nodeName, "scoreCR", scoreKey, "logic", logic, "node Unmarshal", no)
+		}
+		return 0, err
+	}
+	for name, fn := range map[string]interface{}{"ratio": ratio, "percent": percent, "clampScore": clampScore, "fitScore": fitScore} {
+		if err = vm.Set(name, fn); err != nil {
+			klog.V(4).ErrorS(err, ManagerLogPrefix+"js vm set helper get err", "pod", klog.KObj(&podWithOBI.Pod), "node", nodeName, "scoreCR", scoreKey, "helper", name)
+			return 0, err
+		}
+	}
+	cluster := ctx.Cluster
+	if cluster.Metric == nil {
+		// logic can index cluster.metric without checking.
+		cluster.Metric = map[string]ClusterMetric{}
+	}
+	var co map[string]interface{}
+	if t, err = json.Marshal(cluster); err == nil {
+		err = json.Unmarshal(t, &co)
+	}
+	if err == nil {
+		err = vm.Set("cluster", co)
+	}
+	if err != nil {
+		klog.V(4).ErrorS(err, ManagerLogPrefix+"js vm set cluster get err", "pod", klog.KObj(&podWithOBI.Pod), "node", nodeName, "scoreCR", scoreKey)
+		return 0, err
+	}
+	klog.Infoln(ManagerLogPrefix+"get js val finish", "pod", klog.KObj(&podWithOBI.Pod), "node", nodeName)
+
+	if klog.V(5).Enabled() {
+		if _, err = vm.RunString(DebugLogic); err != nil {
+			klog.ErrorS(err, ManagerLogPrefix+"run debug logic error", "pod", klog.KObj(&podWithOBI.Pod), "node", nodeName, "scoreCR", scoreKey, "debugLogic", DebugLogic)
+		}
+		klog.Infoln(ManagerLogPrefix+"debug logic finish", "pod", klog.KObj(&podWithOBI.Pod), "node", nodeName, "debugLogic", DebugLogic, "scoreCR", scoreKey)
+	}
+
+	if _, err = vm.RunProgram(program); err != nil {
+		if klog.V(4).Enabled() {
+			klog.V(4).ErrorS(err, ManagerLogPrefix+"score js logic is not right", "pod", klog.KObj(&podWithOBI.Pod), "node", nodeName, "scoreCR", scoreKey, "logic", logic, "podWithOBI", podWithOBI, "nodeWithOBI", nodeWithOBI)
+		} else {
+			klog.V(1).ErrorS(err, ManagerLogPrefix+"score js logic is not right", "pod", klog.KObj(&podWithOBI.Pod), "node", nodeName, "scoreCR", scoreKey, "logic", logic)
+		}
+		return 0, err
+	}
+	klog.V(5).Infoln(ManagerLogPrefix+"run js logic finish", "pod", klog.KObj(&podWithOBI.Pod), "node", nodeName, "scoreCR", scoreKey)
+
+	if v := vm.Get("score"); v == nil {
+		if klog.V(4).Enabled() {
+			klog.V(4).ErrorS(ErrNoScoreFunction, ManagerLogPrefix+"should write a function score(){...} in score crd, back to default score logic", "pod", klog.KObj(&podWithOBI.Pod), "node", nodeName, "scoreCR", scoreKey)
+		} else {
+			klog.V(1).ErrorS(ErrNoScoreFunction, ManagerLogPrefix+"should write a function score(){...} in score crd, back to default score logic", "pod", klog.KObj(&podWithOBI.Pod), "node", nodeName, "scoreCR", scoreKey, "logic", logic)
+		}
+		return 0, ErrNoScoreFunction
+	}
+	klog.V(5).Infoln(ManagerLogPrefix+"defined there is a score function in js", "pod", klog.KObj(&podWithOBI.Pod), "node", nodeName, "scoreCR", scoreKey)
+
+	var fn func() float64
+	if err = vm.ExportTo(vm.Get("score"), &fn); err != nil {
+		klog.V(4).ErrorS(err, ManagerLogPrefix+"Score get error result", "pod", klog.KObj(&podWithOBI.Pod), "node", nodeName, "scoreCR", scoreKey, "logic", logic)
+		return 0, err
+	}
+	klog.V(5).InfoS(ManagerLogPrefix+"get score value finish", "pod", klog.KObj(&podWithOBI.Pod), "node", nodeName, "scoreCR", scoreKey)
+
+	defer func() {
+		if r := recover(); r != nil {
+			if interrupted, ok := r.(*goja.InterruptedError); ok {
+				score, err = 0, interrupted
+			}
+			if err, ok := r.(error); ok {
+				if klog.V(4).Enabled() {
+					klog.V(4).ErrorS(err, ManagerLogPrefix+"Score js logic get panic", "pod", klog.KObj(&podWithOBI.Pod), "node", nodeName, "scoreCR", scoreKey, "logic", logic, "podWithOBI", podWithOBI, "nodeWithOBI", nodeWithOBI)
+				} else {
+					klog.V(1).ErrorS(err, ManagerLogPrefix+"Score js logic get panic", "pod", klog.KObj(&podWithOBI.Pod), "node", nodeName, "scoreCR", scoreKey)
+				}
+			} else {
+				if klog.V(4).Enabled() {
+					klog.V(4).ErrorS(fmt.Errorf("get panic:%v", r), ManagerLogPrefix+"Score js logic get panic", "pod", klog.KObj(&podWithOBI.Pod), "node", nodeName, "scoreCR", scoreKey, "logic", logic, "podWithOBI", podWithOBI, "nodeWithOBI", nodeWithOBI)
+				} else {
+					klog.V(1).ErrorS(fmt.Errorf("get panic:%v", r), ManagerLogPrefix+"Score js logic get panic", "pod", klog.KObj(&podWithOBI.Pod), "node", nodeName, "scoreCR", scoreKey)
+				}
+			}
+		}
+	}()
+	score = fn()
+	klog.V(5).InfoS(ManagerLogPrefix+"all finish", "pod", klog.KObj(&podWithOBI.Pod), "node", nodeName, "scoreCR", scoreKey, "score", score)
+	return score, nil
+}
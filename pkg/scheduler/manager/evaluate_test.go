@@ -0,0 +1,359 @@
+/*
+Copyright 2022 The Arbiter Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manager
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	schedv1alpha1 "github.com/kube-arbiter/arbiter/pkg/apis/v1alpha1"
+)
+
+func TestEvaluateLogicWithPodAndNodeOBI(t *testing.T) {
+	mgr := newTestManager(t)
+	mgr.ObservabilityIndicantAdd(newPodOBI("pod-mem", "ns1", "pod1", map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo{
+		"mem": {{Records: newRecords("20", "40")}},
+	}))
+	mgr.ObservabilityIndicantAdd(newNodeOBI("node-mem", "node1", map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo{
+		"mem": {{Records: newRecords("50", "70")}},
+	}))
+	pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "ns1", Name: "pod1"}}
+	node := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}}
+	podOBI, err := mgr.GetPodOBI(context.Background(), pod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nodeOBI, err := mgr.GetNodeOBI(context.Background(), node.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logic := `function score() {
+    var podMem = pod.obi["default-pod-mem"].metric.mem.avg;
+    var nodeMem = node.obi["default-node-mem"].metric.mem.avg;
+    if (pod.raw.metadata.name != "pod1" || node.raw.metadata.name != "node1") {
+        return 0;
+    }
+    return 100 - nodeMem - podMem;
+}`
+	score, err := EvaluateLogic(logic, "ns1/score", &PodWithOBI{Pod: *pod, OBI: podOBI}, &NodeWithOBI{Node: *node, OBI: nodeOBI})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 100 - 60 - 30
+	if score != 10 {
+		t.Fatalf("expect score 10 get %d", score)
+	}
+
+	for _, tc := range []struct {
+		name  string
+		logic string
+	}{
+		{name: "syntax error", logic: "function score( {"},
+		{name: "no score function", logic: "var a = 1;"},
+		{name: "out of range", logic: "function score() { return 101; }"},
+	} {
+		if _, err := EvaluateLogic(tc.logic, "ns1/score", &PodWithOBI{Pod: *pod}, &NodeWithOBI{Node: *node}); err == nil {
+			t.Fatalf("%s: expect error", tc.name)
+		}
+	}
+}
+
+func TestEvaluateLogicRatio(t *testing.T) {
+	mgr := newTestManager(t)
+	newNode := func(name string) *v1.Node {
+		return &v1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Status: v1.NodeStatus{
+				Capacity:    v1.ResourceList{v1.ResourceCPU: resource.MustParse("4"), v1.ResourceMemory: resource.MustParse("8Gi")},
+				Allocatable: v1.ResourceList{v1.ResourceCPU: resource.MustParse("3500m"), v1.ResourceMemory: resource.MustParse("6Gi")},
+			},
+		}
+	}
+	for node, cpu := range map[string][]string{"busy": {"3000", "3800"}, "idle": {"800", "1200"}} {
+		mgr.ObservabilityIndicantAdd(newNodeOBI("cpu", node, map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo{
+			"cpu": {{Unit: "m", Records: newRecords(cpu...)}},
+		}))
+	}
+	// score 0 if cpu avg > 80% of capacity, otherwise the free percentage.
+	logic := `function score() {
+    var used = percent(node.metric.cpu.avg, node.capacity.cpu);
+    if (used > 80) {
+        return 0;
+    }
+    return clampScore(100 - used + ratio(1, 0));
+}`
+	for node, exp := range map[string]int64{"busy": 0, "idle": 75} {
+		obi, err := mgr.GetNodeOBI(context.Background(), node)
+		if err != nil {
+			t.Fatal(err)
+		}
+		score, err := EvaluateLogic(logic, "ns1/ratio", &PodWithOBI{}, NewNodeWithOBI(newNode(node), obi))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if score != exp {
+			t.Fatalf("expect score of %s %d get %d", node, exp, score)
+		}
+	}
+
+	nodeWithOBI := NewNodeWithOBI(newNode("busy"), nil)
+	if exp := map[string]float64{"cpu": 3500, "memory": 6 << 30}; !reflect.DeepEqual(exp, nodeWithOBI.Allocatable) {
+		t.Fatalf("expect allocatable %v get %v", exp, nodeWithOBI.Allocatable)
+	}
+	if c := NewNodeWithOBI(&v1.Node{}, nil).Capacity; c == nil {
+		t.Fatalf("expect capacity never nil")
+	}
+	if v := clampScore(120); v != 100 {
+		t.Fatalf("expect clamped to 100 get %v", v)
+	}
+}
+
+func TestEvaluateLogicBestFit(t *testing.T) {
+	mgr := newTestManager(t)
+	// 4 cores allocatable, free cpu of 1500m, 200m and 3500m.
+	for node, cpu := range map[string]string{"tight": "2500", "full": "3800", "roomy": "500"} {
+		mgr.ObservabilityIndicantAdd(newNodeOBI("cpu", node, map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo{
+			"cpu": {{Unit: "m", Records: newRecords(cpu)}},
+		}))
+	}
+	cpu := func(q string) v1.ResourceRequirements {
+		return v1.ResourceRequirements{Requests: v1.ResourceList{v1.ResourceCPU: resource.MustParse(q)}}
+	}
+	pod := &v1.Pod{Spec: v1.PodSpec{
+		Containers:     []v1.Container{{Resources: cpu("500m")}, {Resources: cpu("500m")}},
+		InitContainers: []v1.Container{{Resources: cpu("300m")}},
+	}}
+	logic := "function score() { return fitScore(pod.requests.cpu, node.allocatable.cpu - node.metric.cpu.avg); }"
+
+	for _, tc := range []struct {
+		name string
+		pod  *v1.Pod
+		exp  map[string]int64
+	}{
+		// 1000m requested, the node left with the least free cpu wins, and full can not fit it.
+		{name: "requests", pod: pod, exp: map[string]int64{"tight": 66, "roomy": 28, "full": 0}},
+		{name: "no requests", pod: &v1.Pod{}, exp: map[string]int64{"tight": NeutralNodeScore, "roomy": NeutralNodeScore, "full": NeutralNodeScore}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			get := make(map[string]int64, len(tc.exp))
+			for node := range tc.exp {
+				obi, err := mgr.GetNodeOBI(context.Background(), node)
+				if err != nil {
+					t.Fatal(err)
+				}
+				n := &v1.Node{
+					ObjectMeta: metav1.ObjectMeta{Name: node},
+					Status:     v1.NodeStatus{Allocatable: v1.ResourceList{v1.ResourceCPU: resource.MustParse("4")}},
+				}
+				if get[node], err = EvaluateLogic(logic, "ns1/best-fit", NewPodWithOBI(tc.pod, nil), NewNodeWithOBI(n, obi)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if !reflect.DeepEqual(tc.exp, get) {
+				t.Fatalf("expect %v get %v", tc.exp, get)
+			}
+		})
+	}
+
+	pod.Spec.InitContainers[0].Resources = cpu("1500m")
+	pod.Spec.Overhead = v1.ResourceList{v1.ResourceCPU: resource.MustParse("100m")}
+	if exp, get := map[string]float64{"cpu": 1600}, podRequests(pod); !reflect.DeepEqual(exp, get) {
+		t.Fatalf("expect the init container request plus overhead %v get %v", exp, get)
+	}
+}
+
+func TestEvaluateScore(t *testing.T) {
+	obi := map[string]OBI{
+		"default-cpu": {Metric: map[string]FullMetrics{"cpu": {Avg: 30, Max: 60}}},
+		"default-mem": {Metric: map[string]FullMetrics{"mem": {Avg: 80}}},
+	}
+	for _, tc := range []struct {
+		name   string
+		logic  string
+		expErr bool
+		exp    int64
+	}{
+		{name: "obi", logic: `function score() { return 100 - node.obi["default-cpu"].metric.cpu.max; }`, exp: 40},
+		{name: "merged metric", logic: "function score() { return (node.metric.cpu.avg + node.metric.mem.avg) / 2; }", exp: 55},
+		{name: "out of range", logic: "function score() { return node.metric.mem.avg * 2; }", expErr: true},
+		{name: "bad logic", logic: "function score( { return 1; }", expErr: true},
+		{name: "no score function", logic: "var a = 1;", expErr: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			score, err := EvaluateScore(schedv1alpha1.ScoreSpec{Weight: 1, Logic: tc.logic}, obi)
+			if tc.expErr {
+				if err == nil {
+					t.Fatalf("expect error get score %d", score)
+				}
+				return
+			}
+			if err != nil || score != tc.exp {
+				t.Fatalf("expect score %d get %d %v", tc.exp, score, err)
+			}
+		})
+	}
+}
+
+func TestScoreUpdateRecompile(t *testing.T) {
+	mgr := newTestManager(t, WithNamespaceFallback(false))
+	pod := &PodWithOBI{Pod: v1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "ns1", Name: "pod1"}}}
+	node := &NodeWithOBI{Node: v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}}}
+	getScore := func() ScoreResult {
+		res, _ := mgr.GetScore(context.Background(), "ns1")
+		if len(res) != 1 || res[0].Program == nil {
+			t.Fatalf("expect one compiled score get %v", res)
+		}
+		return res[0]
+	}
+
+	mgr.ScoreAdd(newScore("ns1", "score1", 1, "function score(){return 1}"))
+	old := getScore()
+	mgr.ScoreUpdate(nil, newScore("ns1", "score1", 1, "function score(){return 2}"))
+	updated := getScore()
+	if old.Program == updated.Program {
+		t.Fatalf("expect logic recompiled on update")
+	}
+	score, err := EvaluateScoreResult(updated, pod, node)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if score != 2 {
+		t.Fatalf("expect score 2 get %d", score)
+	}
+}
+
+// numberEvaluator is a ScoreEvaluator whose logic is the score itself.
+type numberEvaluator struct{}
+
+func (numberEvaluator) Compile(logic string) (Program, error) {
+	return strconv.ParseFloat(logic, 64)
+}
+
+func (numberEvaluator) Eval(program Program, ctx ScoreContext) (float64, error) {
+	return program.(float64), nil
+}
+
+func TestScoreEvaluator(t *testing.T) {
+	mgr := newTestManager(t, WithNamespaceFallback(false), WithScoreEvaluator("number", numberEvaluator{}))
+	js := newScore("ns1", "js", 1, "function score(){return 10}")
+	number := newScore("ns1", "number", 1, "20")
+	number.Annotations = map[string]string{ScoreEvaluatorAnnotation: "number"}
+	invalidNumber := newScore("ns1", "invalid-number", 1, "function score(){return 30}")
+	invalidNumber.Annotations = map[string]string{ScoreEvaluatorAnnotation: "number"}
+	unknown := newScore("ns1", "unknown", 1, "function score(){return 40}")
+	unknown.Annotations = map[string]string{ScoreEvaluatorAnnotation: "cel"}
+	for _, score := range []*schedv1alpha1.Score{js, number, invalidNumber, unknown} {
+		mgr.ScoreAdd(score)
+	}
+
+	pod := &PodWithOBI{Pod: v1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "ns1", Name: "pod1"}}}
+	node := &NodeWithOBI{Node: v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}}}
+	res, _ := mgr.GetScore(context.Background(), "ns1")
+	get := make(map[string]int64, len(res))
+	for _, r := range res {
+		score, err := EvaluateScoreResult(r, pod, node)
+		if err != nil {
+			t.Fatalf("%s: %v", r.NameKey, err)
+		}
+		get[r.NameKey] = score
+	}
+	if exp := map[string]int64{"ns1/js": 10, "ns1/number": 20}; !reflect.DeepEqual(exp, get) {
+		t.Fatalf("expect %v get %v", exp, get)
+	}
+	if err := mgr.GetScoreError("ns1", "invalid-number"); err == nil {
+		t.Fatalf("expect number evaluator fails to compile javascript")
+	}
+	if err := mgr.GetScoreError("ns1", "unknown"); !errors.Is(err, ErrUnknownScoreEvaluator) {
+		t.Fatalf("expect %v get %v", ErrUnknownScoreEvaluator, err)
+	}
+}
+
+func TestScoreTimeout(t *testing.T) {
+	mgr := newTestManager(t, WithNamespaceFallback(false), WithScoreTimeout(50*time.Millisecond))
+	loopInScore := newScore("ns1", "loop-in-score", 1, "function score(){ while(true){} }")
+	loopInScore.Annotations = map[string]string{ScoreTimeoutAnnotation: "20ms"}
+	loopAtTop := newScore("ns1", "loop-at-top", 1, "while(true){} function score(){return 10}")
+	invalidTimeout := newScore("ns1", "invalid-timeout", 1, "function score(){return 20}")
+	invalidTimeout.Annotations = map[string]string{ScoreTimeoutAnnotation: "soon"}
+	for _, score := range []*schedv1alpha1.Score{loopInScore, loopAtTop, invalidTimeout, newScore("ns1", "fast", 1, "function score(){return 30}")} {
+		mgr.ScoreAdd(score)
+	}
+	if _, ok := mgr.invalidScores["ns1/invalid-timeout"]; !ok {
+		t.Fatalf("expect Score with invalid timeout annotation is invalid, get %v", mgr.invalidScores)
+	}
+
+	pod := &PodWithOBI{Pod: v1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "ns1", Name: "pod1"}}}
+	node := &NodeWithOBI{Node: v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}}}
+	scores, _ := mgr.GetScore(context.Background(), "ns1")
+	timeouts := map[string]time.Duration{"ns1/loop-in-score": 20 * time.Millisecond, "ns1/loop-at-top": 50 * time.Millisecond, "ns1/fast": 50 * time.Millisecond}
+	got := make(map[string]int64, len(scores))
+	start := time.Now()
+	for _, score := range scores {
+		if score.Timeout != timeouts[score.NameKey] {
+			t.Fatalf("expect timeout of %s %v get %v", score.NameKey, timeouts[score.NameKey], score.Timeout)
+		}
+		result, err := EvaluateScoreResult(score, pod, node)
+		if score.NameKey == "ns1/fast" {
+			if err != nil {
+				t.Fatalf("expect fast Score evaluated get %v", err)
+			}
+		} else if !errors.Is(err, ErrScoreTimeout) {
+			t.Fatalf("expect %s aborted with ErrScoreTimeout get %v", score.NameKey, err)
+		}
+		got[score.NameKey] = result
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("expect aborted evaluations return soon, took %v", elapsed)
+	}
+	if exp := map[string]int64{"ns1/loop-in-score": 0, "ns1/loop-at-top": 0, "ns1/fast": 30}; !reflect.DeepEqual(exp, got) {
+		t.Fatalf("expect results %v get %v", exp, got)
+	}
+}
+
+func benchmarkEvaluate(b *testing.B, precompiled bool) {
+	score := ScoreResult{
+		NameKey:   "ns1/score1",
+		ScoreSpec: schedv1alpha1.ScoreSpec{Weight: 1, Logic: "function score() { var s = 0; for (var i = 0; i < 10; i++) { s += i; } return s; }"},
+	}
+	if precompiled {
+		program, err := JavaScriptEvaluator{}.Compile(score.Logic)
+		if err != nil {
+			b.Fatal(err)
+		}
+		score.Evaluator, score.Program = JavaScriptEvaluator{}, program
+	}
+	pod := &PodWithOBI{Pod: v1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "ns1", Name: "pod1"}}}
+	node := &NodeWithOBI{Node: v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}}}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := EvaluateScoreResult(score, pod, node); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkEvaluateCompileEveryTime(b *testing.B) { benchmarkEvaluate(b, false) }
+
+func BenchmarkEvaluatePrecompiled(b *testing.B) { benchmarkEvaluate(b, true) }
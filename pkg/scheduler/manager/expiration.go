@@ -0,0 +1,105 @@
+/*
+Copyright 2022 The Arbiter Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manager
+
+import (
+	"time"
+
+	gocache "github.com/patrickmn/go-cache"
+)
+
+// cachedOBI is the value of node and pod metric caches. Each metric type of the OBI expires on its own,
+// so that a slowly changing metric can be kept longer than the others, see WithMetricTypeTTL.
+// The cache item itself expires along with the last metric type.
+type cachedOBI struct {
+	metric map[string]FullMetrics
+	// expiration is the UnixNano time each metric type expires keyed by metric type, no entry means never.
+	expiration map[string]int64
+}
+
+// unexpired returns an OBI of the metric types not expired at now in UnixNano.
+// It returns false if all metric types are expired.
+func (c cachedOBI) unexpired(now int64) (OBI, bool) {
+	data := OBI{Metric: make(map[string]FullMetrics, len(c.metric))}
+	for metricType, m := range c.metric {
+		if c.expired(metricType, now) {
+			continue
+		}
+		data.Metric[metricType] = m
+	}
+	return data, len(data.Metric) != 0 || len(c.metric) == 0
+}
+
+// view is the same as unexpired, but the cached metrics are returned as is if no metric type is expired at now,
+// so they must not be modified nor retained after the read lock of the manager is released, see viewNodeOBI.
+func (c cachedOBI) view(now int64) (OBI, bool) {
+	for metricType := range c.expiration {
+		if c.expired(metricType, now) {
+			return c.unexpired(now)
+		}
+	}
+	return OBI{Metric: c.metric}, true
+}
+
+func (c cachedOBI) expired(metricType string, now int64) bool {
+	exp, ok := c.expiration[metricType]
+	return ok && now > exp
+}
+
+// ttl returns how long the cache item should be kept, that is until the last metric type expires.
+func (c cachedOBI) ttl(now int64) time.Duration {
+	if len(c.metric) == 0 {
+		return gocache.NoExpiration
+	}
+	var last int64
+	for metricType := range c.metric {
+		exp, ok := c.expiration[metricType]
+		if !ok {
+			return gocache.NoExpiration
+		}
+		if exp > last {
+			last = exp
+		}
+	}
+	// zero is the default expiration of gocache, keep the item at least one nanosecond.
+	if last <= now {
+		return time.Nanosecond
+	}
+	return time.Duration(last - now)
+}
+
+// metricExpiration returns the UnixNano time metricType updated at now expires, false if it never expires.
+// The ttl set by WithMetricTypeTTL takes precedence over the one by WithMetricTTL.
+func (mgr *manager) metricExpiration(metricType string, now int64) (int64, bool) {
+	ttl, ok := mgr.metricTypeTTL[metricType]
+	if !ok {
+		ttl = mgr.metricTTL
+	}
+	if ttl <= 0 {
+		return 0, false
+	}
+	return now + int64(ttl), true
+}
+
+// setMetricExpiration sets the expiration of metricType in data updated at now, see metricExpiration.
+func (mgr *manager) setMetricExpiration(data cachedOBI, metricType string, now int64) {
+	if exp, ok := mgr.metricExpiration(metricType, now); ok {
+		data.expiration[metricType] = exp
+	} else {
+		delete(data.expiration, metricType)
+	}
+}
@@ -0,0 +1,109 @@
+/*
+Copyright 2022 The Arbiter Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manager
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	gocache "github.com/patrickmn/go-cache"
+
+	schedv1alpha1 "github.com/kube-arbiter/arbiter/pkg/apis/v1alpha1"
+)
+
+func TestMetricTypeTTL(t *testing.T) {
+	mgr := newTestManager(t, WithMetricTypeTTL(map[string]time.Duration{"cpu": 50 * time.Millisecond, "disk": time.Hour}),
+		WithMetricTTL(300*time.Millisecond, gocache.NoExpiration))
+	ctx := context.Background()
+	obi := newNodeOBI("obi", "node1", map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo{
+		"cpu":  {{Records: newRecords("1")}},
+		"disk": {{Records: newRecords("2")}},
+		"mem":  {{Records: newRecords("3")}},
+	})
+	mgr.ObservabilityIndicantAdd(obi)
+	if metrics, err := mgr.GetNodeMetrics(ctx, "node1"); err != nil || len(metrics) != 3 {
+		t.Fatalf("expect cpu, disk and mem before expired get %v %v", metrics, err)
+	}
+
+	// cpu expires by its own ttl, mem by WithMetricTTL, and disk is kept.
+	time.Sleep(100 * time.Millisecond)
+	if _, err := mgr.GetNodeMetric(ctx, "node1", "cpu"); !errors.Is(err, ErrNotFoundInCache) {
+		t.Fatalf("expect cpu expired get %v", err)
+	}
+	data, err := mgr.GetNodeOBI(ctx, "node1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m := data[getMetricCacheKey(obi)].Metric; len(m) != 2 || m["disk"].Avg != 2 || m["mem"].Avg != 3 {
+		t.Fatalf("expect only disk and mem left get %+v", m)
+	}
+	time.Sleep(250 * time.Millisecond)
+	if metrics, err := mgr.GetNodeMetrics(ctx, "node1"); err != nil || len(metrics) != 1 || metrics["disk"].Avg != 2 {
+		t.Fatalf("expect only disk left get %v %v", metrics, err)
+	}
+
+	// cpu is cached again by the update, disk keeps its expiration.
+	mgr.ObservabilityIndicantAdd(newNodeOBI("obi", "node1", map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo{
+		"cpu": {{Records: newRecords("5")}},
+	}))
+	if metrics, err := mgr.GetNodeMetrics(ctx, "node1"); err != nil || len(metrics) != 2 || metrics["cpu"].Avg != 5 {
+		t.Fatalf("expect updated cpu and disk get %v %v", metrics, err)
+	}
+}
+
+func TestCachedOBITTL(t *testing.T) {
+	now := time.Now().UnixNano()
+	for _, tc := range []struct {
+		name string
+		obi  cachedOBI
+		exp  time.Duration
+	}{
+		{name: "empty", obi: cachedOBI{}, exp: gocache.NoExpiration},
+		{
+			name: "last expiration",
+			obi: cachedOBI{
+				metric:     map[string]FullMetrics{"cpu": {}, "disk": {}},
+				expiration: map[string]int64{"cpu": now + int64(time.Minute), "disk": now + int64(time.Hour)},
+			},
+			exp: time.Hour,
+		},
+		{
+			name: "never expire",
+			obi: cachedOBI{
+				metric:     map[string]FullMetrics{"cpu": {}, "disk": {}},
+				expiration: map[string]int64{"cpu": now + int64(time.Minute)},
+			},
+			exp: gocache.NoExpiration,
+		},
+		{
+			name: "all expired",
+			obi: cachedOBI{
+				metric:     map[string]FullMetrics{"cpu": {}},
+				expiration: map[string]int64{"cpu": now - 1},
+			},
+			exp: time.Nanosecond,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if ttl := tc.obi.ttl(now); ttl != tc.exp {
+				t.Fatalf("expect ttl %v get %v", tc.exp, ttl)
+			}
+		})
+	}
+}
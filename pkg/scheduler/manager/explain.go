@@ -0,0 +1,72 @@
+/*
+Copyright 2022 The Arbiter Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manager
+
+import (
+	"context"
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ScoreContribution explains how one Score contributes to the weighted scores of two nodes, see ExplainScoreDelta.
+type ScoreContribution struct {
+	NameKey string
+	Weight  int64
+	// ResultA and ResultB are the raw results of the Score on each node, ErrA and ErrB are why a result is 0.
+	ResultA, ResultB int64
+	ErrA, ErrB       error
+	// ContributionA and ContributionB are the parts of the weighted score of each node from the Score,
+	// that is Result*Weight/totalWeight, see WeightedScore.
+	ContributionA, ContributionB float64
+	// Delta is ContributionA - ContributionB, a positive one means the Score prefers node A.
+	Delta float64
+}
+
+// ExplainScoreDelta evaluates each Score of namespace against the cached OBI of nodeA and nodeB the same way as
+// PreviewScores, and explains why one node gets a higher weighted score than the other.
+// The sum of Delta is the difference of the weighted scores before they are truncated and clamped by WeightedScore.
+// The pod is empty, so the logic reading pod.obi or pod.metric gets nothing, and the Score are selected and
+// weighted for a pod without labels, see GetScoreForPod.
+func (mgr *manager) ExplainScoreDelta(ctx context.Context, namespace, nodeA, nodeB string) ([]ScoreContribution, error) {
+	podWithOBI := &PodWithOBI{Pod: v1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: namespace}}}
+	scores, totalWeight, _ := mgr.GetScoreForPod(ctx, &podWithOBI.Pod)
+	if totalWeight <= 0 {
+		return nil, fmt.Errorf("no valid Score for namespace %s", namespace)
+	}
+	cluster := mgr.ClusterMetrics(ctx)
+	a, err := mgr.nodeWithOBI(ctx, nodeA)
+	if err != nil {
+		return nil, err
+	}
+	b, err := mgr.nodeWithOBI(ctx, nodeB)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]ScoreContribution, 0, len(scores))
+	for _, score := range scores {
+		c := ScoreContribution{NameKey: score.NameKey, Weight: score.Weight}
+		c.ResultA, c.ErrA = EvaluateScoreResultInCluster(score, podWithOBI, a, cluster)
+		c.ResultB, c.ErrB = EvaluateScoreResultInCluster(score, podWithOBI, b, cluster)
+		c.ContributionA = float64(c.ResultA*score.Weight) / float64(totalWeight)
+		c.ContributionB = float64(c.ResultB*score.Weight) / float64(totalWeight)
+		c.Delta = c.ContributionA - c.ContributionB
+		res = append(res, c)
+	}
+	return res, nil
+}
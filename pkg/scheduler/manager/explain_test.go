@@ -0,0 +1,97 @@
+/*
+Copyright 2022 The Arbiter Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manager
+
+import (
+	"context"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+
+	schedv1alpha1 "github.com/kube-arbiter/arbiter/pkg/apis/v1alpha1"
+	"github.com/kube-arbiter/arbiter/pkg/generated/clientset/versioned/fake"
+)
+
+func TestExplainScoreDelta(t *testing.T) {
+	factory := informers.NewSharedInformerFactory(kubefake.NewSimpleClientset(), 0)
+	for _, name := range []string{"node1", "node2"} {
+		if err := factory.Core().V1().Nodes().Informer().GetIndexer().Add(&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: name}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mgr := NewManager(fake.NewSimpleClientset(), nil, factory.Core().V1().Pods(), factory.Core().V1().Nodes())
+	for node, cpu := range map[string]string{"node1": "20", "node2": "60"} {
+		mgr.ObservabilityIndicantAdd(newNodeOBI("cpu", node, map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo{
+			"cpu": {{Records: newRecords(cpu)}},
+		}))
+	}
+	mgr.ScoreAdd(newScore("ns1", "least-cpu", 3, `function score() { return 100 - node.metric.cpu.avg; }`))
+	mgr.ScoreAdd(newScore("ns1", "most-cpu", 1, `function score() { return node.metric.cpu.avg; }`))
+	// neither the Score selecting other pods nor the one of zero default weight explains the empty pod.
+	gpu := newScore("ns1", "gpu", 5, `function score() { return 100; }`)
+	gpu.Annotations = map[string]string{PodSelectorAnnotation: "accelerator=nvidia"}
+	mgr.ScoreAdd(gpu)
+	batch := newScore("ns1", "batch", 0, `function score() { return 100; }`)
+	batch.Spec.ProfileWeights = map[string]int64{"batch": 2}
+	mgr.ScoreAdd(batch)
+
+	res, err := mgr.ExplainScoreDelta(context.Background(), "ns1", "node1", "node2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := map[string]ScoreContribution{
+		// 3*80/4 and 3*40/4
+		"ns1/least-cpu": {NameKey: "ns1/least-cpu", Weight: 3, ResultA: 80, ResultB: 40, ContributionA: 60, ContributionB: 30, Delta: 30},
+		// 1*20/4 and 1*60/4
+		"ns1/most-cpu": {NameKey: "ns1/most-cpu", Weight: 1, ResultA: 20, ResultB: 60, ContributionA: 5, ContributionB: 15, Delta: -10},
+	}
+	if len(res) != len(exp) {
+		t.Fatalf("expect contribution of %d Score get %+v", len(exp), res)
+	}
+	var delta float64
+	for _, c := range res {
+		if c != exp[c.NameKey] {
+			t.Fatalf("expect %+v get %+v", exp[c.NameKey], c)
+		}
+		delta += c.Delta
+	}
+	// the weighted scores are 65 and 45.
+	if delta != 20 {
+		t.Fatalf("expect delta 20 get %v", delta)
+	}
+	preview, err := mgr.PreviewScores(context.Background(), &v1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "ns1"}}, []string{"node1", "node2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	weighted := make(map[string]int64)
+	for _, r := range preview {
+		weighted[r.NodeName] = r.Result
+	}
+	if float64(weighted["node1"]-weighted["node2"]) != delta {
+		t.Fatalf("expect delta %v the same as the preview %v", delta, weighted)
+	}
+
+	if _, err := mgr.ExplainScoreDelta(context.Background(), "ns1", "node1", "unknown"); err == nil {
+		t.Fatalf("expect error of unknown node")
+	}
+	if _, err := mgr.ExplainScoreDelta(context.Background(), "ns2", "node1", "node2"); err == nil {
+		t.Fatalf("expect error without any Score")
+	}
+}
@@ -0,0 +1,113 @@
+/*
+Copyright 2022 The Arbiter Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manager
+
+import (
+	"context"
+	"math"
+	"sort"
+	"time"
+
+	"k8s.io/klog/v2"
+)
+
+// FlapPolicy detects a metric type flapping, e.g. a broken exporter alternating huge and zero values,
+// which would make the scheduler thrash between nodes, see WithFlapDetection.
+type FlapPolicy struct {
+	// Window is how far before the newest record the values are checked, all records are checked if it is not positive.
+	Window time.Duration
+	// Threshold is the number of direction reversals of the values in Window which makes the metric flapping.
+	Threshold int
+	// MinChange is the smallest change between two values in the canonical unit that counts,
+	// smaller changes are noise and neither reverse the direction nor break a reversal.
+	MinChange float64
+}
+
+// countFlaps returns the number of direction reversals of samples in the window of policy,
+// samples are sorted by timestamp.
+func countFlaps(samples []sample, policy FlapPolicy) int {
+	if len(samples) == 0 {
+		return 0
+	}
+	start := 0
+	if policy.Window > 0 {
+		from := samples[len(samples)-1].Timestamp - policy.Window.Milliseconds()
+		start = sort.Search(len(samples), func(i int) bool { return samples[i].Timestamp >= from })
+	}
+	flaps, direction := 0, 0.0
+	last := samples[start].Value
+	for _, s := range samples[start+1:] {
+		delta := s.Value - last
+		if math.Abs(delta) < policy.MinChange || delta == 0 {
+			continue
+		}
+		if direction != 0 && math.Signbit(delta) != math.Signbit(direction) {
+			flaps++
+		}
+		direction, last = delta, s.Value
+	}
+	return flaps
+}
+
+// freezeFlapping marks m of metricType frozen if it flaps by the FlapPolicy of metricType, see WithFlapDetection.
+// The aggregations of a frozen metric are held at prev, the last ones before flapping, so the scoring
+// contribution of it does not change until it is stable again. It returns false if m is flapping without
+// such a value, m should not be used in that case.
+func (mgr *manager) freezeFlapping(logger klog.Logger, metricType string, prev FullMetrics, hasPrev bool, m *FullMetrics) bool {
+	policy, ok := mgr.flapPolicies[metricType]
+	if !ok || policy.Threshold <= 0 || m.Flaps < policy.Threshold {
+		if ok && prev.Frozen {
+			logger.V(2).Info(ManagerLogPrefix+"metric is stable again, unfreeze it", "metricType", metricType, "flaps", m.Flaps)
+		}
+		return true
+	}
+	if !hasPrev || prev.Count == 0 {
+		logger.V(2).Info(ManagerLogPrefix+"skip flapping metric without a stable value", "metricType", metricType, "flaps", m.Flaps, "threshold", policy.Threshold)
+		return false
+	}
+	if !prev.Frozen {
+		logger.V(2).Info(ManagerLogPrefix+"metric is flapping, freeze it", "metricType", metricType, "flaps", m.Flaps, "threshold", policy.Threshold)
+	}
+	flaps := m.Flaps
+	*m = prev
+	m.Flaps, m.Frozen = flaps, true
+	return true
+}
+
+// FrozenMetrics returns the metric types of the node frozen for flapping sorted by name, see WithFlapDetection.
+func (mgr *manager) FrozenMetrics(ctx context.Context, nodeName string) ([]string, error) {
+	mgr.RLock()
+	defer mgr.RUnlock()
+	obi, err := mgr.getNodeOBILocked(ctx, nodeName)
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]struct{})
+	for _, o := range obi {
+		for metricType, m := range o.Metric {
+			if m.Frozen {
+				seen[metricType] = struct{}{}
+			}
+		}
+	}
+	frozen := make([]string, 0, len(seen))
+	for metricType := range seen {
+		frozen = append(frozen, metricType)
+	}
+	sort.Strings(frozen)
+	return frozen, nil
+}
@@ -0,0 +1,110 @@
+/*
+Copyright 2022 The Arbiter Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manager
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	schedv1alpha1 "github.com/kube-arbiter/arbiter/pkg/apis/v1alpha1"
+)
+
+func TestCountFlaps(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		values []float64
+		policy FlapPolicy
+		exp    int
+	}{
+		{name: "steady rise", values: []float64{1, 2, 3, 4}, exp: 0},
+		{name: "oscillating", values: []float64{0, 100, 0, 100, 0}, exp: 3},
+		{name: "noise below min change", values: []float64{50, 51, 50, 51, 90}, policy: FlapPolicy{MinChange: 5}, exp: 0},
+		{name: "equal values do not break reversal", values: []float64{0, 100, 100, 0}, exp: 1},
+		// records are one minute apart, a 2m window checks only the newest 3 values.
+		{name: "window", values: []float64{0, 100, 0, 100, 100, 100}, policy: FlapPolicy{Window: 2 * time.Minute}, exp: 0},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			samples := make([]sample, 0, len(tc.values))
+			for i, v := range tc.values {
+				samples = append(samples, sample{Timestamp: int64(i+1) * 60000, Value: v})
+			}
+			if got := countFlaps(samples, tc.policy); got != tc.exp {
+				t.Fatalf("expect %d flaps get %d", tc.exp, got)
+			}
+		})
+	}
+}
+
+func TestFlapDetection(t *testing.T) {
+	mgr := newTestManager(t, WithFlapDetection(map[string]FlapPolicy{"cpu": {Window: 10 * time.Minute, Threshold: 3, MinChange: 10}}))
+	add := func(values ...string) FullMetrics {
+		obi := newNodeOBI("cpu", "node1", map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo{
+			"cpu": {{Records: newRecords(values...)}},
+		})
+		mgr.ObservabilityIndicantAdd(obi)
+		return getNodeMetric(t, mgr, obi, "node1", "cpu")
+	}
+	frozen := func() []string {
+		t.Helper()
+		res, err := mgr.FrozenMetrics(context.Background(), "node1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+
+	if m := add("40", "42", "41"); m.Frozen || m.Avg != 41 {
+		t.Fatalf("expect a stable metric not frozen get %+v", m)
+	}
+	m := add("0", "100", "0", "100", "0", "100")
+	if !m.Frozen || m.Flaps != 4 {
+		t.Fatalf("expect an oscillating metric frozen get %+v", m)
+	}
+	if m.Avg != 41 || m.Count != 3 {
+		t.Fatalf("expect the frozen metric held at the stable value get %+v", m)
+	}
+	if exp := []string{"cpu"}; !reflect.DeepEqual(exp, frozen()) {
+		t.Fatalf("expect frozen metrics %v get %v", exp, frozen())
+	}
+	// still flapping, it is held at the same stable value.
+	if m := add("100", "0", "100", "0", "100"); !m.Frozen || m.Avg != 41 {
+		t.Fatalf("expect the metric still frozen get %+v", m)
+	}
+
+	if m := add("60", "61", "62"); m.Frozen || m.Avg != 61 {
+		t.Fatalf("expect a stable metric unfrozen get %+v", m)
+	}
+	if res := frozen(); len(res) != 0 {
+		t.Fatalf("expect no frozen metric get %v", res)
+	}
+}
+
+func TestFlapDetectionWithoutStableValue(t *testing.T) {
+	mgr := newTestManager(t, WithFlapDetection(map[string]FlapPolicy{"cpu": {Threshold: 2}}))
+	mgr.ObservabilityIndicantAdd(newNodeOBI("cpu", "node1", map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo{
+		"cpu": {{Records: newRecords("0", "100", "0", "100")}},
+		"mem": {{Records: newRecords("0", "100", "0", "100")}},
+	}))
+	if _, err := mgr.GetNodeMetric(context.Background(), "node1", "cpu"); err == nil {
+		t.Fatalf("expect a flapping metric without a stable value not cached")
+	}
+	if m, err := mgr.GetNodeMetric(context.Background(), "node1", "mem"); err != nil || m.Frozen {
+		t.Fatalf("expect metric without FlapPolicy not frozen get %+v %v", m, err)
+	}
+}
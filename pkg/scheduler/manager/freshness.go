@@ -0,0 +1,70 @@
+/*
+Copyright 2022 The Arbiter Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manager
+
+import (
+	"time"
+
+	schedv1alpha1 "github.com/kube-arbiter/arbiter/pkg/apis/v1alpha1"
+)
+
+// IsMetricDataFresh returns true if any cached node has a metric newer than maxAge, the age of a metric is
+// the same as GetNodeOBIWithAge. It returns false if there is no node metric at all, which means the
+// metric pipeline is broken cluster-wide and the scheduler should be reported degraded.
+func (mgr *manager) IsMetricDataFresh(maxAge time.Duration) bool {
+	mgr.RLock()
+	defer mgr.RUnlock()
+	now := time.Now()
+	for _, nodeCache := range mgr.nodeMetric {
+		for _, item := range nodeCache.Items() {
+			cached, ok := item.Object.(cachedOBI)
+			if !ok {
+				continue
+			}
+			data, _ := cached.unexpired(now.UnixNano())
+			for _, m := range data.Metric {
+				if metricAge(m, now) <= maxAge {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// isStale returns the time of the newest record of obi, and whether it is older than the stale threshold at now.
+// The obi without any record is never stale, see WithStaleThreshold.
+func (mgr *manager) isStale(obi *schedv1alpha1.ObservabilityIndicant, now time.Time) (time.Time, bool) {
+	if mgr.staleThreshold <= 0 {
+		return time.Time{}, false
+	}
+	newest, found := int64(0), false
+	for _, infos := range obi.Status.Metrics {
+		for _, info := range infos {
+			for _, r := range info.Records {
+				if !found || r.Timestamp > newest {
+					newest, found = r.Timestamp, true
+				}
+			}
+		}
+	}
+	if !found {
+		return time.Time{}, false
+	}
+	newestTime := time.UnixMilli(newest)
+	return newestTime, now.Sub(newestTime) > mgr.staleThreshold
+}
@@ -0,0 +1,113 @@
+/*
+Copyright 2022 The Arbiter Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manager
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/client-go/tools/record"
+
+	schedv1alpha1 "github.com/kube-arbiter/arbiter/pkg/apis/v1alpha1"
+)
+
+func TestIsMetricDataFresh(t *testing.T) {
+	newAgedOBI := func(name, nodeName string, age time.Duration) *schedv1alpha1.ObservabilityIndicant {
+		return newNodeOBI(name, nodeName, map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo{
+			"cpu": {{Records: []schedv1alpha1.Record{{Timestamp: time.Now().Add(-age).UnixMilli(), Value: "1"}}}},
+		})
+	}
+	for _, tc := range []struct {
+		name string
+		obis []*schedv1alpha1.ObservabilityIndicant
+		exp  bool
+	}{
+		{name: "no node", exp: false},
+		{name: "all stale", obis: []*schedv1alpha1.ObservabilityIndicant{
+			newAgedOBI("cpu", "node1", time.Hour),
+			newAgedOBI("cpu", "node2", 20*time.Minute),
+		}, exp: false},
+		{name: "one fresh", obis: []*schedv1alpha1.ObservabilityIndicant{
+			newAgedOBI("cpu", "node1", time.Hour),
+			newAgedOBI("cpu", "node2", time.Minute),
+		}, exp: true},
+		{name: "fresh obi of a stale node", obis: []*schedv1alpha1.ObservabilityIndicant{
+			newAgedOBI("cpu", "node1", time.Hour),
+			newAgedOBI("mem", "node1", 0),
+		}, exp: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			mgr := newTestManager(t)
+			for _, obi := range tc.obis {
+				mgr.ObservabilityIndicantAdd(obi)
+			}
+			if fresh := mgr.IsMetricDataFresh(10 * time.Minute); fresh != tc.exp {
+				t.Fatalf("expect fresh %v get %v", tc.exp, fresh)
+			}
+		})
+	}
+}
+
+func TestIsMetricDataFreshExpiredMetric(t *testing.T) {
+	mgr := newTestManager(t, WithMetricTypeTTL(map[string]time.Duration{"cpu": time.Millisecond}))
+	mgr.ObservabilityIndicantAdd(newNodeOBI("cpu", "node1", map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo{
+		"cpu": {{Records: []schedv1alpha1.Record{{Timestamp: time.Now().UnixMilli(), Value: "1"}}}},
+	}))
+	time.Sleep(10 * time.Millisecond)
+	if mgr.IsMetricDataFresh(time.Hour) {
+		t.Fatalf("expect expired metric not fresh")
+	}
+}
+
+func TestStaleThreshold(t *testing.T) {
+	newAgedOBI := func(name string, ages ...time.Duration) *schedv1alpha1.ObservabilityIndicant {
+		records := make([]schedv1alpha1.Record, 0, len(ages))
+		for _, age := range ages {
+			records = append(records, schedv1alpha1.Record{Timestamp: time.Now().Add(-age).UnixMilli(), Value: "1"})
+		}
+		return newNodeOBI(name, "node1", map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo{
+			"cpu": {{Records: records}},
+		})
+	}
+	recorder := record.NewFakeRecorder(10)
+	mgr := newTestManager(t, WithStaleThreshold(30*time.Minute), WithEventRecorder(recorder))
+	mgr.ObservabilityIndicantAdd(newAgedOBI("stale", 3*time.Hour, 2*time.Hour))
+	if _, err := mgr.GetNodeOBI(context.Background(), "node1"); !errors.Is(err, ErrNotFoundInCache) {
+		t.Fatalf("expect stale obi skipped get %v", err)
+	}
+	select {
+	case event := <-recorder.Events:
+		if !strings.Contains(event, StaleMetricDataEventReason) {
+			t.Fatalf("expect %s event get %s", StaleMetricDataEventReason, event)
+		}
+	default:
+		t.Fatalf("expect an event for the stale obi")
+	}
+
+	// an old record is fine as long as the newest one is fresh.
+	mgr.ObservabilityIndicantAdd(newAgedOBI("fresh", 2*time.Hour, time.Minute))
+	obi, err := mgr.GetNodeOBI(context.Background(), "node1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := obi["default-fresh"]; !ok || len(obi) != 1 {
+		t.Fatalf("expect only the fresh obi cached get %v", obi)
+	}
+}
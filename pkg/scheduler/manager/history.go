@@ -0,0 +1,93 @@
+/*
+Copyright 2022 The Arbiter Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manager
+
+import (
+	"time"
+)
+
+// AggregateSnapshot is the Aggregates of a node metric recomputed at Time, see GetNodeAggregateHistory.
+type AggregateSnapshot struct {
+	Time time.Time
+	Aggregates
+}
+
+// aggregateRing keeps the newest snapshots up to the length of buf, next is where the next one is written.
+type aggregateRing struct {
+	buf  []AggregateSnapshot
+	next int
+	full bool
+}
+
+func (r *aggregateRing) add(s AggregateSnapshot) {
+	r.buf[r.next] = s
+	r.next = (r.next + 1) % len(r.buf)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// snapshots returns a copy of the snapshots from the oldest to the newest.
+func (r *aggregateRing) snapshots() []AggregateSnapshot {
+	if !r.full {
+		return append([]AggregateSnapshot(nil), r.buf[:r.next]...)
+	}
+	res := make([]AggregateSnapshot, 0, len(r.buf))
+	res = append(res, r.buf[r.next:]...)
+	return append(res, r.buf[:r.next]...)
+}
+
+// recordHistoryLocked records the Aggregates of the updated metric types of the node at now, the same metric
+// as GetNodeMetric, if WithAggregateHistory is set. mgr.Lock must be held.
+func (mgr *manager) recordHistoryLocked(nodeName string, updated []string, now time.Time) {
+	if mgr.historyDepth <= 0 || len(updated) == 0 {
+		return
+	}
+	nodeCache, ok := mgr.nodeMetric[nodeName]
+	if !ok {
+		return
+	}
+	nodeHistory, ok := mgr.history[nodeName]
+	if !ok {
+		nodeHistory = make(map[string]*aggregateRing)
+		mgr.history[nodeName] = nodeHistory
+	}
+	for _, metricType := range updated {
+		m, ok := mergedMetric(nodeCache, metricType, now.UnixNano())
+		if !ok {
+			continue
+		}
+		ring, ok := nodeHistory[metricType]
+		if !ok {
+			ring = &aggregateRing{buf: make([]AggregateSnapshot, mgr.historyDepth)}
+			nodeHistory[metricType] = ring
+		}
+		ring.add(AggregateSnapshot{Time: now, Aggregates: AggregatesOf(m)})
+	}
+}
+
+// GetNodeAggregateHistory returns the Aggregates of metricType of the node recorded on every update, from the
+// oldest to the newest, at most the depth of WithAggregateHistory. nil if there is no history.
+func (mgr *manager) GetNodeAggregateHistory(nodeName, metricType string) []AggregateSnapshot {
+	mgr.RLock()
+	defer mgr.RUnlock()
+	ring, ok := mgr.history[nodeName][metricType]
+	if !ok {
+		return nil
+	}
+	return ring.snapshots()
+}
@@ -0,0 +1,65 @@
+/*
+Copyright 2022 The Arbiter Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manager
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+
+	schedv1alpha1 "github.com/kube-arbiter/arbiter/pkg/apis/v1alpha1"
+)
+
+func TestGetNodeAggregateHistory(t *testing.T) {
+	newCPUOBI := func(value string) *schedv1alpha1.ObservabilityIndicant {
+		return newNodeOBI("cpu", "node1", map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo{
+			"cpu": {{Records: newRecords(value)}},
+		})
+	}
+	mgr := newTestManager(t, WithAggregateHistory(3))
+	for i := 1; i <= 5; i++ {
+		mgr.ObservabilityIndicantAdd(newCPUOBI(strconv.Itoa(i)))
+	}
+	// an unchanged delivery is not recomputed, so not recorded.
+	mgr.ObservabilityIndicantAdd(newCPUOBI("5"))
+
+	history := mgr.GetNodeAggregateHistory("node1", "cpu")
+	var avgs []float64
+	for i, s := range history {
+		avgs = append(avgs, s.Avg)
+		if i > 0 && s.Time.Before(history[i-1].Time) {
+			t.Fatalf("expect history ordered by time get %+v", history)
+		}
+	}
+	if exp := []float64{3, 4, 5}; !reflect.DeepEqual(exp, avgs) {
+		t.Fatalf("expect the newest 3 avgs %v get %v", exp, avgs)
+	}
+	if h := mgr.GetNodeAggregateHistory("node1", "mem"); h != nil {
+		t.Fatalf("expect no history of mem get %v", h)
+	}
+
+	mgr.EvictNode("node1")
+	if h := mgr.GetNodeAggregateHistory("node1", "cpu"); h != nil {
+		t.Fatalf("expect history evicted with the node get %v", h)
+	}
+
+	mgr = newTestManager(t)
+	mgr.ObservabilityIndicantAdd(newCPUOBI("1"))
+	if h := mgr.GetNodeAggregateHistory("node1", "cpu"); h != nil {
+		t.Fatalf("expect no history by default get %v", h)
+	}
+}
@@ -0,0 +1,84 @@
+/*
+Copyright 2022 The Arbiter Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manager
+
+import (
+	"time"
+)
+
+// startJanitor starts the goroutine deleting the expired items of node and pod metric caches every
+// metricCleanupInterval, see WithMetricTTL. It is stopped by Close.
+func (mgr *manager) startJanitor() {
+	interval := mgr.metricCleanupInterval
+	if interval <= 0 {
+		return
+	}
+	mgr.workers.Add(1)
+	go func() {
+		defer mgr.workers.Done()
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				mgr.deleteExpired()
+			case <-mgr.done:
+				return
+			}
+		}
+	}()
+}
+
+// deleteExpired deletes the expired items of all metric caches.
+func (mgr *manager) deleteExpired() {
+	mgr.RLock()
+	defer mgr.RUnlock()
+	for _, handler := range mgr.targets {
+		for _, c := range handler.metrics {
+			c.DeleteExpired()
+		}
+	}
+}
+
+func (mgr *manager) closed() bool {
+	select {
+	case <-mgr.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// Close stops the background workers of the manager: the janitor of the metric caches, the debounce timers
+// of held updates, which are dropped, and the RegisterOnMetricUpdate callbacks, it returns once the running
+// ones finish. The informer handlers and the getters still work after Close, updates are added right away
+// without debouncing and no callback is called. Close can be called more than once.
+func (mgr *manager) Close() {
+	mgr.closeOnce.Do(func() {
+		close(mgr.done)
+		mgr.debounceLock.Lock()
+		for key := range mgr.debounceTimers {
+			mgr.stopUpdateLocked(key)
+		}
+		mgr.debounceLock.Unlock()
+		// no callback is started once the notifying ones release the lock.
+		mgr.callbackLock.Lock()
+		mgr.metricUpdateCallbacks = nil
+		mgr.callbackLock.Unlock()
+	})
+	mgr.workers.Wait()
+}
@@ -0,0 +1,81 @@
+/*
+Copyright 2022 The Arbiter Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manager
+
+import (
+	"context"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	schedv1alpha1 "github.com/kube-arbiter/arbiter/pkg/apis/v1alpha1"
+)
+
+func TestClose(t *testing.T) {
+	baseline := runtime.NumGoroutine()
+	mgr := newTestManager(t, WithMetricTTL(10*time.Millisecond, 10*time.Millisecond), WithUpdateDebounce(time.Hour))
+	var called int32
+	mgr.RegisterOnMetricUpdate(func(nodeName, metricType string) {
+		time.Sleep(50 * time.Millisecond)
+		atomic.AddInt32(&called, 1)
+	})
+	newOBI := func(value string) *schedv1alpha1.ObservabilityIndicant {
+		return newNodeOBI("obi", "node1", map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo{
+			"cpu": {{Records: newRecords(value)}},
+		})
+	}
+	mgr.ObservabilityIndicantAdd(newOBI("1"))
+	// held until the window ends.
+	mgr.ObservabilityIndicantUpdate(nil, newOBI("2"))
+
+	// the janitor deletes the expired item.
+	deadline := time.Now().Add(5 * time.Second)
+	for mgr.nodeMetric["node1"].ItemCount() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("expect the expired item deleted by the janitor")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	mgr.Close()
+	if n := atomic.LoadInt32(&called); n != 1 {
+		t.Fatalf("expect Close waits for the running callback get %d calls", n)
+	}
+	if len(mgr.pendingUpdates) != 0 || len(mgr.debounceTimers) != 0 {
+		t.Fatalf("expect held updates dropped get %v", mgr.pendingUpdates)
+	}
+	for runtime.NumGoroutine() > baseline {
+		if time.Now().After(deadline) {
+			buf := make([]byte, 1<<16)
+			t.Fatalf("expect goroutines of the manager terminated, %d > %d:\n%s", runtime.NumGoroutine(), baseline, buf[:runtime.Stack(buf, true)])
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	// idempotent.
+	mgr.Close()
+
+	// updates are added right away without any callback after Close.
+	mgr.ObservabilityIndicantUpdate(nil, newOBI("3"))
+	if m, err := mgr.GetNodeMetric(context.Background(), "node1", "cpu"); err != nil || m.Avg != 3 {
+		t.Fatalf("expect update added after Close get %+v %v", m, err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if n := atomic.LoadInt32(&called); n != 1 {
+		t.Fatalf("expect no callback after Close get %d calls", n)
+	}
+}
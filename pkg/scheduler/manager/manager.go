@@ -20,18 +20,25 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"math"
 	"os"
-	"strconv"
+	"reflect"
+	"sort"
 	"strings"
 	"sync"
+	"time"
 
+	"github.com/go-logr/logr"
 	gocache "github.com/patrickmn/go-cache"
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	informerv1 "k8s.io/client-go/informers/core/v1"
 	listerv1 "k8s.io/client-go/listers/core/v1"
 	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/klog/v2"
 	"k8s.io/kubernetes/pkg/scheduler/framework"
 
@@ -41,25 +48,101 @@ import (
 
 const (
 	ManagerLogPrefix = "[Arbiter-Manager] "
+
+	// NoMetricDataEventReason means the obi is skipped because it has no metric data.
+	NoMetricDataEventReason = "NoMetricData"
+	// UnresolvedTargetEventReason means the obi is skipped because its target can not be resolved.
+	UnresolvedTargetEventReason = "UnresolvedTarget"
+	// InvalidTargetRefEventReason means the obi is skipped because its TargetRef matches no target kind.
+	InvalidTargetRefEventReason = "InvalidTargetRef"
+	// StaleMetricDataEventReason means the obi is skipped because its newest record is too old, see WithStaleThreshold.
+	StaleMetricDataEventReason = "StaleMetricData"
+	// InvalidLogicEventReason means the score is skipped because its logic can not be compiled.
+	InvalidLogicEventReason = "InvalidLogic"
+
+	DefaultEWMAHalfLife = 5 * time.Minute
+	// UnknownAge is the age of a metric which has neither record nor EndTime, it is older than any threshold.
+	UnknownAge time.Duration = math.MaxInt64
 )
 
 var (
-	ErrNotFoundInCache = errors.New("not Found In Memory Cache")
-	ErrTypeAssertion   = errors.New("type assertion err")
-	ErrNoData          = errors.New("obi have no data")
+	ErrNotFoundInCache  = errors.New("not Found In Memory Cache")
+	ErrTypeAssertion    = errors.New("type assertion err")
+	ErrNoData           = errors.New("obi have no data")
+	ErrNoLogic          = errors.New("score have no logic")
+	ErrInvalidWeight    = errors.New("score weight should not be zero")
+	ErrInvalidTargetRef = errors.New("invalid target ref")
 )
 
 type ScoreResult struct {
 	NameKey string
 	schedv1alpha1.ScoreSpec
-	Result int64
-	Err    error
+	// Evaluator is the ScoreEvaluator of the Score and Program is the Logic compiled by it,
+	// Program is shared and should not be modified.
+	Evaluator ScoreEvaluator
+	Program   Program
+	// Timeout aborts the evaluation of Program taking longer than it, no limit if not positive, see ScoreTimeoutAnnotation.
+	Timeout time.Duration
+	// Selector is the pods the Score applies to, nil for all pods, see PodSelectorAnnotation.
+	Selector labels.Selector
+	// MetricScales are applied to the metrics of the logic, keyed by metric type, see MetricScaleAnnotation.
+	MetricScales map[string]MetricScale
+	Result       int64
+	Err          error
+	// NodeName and Details are only set by PreviewScores, Details is the result of each Score on NodeName.
+	NodeName string
+	Details  []ScoreResult
+}
+
+// cachedScore is the item of score cache, Logic is compiled once when the Score is added or updated.
+type cachedScore struct {
+	spec      schedv1alpha1.ScoreSpec
+	evaluator ScoreEvaluator
+	program   Program
+	timeout   time.Duration
+	selector  labels.Selector
+	scales    map[string]MetricScale
 }
 
 type Manager interface {
 	GetScore(ctx context.Context, namespace string) (scoreResults []ScoreResult, totalWeight int64)
+	GetScoreWithDiagnostics(ctx context.Context, namespace string) (scoreResults []ScoreResult, totalWeight int64, skipped []ScoreResult)
+	GetScoreForPod(ctx context.Context, pod *v1.Pod) (scoreResults []ScoreResult, totalWeight int64, skipped []ScoreResult)
+	PrepareScoring(ctx context.Context, namespace string, nodeNames []string) (ScoringData, error)
+	ClusterMetrics(ctx context.Context) ClusterMetrics
+	ListAllScores(ctx context.Context) map[string][]ScoreResult
+	RangeScores(fn func(namespace, name string, spec schedv1alpha1.ScoreSpec) bool)
+	GetScoreByName(ctx context.Context, namespace, name string) (schedv1alpha1.ScoreSpec, bool)
+	GetScoreError(namespace, name string) error
+	Stats() ManagerStats
+	SnapshotJSON() ([]byte, error)
+	ResyncAll(ctx context.Context) error
+	WarmUp(ctx context.Context, minNodes int) error
+	IsMetricDataFresh(maxAge time.Duration) bool
+	PruneEmpty() int
+	EvictNode(nodeName string)
+	FrozenMetrics(ctx context.Context, nodeName string) ([]string, error)
+	PreviewScores(ctx context.Context, pod *v1.Pod, nodeNames []string) ([]ScoreResult, error)
+	ComputeNodeScoreList(ctx context.Context, pod *v1.Pod, nodes []*v1.Node) (framework.NodeScoreList, *framework.Status)
+	GetNodeWithOBI(ctx context.Context, node *v1.Node) (*NodeWithOBI, error)
+	ExplainScoreDelta(ctx context.Context, namespace, nodeA, nodeB string) ([]ScoreContribution, error)
+	Close()
+	RegisterOnMetricUpdate(fn func(nodeName string, metricType string))
 	GetPodOBI(ctx context.Context, pod *v1.Pod) (obi map[string]OBI, err error)
 	GetNodeOBI(ctx context.Context, nodeName string) (obi map[string]OBI, err error)
+	GetAllNodeOBIs(ctx context.Context) (map[string]map[string]OBI, error)
+	GetNodeOBIInRange(ctx context.Context, nodeName string, start, end time.Time) (obi map[string]OBI, err error)
+	GetNodeOBIWithAge(ctx context.Context, nodeName string) (obi map[string]OBI, ages map[string]map[string]time.Duration, err error)
+	GetTargetOBI(ctx context.Context, kind TargetKind, key string) (obi map[string]OBI, err error)
+	GetNodeOBIForMetrics(ctx context.Context, nodeName string, metricTypes ...string) (obi map[string]OBI, err error)
+	GetNodeMetrics(ctx context.Context, nodeName string) (map[string]FullMetrics, error)
+	GetNodeAggregates(ctx context.Context, nodeName string) (map[string]Aggregates, error)
+	GetNodeMetric(ctx context.Context, nodeName, metricType string) (metric FullMetrics, err error)
+	GetNodeMetricByTarget(ctx context.Context, nodeName, metricType, targetItem string) (metric FullMetrics, err error)
+	NodesWithMetric(metricType string) []string
+	NodeMetricTypes(nodeName string) []string
+	GetNodeAggregateHistory(nodeName, metricType string) []AggregateSnapshot
+	GetNode(nodeName string) (*v1.Node, error)
 }
 
 type manager struct {
@@ -68,209 +151,1086 @@ type manager struct {
 	// TODO(Abirdcfly): should benchmark gocache or replace with other struct
 	podMetric  map[string]*gocache.Cache
 	nodeMetric map[string]*gocache.Cache
-	score      map[string]*gocache.Cache
+
+	// scoreLock guards score and invalidScores, so Score reads do not contend with frequent OBI updates.
+	scoreLock sync.RWMutex
+	score     map[string]*gocache.Cache
+	// invalidScores holds the compile error of Score keyed by namespace/name, they are not in score.
+	invalidScores map[string]error
 
 	// snapshotSharedLister is pod shared list
 	snapshotSharedLister framework.SharedLister
 	// podLister is pod lister
 	podLister listerv1.PodLister
 
+	// RWMutex guards the metric caches podMetric, nodeMetric and those in targets.
 	sync.RWMutex
 	nodeLister listerv1.NodeLister
+
+	// recorder emits events on the skipped obi, events are disabled if nil, see WithEventRecorder.
+	recorder record.EventRecorder
+	// logger is the logger of the informer handlers and the fallback of the get methods, see WithLogger.
+	logger klog.Logger
+
+	// targets maps the TargetRef kind of OBI to its metric cache, see WithTargetKind.
+	targets map[TargetKind]*targetHandler
+	// unresolved is the backoff state of the OBI whose target can't be resolved keyed by the OBI cache key,
+	// guarded by RWMutex, see WithUnresolvedBackoff.
+	unresolved           map[string]unresolvedOBI
+	unresolvedBackoff    time.Duration
+	maxUnresolvedBackoff time.Duration
+	// history is the aggregate history of each node keyed by node name and metric type, guarded by RWMutex,
+	// disabled if historyDepth is not positive, see WithAggregateHistory.
+	history      map[string]map[string]*aggregateRing
+	historyDepth int
+
+	// namespaceFallback enables GetScore to fallback to other namespace, see WithNamespaceFallback.
+	namespaceFallback bool
+	// fallbackNamespaces is the ordered fallback chain of GetScore, nil means the default one, see WithFallbackNamespaces.
+	fallbackNamespaces []string
+	// fallbackLock guards fallbackCounts, the number of GetScore reaching each fallback level, see NewManagerCollector.
+	fallbackLock   sync.Mutex
+	fallbackCounts map[string]uint64
+	// mergeScores makes GetScore return the Score of all namespaces in the fallback chain, see WithScoreMerge.
+	mergeScores bool
+	// metricTTL and metricCleanupInterval are used by node and pod metric caches, see WithMetricTTL.
+	metricTTL             time.Duration
+	metricCleanupInterval time.Duration
+	// metricTypeTTL overrides metricTTL of the metric types in it, see WithMetricTypeTTL.
+	metricTypeTTL map[string]time.Duration
+	// staleThreshold rejects the obi whose newest record is older than it, disabled if not positive, see WithStaleThreshold.
+	staleThreshold time.Duration
+	// downsampleAge and downsampleBucket, see WithDownsampling.
+	downsampleAge    time.Duration
+	downsampleBucket time.Duration
+	// maxRecordsPerMetric bounds the cached records of each metric, no bound if not positive, see WithMaxRecordsPerMetric.
+	maxRecordsPerMetric int
+	// gapThreshold sets FullMetrics.HasGap, disabled if not positive, see WithGapThreshold.
+	gapThreshold time.Duration
+	// ewmaHalfLife is the half-life used by FullMetrics.EWMA, see WithEWMAHalfLife.
+	ewmaHalfLife time.Duration
+	// counterMetrics are the metric types computed FullMetrics.Rate for, see WithCounterMetrics.
+	counterMetrics map[string]struct{}
+	// valueSuffixes are the unit suffixes stripped from the record values keyed by metric type, see WithValueSuffixes.
+	valueSuffixes map[string][]string
+	// enumValues map the string values to numbers keyed by metric type, see WithEnumValues.
+	enumValues map[string]map[string]float64
+	// evaluators are the ScoreEvaluator keyed by name, see WithScoreEvaluator.
+	evaluators map[string]ScoreEvaluator
+	// primaryAggregations are the names of the FullMetrics.Primary keyed by metric type, see WithPrimaryAggregations.
+	primaryAggregations map[string]string
+	// weightLabels are the series labels weighting the values keyed by metric type, see WithWeightLabels.
+	weightLabels map[string]string
+	// flapPolicies are keyed by metric type, see WithFlapDetection.
+	flapPolicies map[string]FlapPolicy
+	// metricScales are keyed by metric type, see WithMetricScales.
+	metricScales map[string]MetricScale
+	// scoreTimeout is the evaluation timeout of Score without ScoreTimeoutAnnotation, see WithScoreTimeout.
+	scoreTimeout time.Duration
+
+	// debounceWindow coalesces the updates of one OBI, disabled if not positive, see WithUpdateDebounce.
+	debounceWindow time.Duration
+	// debounceLock guards pendingUpdates, the latest update of each OBI cache key in its window,
+	// and debounceTimers, the timer ending the window of each key.
+	debounceLock   sync.Mutex
+	pendingUpdates map[string]*schedv1alpha1.ObservabilityIndicant
+	debounceTimers map[string]*time.Timer
+
+	// callbackLock guards metricUpdateCallbacks, see RegisterOnMetricUpdate.
+	callbackLock          sync.RWMutex
+	metricUpdateCallbacks []func(nodeName string, metricType string)
+
+	// populationCond is broadcast on populationLock when the metric caches are populated, see WarmUp.
+	populationLock sync.Mutex
+	populationCond *sync.Cond
+
+	// done is closed by Close, workers are the background goroutines and timers Close waits for.
+	done      chan struct{}
+	closeOnce sync.Once
+	workers   sync.WaitGroup
 }
 
 func (mgr *manager) GetPodOBI(ctx context.Context, pod *v1.Pod) (obi map[string]OBI, err error) {
-	// TODO(Abirdcfly): pod metric support will in v0.2.0
+	podKey := getPodKey(pod.Namespace, pod.Name)
+	logger := mgr.contextLogger(ctx).WithValues("pod", podKey)
+	mgr.RLock()
+	defer mgr.RUnlock()
+	podCache, ok := mgr.podMetric[podKey]
+	if !ok {
+		err = fmt.Errorf("pod %s: %w", podKey, ErrNotFoundInCache)
+		logger.V(4).Info("Failed to get pod OBI", "err", err)
+		return
+	}
+	obi, err = getOBIFromCache(ctx, podCache)
+	if err != nil {
+		err = fmt.Errorf("pod %s: %w", podKey, err)
+	}
 	return
 }
 
 func (mgr *manager) GetNodeOBI(ctx context.Context, nodeName string) (obi map[string]OBI, err error) {
+	if err = ctx.Err(); err != nil {
+		return nil, fmt.Errorf("node %s: %w", nodeName, err)
+	}
+	mgr.RLock()
+	defer mgr.RUnlock()
+	return mgr.getNodeOBILocked(ctx, nodeName)
+}
+
+// GetAllNodeOBIs returns the OBI of every node keyed by node name in one locked pass, e.g. for global bin-packing,
+// instead of calling GetNodeOBI per node. It is a snapshot copy, later updates of the cache are not reflected in it.
+// Nodes without any unexpired OBI are omitted.
+func (mgr *manager) GetAllNodeOBIs(ctx context.Context) (map[string]map[string]OBI, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	mgr.RLock()
+	defer mgr.RUnlock()
+	all := make(map[string]map[string]OBI, len(mgr.nodeMetric))
+	for nodeName, nodeCache := range mgr.nodeMetric {
+		obi, err := getOBIFromCache(ctx, nodeCache)
+		if errors.Is(err, ErrNotFoundInCache) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("node %s: %w", nodeName, err)
+		}
+		all[nodeName] = obi
+	}
+	return all, nil
+}
+
+// getNodeOBILocked is the same as GetNodeOBI, mgr.RLock must be held.
+func (mgr *manager) getNodeOBILocked(ctx context.Context, nodeName string) (obi map[string]OBI, err error) {
+	logger := mgr.contextLogger(ctx).WithValues("node", nodeName)
+	nodeCache, ok := mgr.nodeMetric[nodeName]
+	if !ok {
+		err = fmt.Errorf("node %s: %w", nodeName, ErrNotFoundInCache)
+		logger.V(4).Info("Failed to get node OBI", "err", err)
+		return
+	}
+	obi, err = getOBIFromCache(ctx, nodeCache)
+	if err != nil {
+		err = fmt.Errorf("node %s: %w", nodeName, err)
+		logger.V(4).Info("Failed to get node OBI", "err", err)
+	}
+	return
+}
+
+// GetNodeMetric returns one metric type of the node without copying all OBI of the node.
+// If more than one OBI of the node report metricType, it is resolved by the same way as MergeOBIMetrics.
+func (mgr *manager) GetNodeMetric(ctx context.Context, nodeName, metricType string) (metric FullMetrics, err error) {
+	logger := mgr.contextLogger(ctx).WithValues("node", nodeName)
+	mgr.RLock()
+	defer mgr.RUnlock()
 	nodeCache, ok := mgr.nodeMetric[nodeName]
 	if !ok {
-		err = ErrNotFoundInCache
-		klog.V(4).ErrorS(err, "Failed to get node OBI", "node", nodeName)
+		err = fmt.Errorf("node %s: %w", nodeName, ErrNotFoundInCache)
+		logger.V(4).Info("Failed to get node metric", "metricType", metricType, "err", err)
 		return
 	}
-	obi = make(map[string]OBI, nodeCache.ItemCount())
+	metric, found := mergedMetric(nodeCache, metricType, time.Now().UnixNano())
+	if !found {
+		err = fmt.Errorf("metric %s of node %s: %w", metricType, nodeName, ErrNotFoundInCache)
+		logger.V(4).Info("Failed to get node metric", "metricType", metricType, "err", err)
+	}
+	return
+}
+
+// mergedMetric returns metricType unexpired at now of the OBI in c resolved the same way as MergeOBIMetrics,
+// false if none of them reports it.
+func mergedMetric(c *gocache.Cache, metricType string, now int64) (metric FullMetrics, found bool) {
+	var foundKey string
+	for k, v := range c.Items() {
+		data, ok := v.Object.(cachedOBI)
+		if !ok || data.expired(metricType, now) {
+			continue
+		}
+		m, ok := data.metric[metricType]
+		if !ok {
+			continue
+		}
+		if found && !preferMetric(m, k, metric, foundKey) {
+			continue
+		}
+		found, foundKey, metric = true, k, m
+	}
+	return
+}
+
+// GetNodeOBIForMetrics is the same as GetNodeOBI, but only metricTypes are copied from the cache
+// and the OBI without any of them are omitted. An empty map is returned if the node is cached
+// but none of metricTypes is present.
+func (mgr *manager) GetNodeOBIForMetrics(ctx context.Context, nodeName string, metricTypes ...string) (obi map[string]OBI, err error) {
+	if err = ctx.Err(); err != nil {
+		return nil, err
+	}
+	mgr.RLock()
+	defer mgr.RUnlock()
+	nodeCache, ok := mgr.nodeMetric[nodeName]
+	if !ok {
+		err = fmt.Errorf("node %s: %w", nodeName, ErrNotFoundInCache)
+		mgr.contextLogger(ctx).V(4).Info("Failed to get node OBI", "node", nodeName, "metricTypes", metricTypes, "err", err)
+		return nil, err
+	}
+	obi = make(map[string]OBI)
+	now := time.Now().UnixNano()
 	for k, v := range nodeCache.Items() {
-		data, ok := v.Object.(OBI)
-		if ok {
-			obi[k] = data
-		} else {
-			err = ErrNotFoundInCache
-			klog.V(4).ErrorS(err, "Failed to get node OBI", "node", nodeName)
-			return
+		data, ok := v.Object.(cachedOBI)
+		if !ok {
+			continue
+		}
+		var o OBI
+		for _, metricType := range metricTypes {
+			m, ok := data.metric[metricType]
+			if !ok || data.expired(metricType, now) {
+				continue
+			}
+			if o.Metric == nil {
+				o.Metric = make(map[string]FullMetrics, len(metricTypes))
+			}
+			o.Metric[metricType] = m
+		}
+		if o.Metric != nil {
+			obi[k] = o
 		}
 	}
+	return obi, nil
+}
+
+// GetNode returns the node from the node lister of the manager, it must not be modified.
+func (mgr *manager) GetNode(nodeName string) (*v1.Node, error) {
+	node, err := mgr.nodeLister.Get(nodeName)
+	if err != nil {
+		return nil, fmt.Errorf("getting node %q: %w", nodeName, err)
+	}
+	return node, nil
+}
+
+// NodesWithMetric returns the sorted names of the nodes which have unexpired metricType in any of their OBI.
+func (mgr *manager) NodesWithMetric(metricType string) []string {
+	mgr.RLock()
+	defer mgr.RUnlock()
+	var nodes []string
+	now := time.Now().UnixNano()
+	for nodeName, nodeCache := range mgr.nodeMetric {
+		for _, v := range nodeCache.Items() {
+			data, ok := v.Object.(cachedOBI)
+			if !ok {
+				continue
+			}
+			if _, ok := data.metric[metricType]; ok && !data.expired(metricType, now) {
+				nodes = append(nodes, nodeName)
+				break
+			}
+		}
+	}
+	sort.Strings(nodes)
+	return nodes
+}
+
+// NodeMetricTypes returns the sorted distinct metric types the node has unexpired in any of its OBI,
+// nil if the node is not cached.
+func (mgr *manager) NodeMetricTypes(nodeName string) []string {
+	mgr.RLock()
+	defer mgr.RUnlock()
+	nodeCache, ok := mgr.nodeMetric[nodeName]
+	if !ok {
+		return nil
+	}
+	seen := make(map[string]struct{})
+	var metricTypes []string
+	now := time.Now().UnixNano()
+	for _, v := range nodeCache.Items() {
+		data, ok := v.Object.(cachedOBI)
+		if !ok {
+			continue
+		}
+		for metricType := range data.metric {
+			if _, ok := seen[metricType]; ok || data.expired(metricType, now) {
+				continue
+			}
+			seen[metricType] = struct{}{}
+			metricTypes = append(metricTypes, metricType)
+		}
+	}
+	sort.Strings(metricTypes)
+	return metricTypes
+}
+
+// GetNodeMetrics returns all metrics of the node keyed by metric type, see MergeOBIMetrics.
+func (mgr *manager) GetNodeMetrics(ctx context.Context, nodeName string) (map[string]FullMetrics, error) {
+	obi, err := mgr.GetNodeOBI(ctx, nodeName)
+	if err != nil {
+		return nil, err
+	}
+	return MergeOBIMetrics(obi), nil
+}
+
+// MergeOBIMetrics merges the metrics of all OBI of one target keyed by metric type.
+// If more than one OBI report the same metric type, e.g. two OBIs both report cpu of a node,
+// the one with the latest EndTime wins, and the OBI key in lexical order breaks the tie.
+func MergeOBIMetrics(obi map[string]OBI) map[string]FullMetrics {
+	merged := make(map[string]FullMetrics)
+	mergedKeys := make(map[string]string)
+	for k, o := range obi {
+		for metricType, m := range o.Metric {
+			if cur, ok := merged[metricType]; ok && !preferMetric(m, k, cur, mergedKeys[metricType]) {
+				continue
+			}
+			merged[metricType], mergedKeys[metricType] = m, k
+		}
+	}
+	return merged
+}
+
+// preferMetric returns true if metric m of OBI key wins metric cur of OBI curKey, see MergeOBIMetrics.
+func preferMetric(m FullMetrics, key string, cur FullMetrics, curKey string) bool {
+	return preferEndTime(m.EndTime, key, cur.EndTime, curKey)
+}
+
+// preferEndTime is the same as preferMetric by the EndTime of the metrics.
+func preferEndTime(end metav1.Time, key string, curEnd metav1.Time, curKey string) bool {
+	if !end.Equal(&curEnd) {
+		return curEnd.Before(&end)
+	}
+	return key < curKey
+}
+
+// GetNodeOBIInRange is the same as GetNodeOBI, but only the records and buckets whose timestamp in [start, end] are kept,
+// and Max/Min/Avg are recomputed over them. Metric types without records in the window are omitted.
+func (mgr *manager) GetNodeOBIInRange(ctx context.Context, nodeName string, start, end time.Time) (obi map[string]OBI, err error) {
+	all, err := mgr.GetNodeOBI(ctx, nodeName)
+	if err != nil {
+		return nil, err
+	}
+	logger := mgr.contextLogger(ctx).WithValues("node", nodeName)
+	startMs, endMs := start.UnixMilli(), end.UnixMilli()
+	obi = make(map[string]OBI, len(all))
+	for k, o := range all {
+		data := OBI{Metric: make(map[string]FullMetrics, len(o.Metric))}
+		for metricType, m := range o.Metric {
+			records := make([]schedv1alpha1.Record, 0, len(m.Records))
+			for _, r := range m.Records {
+				if r.Timestamp >= startMs && r.Timestamp <= endMs {
+					records = append(records, r)
+				}
+			}
+			m.Records = records
+			var buckets []RecordBucket
+			for _, b := range m.Buckets {
+				if b.Timestamp >= startMs && b.Timestamp <= endMs {
+					buckets = append(buckets, b)
+				}
+			}
+			m.Buckets = buckets
+			if !mgr.aggregate(logger, metricType, &m) {
+				continue
+			}
+			data.Metric[metricType] = m
+		}
+		obi[k] = data
+	}
 	return
 }
 
-func NewManager(client clientset.Interface, snapshotSharedLister framework.SharedLister, podInformer informerv1.PodInformer, nodeInformer informerv1.NodeInformer) *manager {
+// GetNodeOBIWithAge is the same as GetNodeOBI, and also returns the age of each metric keyed by OBI and metric type.
+// The age is how long ago the newest record is, or the EndTime if there is no record, UnknownAge otherwise.
+func (mgr *manager) GetNodeOBIWithAge(ctx context.Context, nodeName string) (obi map[string]OBI, ages map[string]map[string]time.Duration, err error) {
+	obi, err = mgr.GetNodeOBI(ctx, nodeName)
+	if err != nil {
+		return nil, nil, err
+	}
+	now := time.Now()
+	ages = make(map[string]map[string]time.Duration, len(obi))
+	for k, o := range obi {
+		ages[k] = make(map[string]time.Duration, len(o.Metric))
+		for metricType, m := range o.Metric {
+			ages[k][metricType] = metricAge(m, now)
+		}
+	}
+	return
+}
+
+func metricAge(m FullMetrics, now time.Time) time.Duration {
+	if len(m.Records) != 0 {
+		newest := m.Records[0].Timestamp
+		for _, r := range m.Records[1:] {
+			if r.Timestamp > newest {
+				newest = r.Timestamp
+			}
+		}
+		return now.Sub(time.UnixMilli(newest))
+	}
+	if !m.EndTime.IsZero() {
+		return now.Sub(m.EndTime.Time)
+	}
+	return UnknownAge
+}
+
+// getOBIFromCache returns all unexpired OBI in c without the expired metric types,
+// ErrNotFoundInCache is returned if there is none. The error of ctx is returned once ctx is done.
+func getOBIFromCache(ctx context.Context, c *gocache.Cache) (obi map[string]OBI, err error) {
+	items := c.Items()
+	obi = make(map[string]OBI, len(items))
+	now := time.Now().UnixNano()
+	for k, v := range items {
+		if err = ctx.Err(); err != nil {
+			return nil, err
+		}
+		data, ok := v.Object.(cachedOBI)
+		if !ok {
+			return nil, fmt.Errorf("cache key %s is not an OBI: %w", k, ErrNotFoundInCache)
+		}
+		if o, ok := data.unexpired(now); ok {
+			obi[k] = o
+		}
+	}
+	if len(obi) == 0 {
+		return nil, ErrNotFoundInCache
+	}
+	return
+}
+
+// NewManager creates the manager with opts, see NewManagerFromConfig for a typed configuration.
+func NewManager(client clientset.Interface, snapshotSharedLister framework.SharedLister, podInformer informerv1.PodInformer, nodeInformer informerv1.NodeInformer, opts ...Option) *manager {
 	pgMgr := &manager{
-		client:               client,
-		podMetric:            make(map[string]*gocache.Cache),
-		nodeMetric:           make(map[string]*gocache.Cache),
-		score:                make(map[string]*gocache.Cache),
-		snapshotSharedLister: snapshotSharedLister,
-		podLister:            podInformer.Lister(),
-		nodeLister:           nodeInformer.Lister(),
-		RWMutex:              sync.RWMutex{},
+		client:                client,
+		podMetric:             make(map[string]*gocache.Cache),
+		nodeMetric:            make(map[string]*gocache.Cache),
+		score:                 make(map[string]*gocache.Cache),
+		invalidScores:         make(map[string]error),
+		fallbackCounts:        make(map[string]uint64),
+		unresolved:            make(map[string]unresolvedOBI),
+		history:               make(map[string]map[string]*aggregateRing),
+		unresolvedBackoff:     DefaultUnresolvedBackoff,
+		maxUnresolvedBackoff:  DefaultMaxUnresolvedBackoff,
+		snapshotSharedLister:  snapshotSharedLister,
+		podLister:             podInformer.Lister(),
+		nodeLister:            nodeInformer.Lister(),
+		RWMutex:               sync.RWMutex{},
+		namespaceFallback:     true,
+		metricTTL:             gocache.NoExpiration,
+		metricCleanupInterval: gocache.NoExpiration,
+		ewmaHalfLife:          DefaultEWMAHalfLife,
+		evaluators:            map[string]ScoreEvaluator{DefaultScoreEvaluator: JavaScriptEvaluator{}},
+		scoreTimeout:          DefaultScoreTimeout,
+		pendingUpdates:        make(map[string]*schedv1alpha1.ObservabilityIndicant),
+		debounceTimers:        make(map[string]*time.Timer),
+		logger:                klog.Background(),
+		done:                  make(chan struct{}),
+	}
+	pgMgr.populationCond = sync.NewCond(&pgMgr.populationLock)
+	pgMgr.targets = map[TargetKind]*targetHandler{
+		NodeTargetKind: {resolve: ResolveNodeTarget, metrics: pgMgr.nodeMetric},
+		PodTargetKind:  {resolve: ResolvePodTarget, metrics: pgMgr.podMetric},
+	}
+	for _, opt := range opts {
+		opt(pgMgr)
 	}
+	pgMgr.startJanitor()
 	return pgMgr
 }
 
+func (mgr *manager) eventf(obj runtime.Object, reason, messageFmt string, args ...interface{}) {
+	if mgr.recorder == nil {
+		return
+	}
+	mgr.recorder.Eventf(obj, v1.EventTypeWarning, reason, messageFmt, args...)
+}
+
+// contextLogger returns the logger carried by ctx, or the logger of the manager if there is none.
+func (mgr *manager) contextLogger(ctx context.Context) klog.Logger {
+	if logger, err := logr.FromContext(ctx); err == nil {
+		return logger
+	}
+	return mgr.logger
+}
+
+// newMetricCache creates a node or pod metric cache, expired items are deleted by the janitor of the manager
+// instead of one goroutine per cache, see startJanitor.
+func (mgr *manager) newMetricCache() *gocache.Cache {
+	return gocache.New(mgr.metricTTL, gocache.NoExpiration)
+}
+
 func (mgr *manager) ScoreAdd(obj interface{}) {
-	klog.V(5).Infof("%s get new Score", ManagerLogPrefix)
 	key, err := cache.MetaNamespaceKeyFunc(obj)
 	if err != nil {
-		runtime.HandleError(err)
+		utilruntime.HandleError(err)
 		return
 	}
 	ns, name, err := cache.SplitMetaNamespaceKey(key)
 	if err != nil {
-		runtime.HandleError(err)
+		utilruntime.HandleError(err)
 		return
 	}
+	logger := mgr.logger.WithValues("namespace", ns, "score", name)
+	logger.V(5).Info(ManagerLogPrefix + "get new Score")
 	score, ok := obj.(*schedv1alpha1.Score)
 	if !ok {
-		klog.V(4).ErrorS(ErrTypeAssertion, "Failed to get score", "score", key)
+		logger.V(4).Info("Failed to get score", "err", ErrTypeAssertion)
+		return
+	}
+	cached, compileErr := mgr.compileScore(score)
+	mgr.scoreLock.Lock()
+	defer mgr.scoreLock.Unlock()
+	mgr.addScoreLocked(logger, key, ns, name, score, cached, compileErr)
+}
+
+// compileScore compiles the logic of score by its ScoreEvaluator, and resolves its evaluation timeout.
+func (mgr *manager) compileScore(score *schedv1alpha1.Score) (cached cachedScore, err error) {
+	cached.spec = score.Spec
+	if cached.timeout, err = mgr.scoreTimeoutOf(score); err != nil {
+		return cached, err
+	}
+	if cached.selector, err = podSelectorOf(score); err != nil {
+		return cached, err
+	}
+	if cached.scales, err = mgr.metricScalesOf(score); err != nil {
+		return cached, err
+	}
+	if cached.evaluator, err = mgr.scoreEvaluator(score); err != nil {
+		return cached, err
+	}
+	cached.program, err = cached.evaluator.Compile(score.Spec.Logic)
+	return cached, err
+}
+
+// scoreTimeoutOf returns the evaluation timeout set by ScoreTimeoutAnnotation of score, or the one of the manager.
+func (mgr *manager) scoreTimeoutOf(score *schedv1alpha1.Score) (time.Duration, error) {
+	value, ok := score.Annotations[ScoreTimeoutAnnotation]
+	if !ok {
+		return mgr.scoreTimeout, nil
+	}
+	timeout, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q: %w", ScoreTimeoutAnnotation, value, err)
+	}
+	return timeout, nil
+}
+
+// addScoreLocked caches score compiled by compileScore as ns/name, or records compileErr of it to logger,
+// mgr.scoreLock must be held.
+func (mgr *manager) addScoreLocked(logger klog.Logger, key, ns, name string, score *schedv1alpha1.Score, cached cachedScore, compileErr error) {
+	if compileErr != nil {
+		// an invalid logic can never score, drop it instead of failing silently at scoring time.
+		logger.V(2).Info(ManagerLogPrefix+"score logic is invalid, skip it", "err", compileErr)
+		mgr.invalidScores[key] = compileErr
+		mgr.eventf(score, InvalidLogicEventReason, "score logic is invalid: %v", compileErr)
+		mgr.deleteScore(ns, name)
 		return
 	}
+	delete(mgr.invalidScores, key)
 	if _, ok := mgr.score[ns]; !ok {
-		mgr.Lock()
 		mgr.score[ns] = gocache.New(gocache.NoExpiration, gocache.NoExpiration)
-		mgr.Unlock()
 	}
 	scoreCache := mgr.score[ns]
-	scoreCache.Set(name, score.Spec, gocache.NoExpiration)
+	scoreCache.Set(name, cached, gocache.NoExpiration)
+}
+
+// scoreEvaluator returns the ScoreEvaluator selected by ScoreEvaluatorAnnotation of score.
+func (mgr *manager) scoreEvaluator(score *schedv1alpha1.Score) (ScoreEvaluator, error) {
+	name := score.Annotations[ScoreEvaluatorAnnotation]
+	if name == "" {
+		name = DefaultScoreEvaluator
+	}
+	evaluator, ok := mgr.evaluators[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownScoreEvaluator, name)
+	}
+	return evaluator, nil
+}
+
+// GetScoreByName returns the spec of the Score namespace/name in cache, namespace fallback is not applied.
+// A Score with invalid logic is not in cache, see GetScoreError.
+func (mgr *manager) GetScoreByName(ctx context.Context, namespace, name string) (schedv1alpha1.ScoreSpec, bool) {
+	mgr.scoreLock.RLock()
+	defer mgr.scoreLock.RUnlock()
+	scoreCache, ok := mgr.score[namespace]
+	if !ok {
+		return schedv1alpha1.ScoreSpec{}, false
+	}
+	v, ok := scoreCache.Get(name)
+	if !ok {
+		return schedv1alpha1.ScoreSpec{}, false
+	}
+	cached, ok := v.(cachedScore)
+	return cached.spec, ok
+}
+
+// GetScoreError returns why the Score is not cached if its logic is invalid, nil otherwise.
+func (mgr *manager) GetScoreError(namespace, name string) error {
+	mgr.scoreLock.RLock()
+	defer mgr.scoreLock.RUnlock()
+	return mgr.invalidScores[namespace+"/"+name]
 }
 
 func (mgr *manager) ScoreUpdate(old interface{}, new interface{}) {
-	klog.V(5).Infof("%s get update Score", ManagerLogPrefix)
+	if score, ok := new.(*schedv1alpha1.Score); ok {
+		mgr.logger.V(5).Info(ManagerLogPrefix+"get update Score", "namespace", score.Namespace, "score", score.Name)
+	}
 	mgr.ScoreAdd(new)
 }
 
 func (mgr *manager) ScoreDelete(obj interface{}) {
-	klog.V(5).Infof("%s get delete Score", ManagerLogPrefix)
+	// the informer delivers a tombstone if the delete is missed, e.g. on relist after a watch disconnect.
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
 	key, err := cache.MetaNamespaceKeyFunc(obj)
 	if err != nil {
-		runtime.HandleError(err)
+		utilruntime.HandleError(err)
 		return
 	}
 	ns, name, err := cache.SplitMetaNamespaceKey(key)
 	if err != nil {
-		runtime.HandleError(err)
+		utilruntime.HandleError(err)
 		return
 	}
+	logger := mgr.logger.WithValues("namespace", ns, "score", name)
+	logger.V(5).Info(ManagerLogPrefix + "get delete Score")
 	_, ok := obj.(*schedv1alpha1.Score)
 	if !ok {
-		klog.V(4).ErrorS(ErrTypeAssertion, "Failed to get score", "score", key)
+		logger.V(4).Info("Failed to get score", "err", ErrTypeAssertion)
 		return
 	}
+	mgr.scoreLock.Lock()
+	defer mgr.scoreLock.Unlock()
+	delete(mgr.invalidScores, key)
+	if !mgr.deleteScore(ns, name) {
+		logger.V(4).Info("cant delete score, score not in cache", "err", ErrNotFoundInCache)
+	}
+}
+
+// deleteScore removes the Score from cache, and the namespace entry once it is empty.
+// It returns false if the namespace is not in cache. mgr.scoreLock must be held.
+func (mgr *manager) deleteScore(ns, name string) bool {
 	scoreCache, exist := mgr.score[ns]
 	if !exist {
-		klog.V(4).ErrorS(ErrNotFoundInCache, "cant delete score, score not in cache", "score", key)
+		return false
 	}
 	scoreCache.Delete(name)
 	if scoreCache.ItemCount() == 0 {
-		mgr.Lock()
 		delete(mgr.score, ns)
-		mgr.Unlock()
 	}
+	return true
 }
 
 // GetScore get all Score in the specified namespace.
 // If the return is empty, then get all Score in the namespace which arbiter-Scheduler pod is located.
 // If the return is also empty, fallback to get the Score in the kube-system namespace.
+// The fallback can be disabled by WithNamespaceFallback(false), the level reached is counted, see NewManagerCollector.
+// With WithScoreMerge(true), the Score of the requested namespace and of every fallback namespace are returned together.
+// Score with a negative weight is a penalty, totalWeight only sums the positive weights, see WeightedScore.
+// Nothing is returned once ctx is done, the scheduling cycle is given up anyway.
+// PodSelectorAnnotation is not applied, see GetScoreForPod.
 func (mgr *manager) GetScore(ctx context.Context, namespace string) (res []ScoreResult, totalWeight int64) {
+	res, totalWeight, _ = mgr.GetScoreWithDiagnostics(ctx, namespace)
+	return
+}
+
+// WeightedScore combines the Result of scores into the node score, totalWeight is the one returned by GetScore.
+// It is the weighted average of the Score with positive weight, the penalty of Score with negative weight
+// is then subtracted, e.g. weights 3 and 1 with results 80 and 40 get 70, adding weight -1 with result 50
+// gets (3*80 + 1*40 - 1*50) / 4 = 57. The result is clamped to [framework.MinNodeScore, framework.MaxNodeScore].
+func WeightedScore(scores []ScoreResult, totalWeight int64) int64 {
+	if totalWeight <= 0 {
+		return framework.MinNodeScore
+	}
+	var sum int64
+	for _, s := range scores {
+		sum += s.Result * s.Weight
+	}
+	score := sum / totalWeight
+	if score < framework.MinNodeScore {
+		return framework.MinNodeScore
+	}
+	if score > framework.MaxNodeScore {
+		return framework.MaxNodeScore
+	}
+	return score
+}
+
+// NormalizeScores combines results of many nodes into the score of each node in the range of
+// [framework.MinNodeScore, framework.MaxNodeScore], keyed by ScoreResult.NodeName, see WeightedScore.
+// results are the ones of each Score on each node, e.g. Details of PreviewScores, totalWeight is the one
+// returned by GetScore. Every node gets framework.MinNodeScore if totalWeight is not positive.
+func NormalizeScores(results []ScoreResult, totalWeight int64) map[string]int64 {
+	byNode := make(map[string][]ScoreResult)
+	for _, r := range results {
+		byNode[r.NodeName] = append(byNode[r.NodeName], r)
+	}
+	scores := make(map[string]int64, len(byNode))
+	for nodeName, nodeResults := range byNode {
+		scores[nodeName] = WeightedScore(nodeResults, totalWeight)
+	}
+	return scores
+}
+
+// SortScoreResults sorts results in place from the highest Result to the lowest, equal Result are ordered by
+// NodeName and then NameKey, so the order is deterministic whatever the order of results is.
+func SortScoreResults(results []ScoreResult) {
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Result != results[j].Result {
+			return results[i].Result > results[j].Result
+		}
+		if results[i].NodeName != results[j].NodeName {
+			return results[i].NodeName < results[j].NodeName
+		}
+		return results[i].NameKey < results[j].NameKey
+	})
+}
+
+// GetScoreWithDiagnostics is the same as GetScore, and additionally returns the Score skipped
+// because of blank logic or zero weight, with the reason in ScoreResult.Err.
+// The Score lock is only held while the cached Score are copied, the results are built without it.
+func (mgr *manager) GetScoreWithDiagnostics(ctx context.Context, namespace string) (res []ScoreResult, totalWeight int64, skipped []ScoreResult) {
+	namespace, namespaces := mgr.scoreNamespacesOf(namespace)
+	mgr.scoreLock.RLock()
+	snapshot := mgr.snapshotScoresLocked(namespaces)
+	mgr.scoreLock.RUnlock()
+	return mgr.scoresOfSnapshot(ctx, namespace, namespaces, snapshot)
+}
+
+// getScoreLocked is the same as GetScoreWithDiagnostics, mgr.scoreLock.RLock must be held.
+func (mgr *manager) getScoreLocked(ctx context.Context, namespace string) (res []ScoreResult, totalWeight int64, skipped []ScoreResult) {
+	namespace, namespaces := mgr.scoreNamespacesOf(namespace)
+	return mgr.scoresOfSnapshot(ctx, namespace, namespaces, mgr.snapshotScoresLocked(namespaces))
+}
+
+// namespaceScores is a copy of the cached Score of namespace keyed by name, see snapshotScoresLocked.
+type namespaceScores struct {
+	namespace string
+	scores    map[string]cachedScore
+}
+
+// scoreNamespacesOf returns the namespace GetScore is called with, the one of arbiter-scheduler if it is empty,
+// and the namespaces GetScore looks up in order, each of them only once.
+func (mgr *manager) scoreNamespacesOf(namespace string) (string, []string) {
 	if namespace == "" {
 		namespace = SchedulerNamespace()
 	}
-	scoreCache, exist := mgr.score[namespace]
-	count := 0
-	if exist {
-		count = scoreCache.ItemCount()
+	chain := []string{namespace}
+	if mgr.namespaceFallback {
+		chain = append(chain, mgr.fallbackNamespacesOf(namespace)...)
+	}
+	// a namespace may appear more than once in a custom chain, try it only once.
+	visited := make(map[string]struct{}, len(chain))
+	namespaces := chain[:0]
+	for _, ns := range chain {
+		if _, ok := visited[ns]; ok {
+			continue
+		}
+		visited[ns] = struct{}{}
+		namespaces = append(namespaces, ns)
+	}
+	return namespace, namespaces
+}
+
+// snapshotScoresLocked copies the cached Score of namespaces which have any in order. Unless WithScoreMerge is
+// set, only the first of them is copied, since GetScore falls back no further. The copies share the compiled
+// Program, which is never modified. mgr.scoreLock.RLock must be held.
+func (mgr *manager) snapshotScoresLocked(namespaces []string) []namespaceScores {
+	var snapshot []namespaceScores
+	for _, ns := range namespaces {
+		scoreCache, exist := mgr.score[ns]
+		if !exist || scoreCache.ItemCount() == 0 {
+			continue
+		}
+		snapshot = append(snapshot, namespaceScores{namespace: ns, scores: cachedScores(scoreCache)})
+		if !mgr.mergeScores {
+			break
+		}
+	}
+	return snapshot
+}
+
+// cachedScores copies the items of scoreCache keyed by Score name.
+func cachedScores(scoreCache *gocache.Cache) map[string]cachedScore {
+	items := scoreCache.Items()
+	scores := make(map[string]cachedScore, len(items))
+	for name, v := range items {
+		if cached, ok := v.Object.(cachedScore); ok {
+			scores[name] = cached
+		}
 	}
-	if !exist || count == 0 {
-		klog.V(4).InfoS(namespace+" has no score", "namespace", namespace)
-		if namespace == metav1.NamespaceSystem {
-			// final fallback. just exit.
-			return nil, 0
+	return scores
+}
+
+// scoresOfSnapshot builds the results of GetScore called with namespace from the snapshot of namespaces,
+// no lock is needed.
+func (mgr *manager) scoresOfSnapshot(ctx context.Context, namespace string, namespaces []string, snapshot []namespaceScores) (res []ScoreResult, totalWeight int64, skipped []ScoreResult) {
+	logger := mgr.contextLogger(ctx).WithValues("namespace", namespace)
+	if err := ctx.Err(); err != nil {
+		logger.V(4).Info("Give up getting score", "err", err)
+		return nil, 0, nil
+	}
+	if mgr.mergeScores {
+		return mergeScores(ctx, logger, snapshot)
+	}
+	// the snapshot holds the first namespace which has Score, see snapshotScoresLocked.
+	previous := namespace
+	for _, ns := range namespaces {
+		if ns != namespace {
+			logger.V(2).Info("no Score CR, try to get Score CR in the fallback namespace instead", "previous", previous, "fallback", ns)
 		}
-		fallbackNamespace := SchedulerNamespace()
-		if namespace == fallbackNamespace {
-			fallbackNamespace = metav1.NamespaceSystem
+		if len(snapshot) != 0 && snapshot[0].namespace == ns {
+			if ns != namespace {
+				mgr.countFallback(ns)
+			}
+			return scoresOf(ctx, logger, ns, snapshot[0].scores)
 		}
-		klog.V(2).InfoS(fmt.Sprintf("ns:%s has no Score CR, try to get Score CR in ns:%s instead", namespace, fallbackNamespace), "namespace", namespace)
-		return mgr.GetScore(ctx, fallbackNamespace)
+		logger.V(4).Info("no score in namespace", "scoreNamespace", ns)
+		previous = ns
 	}
+	// final fallback. just exit.
+	mgr.countFallback(FallbackLevelNone)
+	return nil, 0, nil
+}
+
+// countFallback counts a GetScore falling back to level, which is the namespace the Score is got from,
+// or FallbackLevelNone if there is no Score at all.
+func (mgr *manager) countFallback(level string) {
+	mgr.fallbackLock.Lock()
+	defer mgr.fallbackLock.Unlock()
+	mgr.fallbackCounts[level]++
+}
+
+// mergeScores returns the union of the Score in snapshot, a Score overrides the same-named ones
+// in the namespaces after it, e.g. a team namespace overrides the base policies of a shared namespace.
+// A skipped Score overrides too, so a team can disable a base policy by a Score with zero weight.
+func mergeScores(ctx context.Context, logger klog.Logger, snapshot []namespaceScores) (res []ScoreResult, totalWeight int64, skipped []ScoreResult) {
 	res = make([]ScoreResult, 0)
-	for name, v := range scoreCache.Items() {
-		scoreSpec, ok := v.Object.(schedv1alpha1.ScoreSpec)
-		if ok {
-			if strings.TrimSpace(scoreSpec.Logic) == "" {
+	overridden := make(map[string]struct{})
+	for _, nsScores := range snapshot {
+		ns := nsScores.namespace
+		nsRes, _, nsSkipped := scoresOf(ctx, logger, ns, nsScores.scores)
+		if err := ctx.Err(); err != nil {
+			logger.V(4).Info("Give up getting score", "err", err)
+			return nil, 0, nil
+		}
+		for _, r := range nsRes {
+			name := strings.TrimPrefix(r.NameKey, ns+"/")
+			if _, ok := overridden[name]; ok {
+				logger.V(4).Info("Score is overridden", "score", r.NameKey)
 				continue
 			}
-			if scoreSpec.Weight <= 0 {
-				continue
+			res = append(res, r)
+			if r.Weight > 0 {
+				totalWeight += r.Weight
+			}
+		}
+		for _, r := range nsSkipped {
+			if _, ok := overridden[strings.TrimPrefix(r.NameKey, ns+"/")]; !ok {
+				skipped = append(skipped, r)
+			}
+		}
+		// names are marked once the namespace is done, names are unique within a namespace.
+		for name := range nsScores.scores {
+			overridden[name] = struct{}{}
+		}
+	}
+	return res, totalWeight, skipped
+}
+
+// fallbackNamespacesOf returns the namespaces GetScore falls back to in order when namespace has no Score.
+// If namespace is in the chain, only the namespaces after it are returned, e.g. kube-system is the end by default.
+func (mgr *manager) fallbackNamespacesOf(namespace string) []string {
+	chain := mgr.fallbackNamespaces
+	if chain == nil {
+		chain = []string{SchedulerNamespace(), metav1.NamespaceSystem}
+	}
+	for i, ns := range chain {
+		if ns == namespace {
+			return chain[i+1:]
+		}
+	}
+	return chain
+}
+
+// ListAllScores returns the valid Score of every namespace in cache, keyed by namespace.
+// The namespace fallback of GetScore is not applied.
+func (mgr *manager) ListAllScores(ctx context.Context) map[string][]ScoreResult {
+	mgr.scoreLock.RLock()
+	snapshot := make(map[string]map[string]cachedScore, len(mgr.score))
+	for ns, scoreCache := range mgr.score {
+		snapshot[ns] = cachedScores(scoreCache)
+	}
+	mgr.scoreLock.RUnlock()
+	all := make(map[string][]ScoreResult, len(snapshot))
+	for ns, scores := range snapshot {
+		if res, _, _ := scoresOf(ctx, mgr.contextLogger(ctx).WithValues("namespace", ns), ns, scores); len(res) != 0 {
+			all[ns] = res
+		}
+	}
+	return all
+}
+
+// RangeScores calls fn with a copy of the spec of each valid Score in cache, the same ones as ListAllScores,
+// until fn returns false, without building the result of all namespaces at once. The lock is only held while
+// the Score of one namespace are copied, so fn can call the manager, and the Score added or deleted during the
+// iteration may or may not be visited. The order is not specified.
+func (mgr *manager) RangeScores(fn func(namespace, name string, spec schedv1alpha1.ScoreSpec) bool) {
+	mgr.scoreLock.RLock()
+	namespaces := make([]string, 0, len(mgr.score))
+	for ns := range mgr.score {
+		namespaces = append(namespaces, ns)
+	}
+	mgr.scoreLock.RUnlock()
+	for _, ns := range namespaces {
+		mgr.scoreLock.RLock()
+		var scores map[string]cachedScore
+		if scoreCache, ok := mgr.score[ns]; ok {
+			scores = cachedScores(scoreCache)
+		}
+		mgr.scoreLock.RUnlock()
+		res, _, _ := scoresOf(context.Background(), mgr.logger.WithValues("namespace", ns), ns, scores)
+		for _, r := range res {
+			r.ScoreSpec = *r.ScoreSpec.DeepCopy()
+			if !fn(ns, strings.TrimPrefix(r.NameKey, ns+"/"), r.ScoreSpec) {
+				return
 			}
-			res = append(res, ScoreResult{
-				NameKey:   namespace + "/" + name,
-				ScoreSpec: scoreSpec,
-				Result:    0,
-			})
+		}
+	}
+}
+
+// scoresOf returns the valid Score in scores of namespace and their total weight,
+// Score with blank logic or zero weight are returned in skipped. Nothing is returned once ctx is done, which is
+// logged to logger.
+func scoresOf(ctx context.Context, logger klog.Logger, namespace string, scores map[string]cachedScore) (res []ScoreResult, totalWeight int64, skipped []ScoreResult) {
+	res = make([]ScoreResult, 0, len(scores))
+	for name, cached := range scores {
+		if err := ctx.Err(); err != nil {
+			logger.V(4).Info("Give up getting score", "err", err)
+			return nil, 0, nil
+		}
+		scoreSpec := cached.spec
+		result := ScoreResult{
+			NameKey:      namespace + "/" + name,
+			ScoreSpec:    scoreSpec,
+			Evaluator:    cached.evaluator,
+			Program:      cached.program,
+			Timeout:      cached.timeout,
+			Selector:     cached.selector,
+			MetricScales: cached.scales,
+			Result:       0,
+		}
+		if strings.TrimSpace(scoreSpec.Logic) == "" {
+			result.Err = ErrNoLogic
+			skipped = append(skipped, result)
+			continue
+		}
+		if scoreSpec.Weight == 0 {
+			result.Err = fmt.Errorf("%w: %d", ErrInvalidWeight, scoreSpec.Weight)
+			skipped = append(skipped, result)
+			continue
+		}
+		res = append(res, result)
+		if scoreSpec.Weight > 0 {
 			totalWeight += scoreSpec.Weight
 		}
 	}
+	// cache items are in random order, keep the Score ordered by name to be deterministic.
+	sortByNameKey(res)
+	sortByNameKey(skipped)
 	return
 }
 
+func sortByNameKey(results []ScoreResult) {
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].NameKey < results[j].NameKey
+	})
+}
+
 func (mgr *manager) ObservabilityIndicantAdd(obj interface{}) {
-	klog.V(5).Infoln(ManagerLogPrefix + "get new ObservabilityIndicant")
 	_, err := cache.MetaNamespaceKeyFunc(obj)
 	if err != nil {
-		klog.V(4).ErrorS(err, ManagerLogPrefix+"Failed to obj in cache when add", "obj", obj)
-		runtime.HandleError(err)
+		mgr.logger.V(4).Info(ManagerLogPrefix+"Failed to obj in cache when add", "obj", obj, "err", err)
+		utilruntime.HandleError(err)
 		return
 	}
 	obi, ok := obj.(*schedv1alpha1.ObservabilityIndicant)
 	if !ok {
-		klog.V(4).ErrorS(ErrTypeAssertion, ManagerLogPrefix+"Failed to get observability indicant", "obj", obj)
+		mgr.logger.V(4).Info(ManagerLogPrefix+"Failed to get observability indicant", "obj", obj, "err", ErrTypeAssertion)
+		return
+	}
+	logger := mgr.logger.WithValues("obi", klog.KObj(obi))
+	logger.V(5).Info(ManagerLogPrefix + "get new ObservabilityIndicant")
+	if !mgr.acceptOBI(logger, obi) {
 		return
 	}
-	klog.V(5).Infoln(ManagerLogPrefix+"get new ObservabilityIndicant", "obi", klog.KObj(obi))
-	expiration := gocache.NoExpiration
+	// deferred first, so it runs once the lock is released.
+	defer mgr.broadcastPopulation()
+	mgr.Lock()
+	defer mgr.Unlock()
+	mgr.addOBILocked(logger, obi)
+}
+
+// acceptOBI returns false with a log and an event if obi should not be cached, e.g. it has no data.
+func (mgr *manager) acceptOBI(logger klog.Logger, obi *schedv1alpha1.ObservabilityIndicant) bool {
 	if len(obi.Status.Metrics) == 0 {
-		klog.V(4).ErrorS(ErrNoData, ManagerLogPrefix+"obi have no data", "obi", klog.KObj(obi))
+		logger.V(4).Info(ManagerLogPrefix+"obi have no data", "err", fmt.Errorf("obi %s: %w", klog.KObj(obi), ErrNoData))
+		mgr.eventf(obi, NoMetricDataEventReason, "obi has no metric data, it is not used for scheduling")
+		return false
+	}
+	if newest, stale := mgr.isStale(obi, time.Now()); stale {
+		logger.V(2).Info(ManagerLogPrefix+"skip obi, the newest record is older than the stale threshold", "newest", newest, "threshold", mgr.staleThreshold)
+		mgr.eventf(obi, StaleMetricDataEventReason, "the newest record of obi at %s is older than %v, it is not used for scheduling", newest.Format(time.RFC3339), mgr.staleThreshold)
+		return false
+	}
+	return true
+}
+
+// addOBILocked adds the metrics of obi to the cache of its target and notifies the updated node metrics,
+// mgr.Lock must be held.
+func (mgr *manager) addOBILocked(logger klog.Logger, obi *schedv1alpha1.ObservabilityIndicant) {
+	handler, ok := mgr.targets[targetKindOf(obi.Spec.TargetRef)]
+	if !ok {
+		err := targetRefMismatch(obi.Spec.TargetRef, mgr.targetKinds())
+		logger.V(2).Info(ManagerLogPrefix+"skip obi, its TargetRef matches no target kind", "TargetRef", obi.Spec.TargetRef, "err", err)
+		mgr.eventf(obi, InvalidTargetRefEventReason, "obi is not used for scheduling: %v", err)
 		return
 	}
-	var cacheName *gocache.Cache
-	switch {
-	case IsResourceNode(obi.Spec.TargetRef):
-		nodeName := obi.Spec.TargetRef.Name
-		if nodeName == "" {
-			for _, m := range obi.Status.Metrics {
-				if len(m) == 0 {
-					return
-				}
-				nodeName = m[0].TargetItem
-				break
-			}
-			if nodeName == "" {
-				return
-			}
-		}
-		if _, ok := mgr.nodeMetric[nodeName]; !ok {
-			mgr.nodeMetric[nodeName] = gocache.New(gocache.NoExpiration, gocache.NoExpiration)
+	cacheKey := getMetricCacheKey(obi)
+	now := time.Now()
+	if mgr.backingOff(cacheKey, obi, now) {
+		logger.V(5).Info(ManagerLogPrefix+"skip obi, its target can't be resolved before", "retryAt", mgr.unresolved[cacheKey].retryAt)
+		return
+	}
+	if items := splitNodeTargetItems(obi); len(items) > 1 {
+		delete(mgr.unresolved, cacheKey)
+		// one obi reports the metrics of many nodes, each node gets its own part.
+		for nodeName, metrics := range items {
+			updated := mgr.addTargetMetrics(logger, handler.metrics, nodeName, cacheKey, metrics, obi)
+			mgr.recordHistoryLocked(nodeName, updated, now)
+			mgr.notifyMetricUpdate(nodeName, updated)
 		}
-		cacheName = mgr.nodeMetric[nodeName]
-	// case IsResourcePod(obi.Spec.TargetRef):
-	//	cacheName = mgr.podMetric
-	default:
-		klog.V(4).ErrorS(ErrNotFoundInCache, ManagerLogPrefix+"Failed to get cacheName", "TargetRef", obi.Spec.TargetRef)
 		return
 	}
-	cacheKey := getMetricCacheKey(obi)
+	target := handler.resolve(obi)
+	if target == "" {
+		logger.V(4).Info(ManagerLogPrefix+"Failed to resolve target", "TargetRef", obi.Spec.TargetRef, "err", fmt.Errorf("target of obi %s: %w", klog.KObj(obi), ErrNotFoundInCache))
+		mgr.eventf(obi, UnresolvedTargetEventReason, "can not resolve the %s target of obi, it is not used for scheduling", obi.Spec.TargetRef.Kind)
+		mgr.backOffUnresolved(cacheKey, obi, now)
+		return
+	}
+	delete(mgr.unresolved, cacheKey)
+	updated := mgr.addTargetMetrics(logger, handler.metrics, target, cacheKey, obi.Status.Metrics, obi)
+	if IsResourceNode(obi.Spec.TargetRef) {
+		mgr.recordHistoryLocked(target, updated, now)
+		mgr.notifyMetricUpdate(target, updated)
+	}
+}
+
+// addTargetMetrics aggregates metrics of obi and merges them into the cacheKey entry of target in metricCache,
+// the metric types updated are returned. mgr.Lock must be held.
+func (mgr *manager) addTargetMetrics(logger klog.Logger, metricCache map[string]*gocache.Cache, target, cacheKey string,
+	metrics map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo, obi *schedv1alpha1.ObservabilityIndicant) (updated []string) {
+	logger = logger.WithValues(targetLogKey(obi.Spec.TargetRef), target)
+	if _, ok := metricCache[target]; !ok {
+		metricCache[target] = mgr.newMetricCache()
+	}
+	cacheName := metricCache[target]
 	/*
 		Structure of a typical obi:
 			{
@@ -318,79 +1278,221 @@ func (mgr *manager) ObservabilityIndicantAdd(obj interface{}) {
 			    }
 			}
 	*/
-	var data OBI
+	// Merge semantics: each delivery replaces the records of the metric types it reports, metric types it does
+	// not report are kept until expired, records are never accumulated across deliveries. A metric type whose
+	// records are the same as the cached ones is kept as is, without re-aggregation, refreshing its expiration
+	// or being reported as updated, so redelivering an identical OBI, e.g. on resync, is a no-op.
+	// The cached Metric map may be held by readers, so always merge into a copy.
+	now := time.Now().UnixNano()
+	data := cachedOBI{metric: make(map[string]FullMetrics), expiration: make(map[string]int64)}
+	// changed is false as long as data is the same as the cached item.
+	changed := true
 	if d, ok := cacheName.Get(cacheKey); ok {
-		data, ok = d.(OBI)
-		if !ok {
-			klog.V(5).ErrorS(errors.New("get data err"), ManagerLogPrefix+"get data err")
-			data = OBI{Metric: make(map[string]FullMetrics)}
+		if old, ok := d.(cachedOBI); ok {
+			changed = false
+			for k, v := range old.metric {
+				if old.expired(k, now) {
+					changed = true
+					continue
+				}
+				data.metric[k] = v
+				if exp, ok := old.expiration[k]; ok {
+					data.expiration[k] = exp
+				}
+			}
+		} else {
+			logger.V(5).Info(ManagerLogPrefix+"get data err", "err", errors.New("get data err"))
 		}
-	} else {
-		data = OBI{Metric: make(map[string]FullMetrics)}
 	}
-	metrics := obi.Status.Metrics
 	for metricType, metricInfo := range metrics {
 		// metricType cpu mem ...
-		if _, exist := (data.Metric)[metricType]; !exist {
-			(data.Metric)[metricType] = FullMetrics{}
-		}
-		v := (data.Metric)[metricType]
 		if len(metricInfo) == 0 {
+			if _, exist := data.metric[metricType]; !exist {
+				data.metric[metricType] = FullMetrics{}
+			}
+			mgr.setMetricExpiration(data, metricType, now)
+			changed = true
+			continue
+		}
+		info := mergeMetricInfo(logger, metricType, metricInfo)
+		buckets := mgr.downsampleRecords(logger, metricType, &info)
+		if n := mgr.maxRecordsPerMetric; n > 0 && len(info.Records) > n {
+			// records are sorted by timestamp, keep the newest ones.
+			info.Records = append([]schedv1alpha1.Record(nil), info.Records[len(info.Records)-n:]...)
+		}
+		targetInfos := mergeTargetItems(logger, metricType, metricInfo, mgr.maxRecordsPerMetric)
+		v, exist := data.metric[metricType]
+		prev := v
+		if exist && reflect.DeepEqual(v.ObservabilityIndicantStatusMetricInfo, info) && reflect.DeepEqual(v.Buckets, buckets) && sameTargetInfos(v.Targets, targetInfos) {
+			continue
+		}
+		changed = true
+		mgr.setMetricExpiration(data, metricType, now)
+		v.ObservabilityIndicantStatusMetricInfo = info
+		v.Buckets = buckets
+		v.Targets = nil
+		data.metric[metricType] = v
+		if len(info.Records) == 0 {
+			continue
+		}
+		if !mgr.aggregate(logger, metricType, &v) {
+			// no record can be parsed, storing it would produce a NaN average.
+			logger.V(2).Info(ManagerLogPrefix+"skip metric, no value can be parsed from records", "metricType", metricType)
+			delete(data.metric, metricType)
+			delete(data.expiration, metricType)
+			continue
+		}
+		v.Targets = mgr.aggregateTargetItems(logger, metricType, targetInfos)
+		mgr.combineTargetItems(logger, metricType, &v)
+		if !mgr.freezeFlapping(logger, metricType, prev, exist, &v) {
+			delete(data.metric, metricType)
+			delete(data.expiration, metricType)
 			continue
 		}
-		v.ObservabilityIndicantStatusMetricInfo = *metricInfo[0].DeepCopy()
-		if len(v.ObservabilityIndicantStatusMetricInfo.Records) == 0 {
+		data.metric[metricType] = v
+		if v.Frozen {
+			// the value is held, so nothing is updated for scoring.
 			continue
 		}
-		v.Max, v.Min, v.Avg = 0, 0, 0
-		var i int
-		var sum float64
-		for _, r := range v.Records {
-			val, err := strconv.ParseFloat(r.Value, 64)
-			if err != nil {
-				klog.V(5).ErrorS(err, ManagerLogPrefix+"Failed to parse float", "Value", r.Value, "obi", klog.KObj(obi))
+		updated = append(updated, metricType)
+	}
+	if !changed {
+		logger.V(5).Info("obi not changed, skip cache update", "cacheKey", cacheKey)
+		return
+	}
+	logger.V(5).Info("add obi to cache", "cacheKey", cacheKey)
+	cacheName.Set(cacheKey, data, data.ttl(now))
+	return
+}
+
+// RegisterOnMetricUpdate registers fn to be called when a metric of a node is updated by an OBI.
+// fn is called in a new goroutine after the cache is updated, so it does not block the informer and
+// can read the new value by GetNodeOBI or GetNodeMetric. There is no ordering guarantee between calls,
+// a later call may run before an earlier one, fn should always read the latest value instead of assuming the order.
+// fn is not called after Close, and Close waits for the running calls.
+func (mgr *manager) RegisterOnMetricUpdate(fn func(nodeName string, metricType string)) {
+	mgr.callbackLock.Lock()
+	defer mgr.callbackLock.Unlock()
+	mgr.metricUpdateCallbacks = append(mgr.metricUpdateCallbacks, fn)
+}
+
+// notifyMetricUpdate calls the callbacks registered by RegisterOnMetricUpdate asynchronously.
+func (mgr *manager) notifyMetricUpdate(nodeName string, metricTypes []string) {
+	mgr.callbackLock.RLock()
+	defer mgr.callbackLock.RUnlock()
+	if mgr.closed() {
+		return
+	}
+	for _, fn := range mgr.metricUpdateCallbacks {
+		for _, metricType := range metricTypes {
+			mgr.workers.Add(1)
+			go func(fn func(nodeName string, metricType string), metricType string) {
+				defer mgr.workers.Done()
+				fn(nodeName, metricType)
+			}(fn, metricType)
+		}
+	}
+}
+
+// splitNodeTargetItems groups the metrics of a node obi without TargetRef.Name by the node in TargetItem,
+// entries without TargetItem are dropped. It returns nil if obi is not such a node obi.
+func splitNodeTargetItems(obi *schedv1alpha1.ObservabilityIndicant) map[string]map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo {
+	if !IsResourceNode(obi.Spec.TargetRef) || obi.Spec.TargetRef.Name != "" {
+		return nil
+	}
+	items := make(map[string]map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo)
+	for metricType, infos := range obi.Status.Metrics {
+		for _, info := range infos {
+			if info.TargetItem == "" {
 				continue
 			}
-			if val > v.Max {
-				v.Max = val
-			}
-			if val < v.Min {
-				v.Min = val
+			if _, ok := items[info.TargetItem]; !ok {
+				items[info.TargetItem] = make(map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo)
 			}
-			sum += val
-			i++
+			items[info.TargetItem][metricType] = append(items[info.TargetItem][metricType], info)
 		}
-		v.Avg = sum / float64(i)
-		(data.Metric)[metricType] = v
 	}
-	klog.V(5).InfoS("add obi to cache", "obi", klog.KObj(obi), "cacheKey", cacheKey)
-	cacheName.Set(cacheKey, data, expiration)
+	return items
 }
 
 func (mgr *manager) ObservabilityIndicantUpdate(old interface{}, new interface{}) {
-	klog.V(5).Infoln(ManagerLogPrefix + "get update ObservabilityIndicant")
+	if obi, ok := new.(*schedv1alpha1.ObservabilityIndicant); ok {
+		mgr.logger.V(5).Info(ManagerLogPrefix+"get update ObservabilityIndicant", "obi", klog.KObj(obi))
+	}
+	if mgr.debounceUpdate(new) {
+		return
+	}
 	mgr.ObservabilityIndicantAdd(new)
 }
 
 func (mgr *manager) ObservabilityIndicantDelete(obj interface{}) {
-	klog.V(5).Infoln(ManagerLogPrefix + "get delete ObservabilityIndicant")
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
 	obi, ok := obj.(*schedv1alpha1.ObservabilityIndicant)
 	if !ok {
-		klog.V(4).ErrorS(errors.New("cant convert to observability indicant"), ManagerLogPrefix+"cant convert to observability indicant", "obj", obj)
+		mgr.logger.V(4).Info(ManagerLogPrefix+"cant convert to observability indicant", "obj", obj, "err", ErrTypeAssertion)
+		return
+	}
+	mgr.logger.V(5).Info(ManagerLogPrefix+"get delete ObservabilityIndicant", "obi", klog.KObj(obi))
+	mgr.cancelUpdate(obi)
+	mgr.Lock()
+	defer mgr.Unlock()
+	delete(mgr.unresolved, getMetricCacheKey(obi))
+	handler, ok := mgr.targets[targetKindOf(obi.Spec.TargetRef)]
+	if !ok {
 		return
 	}
-	switch {
-	case IsResourceNode(obi.Spec.TargetRef):
-		nodeName := obi.Spec.TargetRef.Name
-		if nodeName == "" {
-			return
+	if items := splitNodeTargetItems(obi); len(items) > 1 {
+		for nodeName := range items {
+			deleteMetricCache(handler.metrics, nodeName, getMetricCacheKey(obi))
 		}
-		delete(mgr.nodeMetric, nodeName)
-	case IsResourcePod(obi.Spec.TargetRef):
 		return
-	default:
+	}
+	target := handler.resolve(obi)
+	if target == "" {
+		return
+	}
+	deleteMetricCache(handler.metrics, target, getMetricCacheKey(obi))
+}
+
+// NodeDelete is the node informer delete handler, it evicts the metrics of the deleted node, see EvictNode.
+func (mgr *manager) NodeDelete(obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	node, ok := obj.(*v1.Node)
+	if !ok {
+		mgr.logger.V(4).Info(ManagerLogPrefix+"Failed to get node when delete", "obj", obj, "err", ErrTypeAssertion)
+		return
+	}
+	mgr.EvictNode(node.Name)
+}
+
+// EvictNode removes the metric cache of nodeName, e.g. the node is removed from the cluster.
+// OBI of the node added later are cached again.
+func (mgr *manager) EvictNode(nodeName string) {
+	mgr.Lock()
+	defer mgr.Unlock()
+	if _, ok := mgr.nodeMetric[nodeName]; !ok {
+		return
+	}
+	delete(mgr.nodeMetric, nodeName)
+	delete(mgr.history, nodeName)
+	mgr.logger.V(5).Info(ManagerLogPrefix+"evict node metrics", "node", nodeName)
+}
+
+// deleteMetricCache removes one obi from the target's cache,
+// the target entry is deleted only when no obi point to it anymore.
+func deleteMetricCache(metricCache map[string]*gocache.Cache, target, cacheKey string) {
+	c, ok := metricCache[target]
+	if !ok {
 		return
 	}
+	c.Delete(cacheKey)
+	if c.ItemCount() == 0 {
+		delete(metricCache, target)
+	}
 }
 
 func getMetricCacheKey(obi *schedv1alpha1.ObservabilityIndicant) string {
@@ -399,25 +1501,62 @@ func getMetricCacheKey(obi *schedv1alpha1.ObservabilityIndicant) string {
 	return ns + "-" + name
 }
 
+// getTargetName returns the name of the resource which obi point to.
+// If TargetRef.Name is empty, the TargetItem of the first metric is used instead.
+func getTargetName(obi *schedv1alpha1.ObservabilityIndicant) string {
+	if obi.Spec.TargetRef.Name != "" {
+		return obi.Spec.TargetRef.Name
+	}
+	for _, m := range obi.Status.Metrics {
+		if len(m) == 0 {
+			return ""
+		}
+		return m[0].TargetItem
+	}
+	return ""
+}
+
+func getTargetNamespace(obi *schedv1alpha1.ObservabilityIndicant) string {
+	if obi.Spec.TargetRef.Namespace != "" {
+		return obi.Spec.TargetRef.Namespace
+	}
+	return obi.Namespace
+}
+
+func getPodKey(namespace, name string) string {
+	return namespace + "/" + name
+}
+
 func IsResourceNode(o schedv1alpha1.ObservabilityIndicantSpecTargetRef) bool {
-	return o.Kind == "Node" && o.Group == v1.GroupName && o.Version == "v1"
+	return targetKindOf(o) == NodeTargetKind
 }
 
 func IsResourcePod(o schedv1alpha1.ObservabilityIndicantSpecTargetRef) bool {
-	return o.Kind == "Pod" && o.Group == v1.GroupName && o.Version == "v1"
+	return targetKindOf(o) == PodTargetKind
 }
 
+var (
+	// serviceAccountNamespaceFile is read only once by SchedulerNamespace, see schedulerNamespaceOnce.
+	serviceAccountNamespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
+	schedulerNamespaceOnce      sync.Once
+	serviceAccountNamespace     string
+)
+
 func SchedulerNamespace() string {
 	// Assumes have set the POD_NAMESPACE environment variable using the downward API.
 	if ns, ok := os.LookupEnv("POD_NAMESPACE"); ok {
 		return ns
 	}
-	// Fall back to the namespace associated with the service account token, if available
-	if data, err := os.ReadFile("/var/run/secrets/kubernetes.io/serviceaccount/namespace"); err == nil {
-		if ns := strings.TrimSpace(string(data)); len(ns) > 0 {
-			return ns
+	// the namespace of a pod never changes, no need to read the file on every scheduling cycle.
+	schedulerNamespaceOnce.Do(func() {
+		// Fall back to scheduler most likely to exist ns system-ns
+		serviceAccountNamespace = metav1.NamespaceSystem
+		// Fall back to the namespace associated with the service account token, if available
+		if data, err := os.ReadFile(serviceAccountNamespaceFile); err == nil {
+			if ns := strings.TrimSpace(string(data)); len(ns) > 0 {
+				serviceAccountNamespace = ns
+			}
 		}
-	}
-	// Fall back to scheduler most likely to exist ns system-ns
-	return metav1.NamespaceSystem
+	})
+	return serviceAccountNamespace
 }
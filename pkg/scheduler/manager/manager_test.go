@@ -0,0 +1,1344 @@
+/*
+Copyright 2022 The Arbiter Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog/v2"
+	"k8s.io/klog/v2/ktesting"
+
+	schedv1alpha1 "github.com/kube-arbiter/arbiter/pkg/apis/v1alpha1"
+	"github.com/kube-arbiter/arbiter/pkg/generated/clientset/versioned/fake"
+)
+
+func newTestManager(t testing.TB, opts ...Option) *manager {
+	t.Helper()
+	factory := informers.NewSharedInformerFactory(kubefake.NewSimpleClientset(), 0)
+	return NewManager(fake.NewSimpleClientset(), nil, factory.Core().V1().Pods(), factory.Core().V1().Nodes(), opts...)
+}
+
+func newRecords(values ...string) []schedv1alpha1.Record {
+	records := make([]schedv1alpha1.Record, 0, len(values))
+	for i, v := range values {
+		records = append(records, schedv1alpha1.Record{Timestamp: int64(i+1) * 60000, Value: v})
+	}
+	return records
+}
+
+func newNodeOBI(name, nodeName string, metrics map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo) *schedv1alpha1.ObservabilityIndicant {
+	return &schedv1alpha1.ObservabilityIndicant{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+		Spec: schedv1alpha1.ObservabilityIndicantSpec{
+			TargetRef: schedv1alpha1.ObservabilityIndicantSpecTargetRef{
+				Group:   v1.GroupName,
+				Version: "v1",
+				Kind:    "Node",
+				Name:    nodeName,
+			},
+		},
+		Status: schedv1alpha1.ObservabilityIndicantStatus{Metrics: metrics},
+	}
+}
+
+func getNodeMetric(t *testing.T, mgr *manager, obi *schedv1alpha1.ObservabilityIndicant, nodeName, metricType string) FullMetrics {
+	t.Helper()
+	data, err := mgr.GetNodeOBI(context.Background(), nodeName)
+	if err != nil {
+		t.Fatalf("GetNodeOBI(%s) get err: %v", nodeName, err)
+	}
+	o, ok := data[getMetricCacheKey(obi)]
+	if !ok {
+		t.Fatalf("obi %s not found for node %s", getMetricCacheKey(obi), nodeName)
+	}
+	m, ok := o.Metric[metricType]
+	if !ok {
+		t.Fatalf("metric %s not found for node %s", metricType, nodeName)
+	}
+	return m
+}
+
+func TestObservabilityIndicantAddMin(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		values []string
+		expMin float64
+		expMax float64
+	}{
+		{name: "positive", values: []string{"3", "5", "2"}, expMin: 2, expMax: 5},
+		{name: "negative", values: []string{"3", "-5", "2"}, expMin: -5, expMax: 3},
+		{name: "all negative", values: []string{"-3", "-5", "-2"}, expMin: -5, expMax: -2},
+		{name: "single negative", values: []string{"-1.5"}, expMin: -1.5, expMax: -1.5},
+		{name: "negative after unparseable", values: []string{"bad", "-4", "-7"}, expMin: -7, expMax: -4},
+		{name: "skip unparseable", values: []string{"bad", "3", "xx", "4"}, expMin: 3, expMax: 4},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			mgr := newTestManager(t)
+			obi := newNodeOBI("obi", "node1", map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo{
+				"cpu": {{Records: newRecords(tc.values...)}},
+			})
+			mgr.ObservabilityIndicantAdd(obi)
+			m := getNodeMetric(t, mgr, obi, "node1", "cpu")
+			if m.Min != tc.expMin {
+				t.Fatalf("expect min %v get %v", tc.expMin, m.Min)
+			}
+			if m.Max != tc.expMax {
+				t.Fatalf("expect max %v get %v", tc.expMax, m.Max)
+			}
+		})
+	}
+}
+
+func TestObservabilityIndicantAddAllUnparseable(t *testing.T) {
+	mgr := newTestManager(t)
+	obi := newNodeOBI("obi", "node1", map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo{
+		"cpu": {{Records: newRecords("a", "b", "c")}},
+		"mem": {{Records: newRecords("1", "3")}},
+	})
+	mgr.ObservabilityIndicantAdd(obi)
+	data, err := mgr.GetNodeOBI(context.Background(), "node1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for metricType, m := range data[getMetricCacheKey(obi)].Metric {
+		if math.IsNaN(m.Avg) {
+			t.Fatalf("metric %s get NaN avg", metricType)
+		}
+	}
+	if _, ok := data[getMetricCacheKey(obi)].Metric["cpu"]; ok {
+		t.Fatalf("expect cpu skipped")
+	}
+	if m := getNodeMetric(t, mgr, obi, "node1", "mem"); m.Avg != 2 {
+		t.Fatalf("expect mem avg 2 get %v", m.Avg)
+	}
+}
+
+func newScore(namespace, name string, weight int64, logic string) *schedv1alpha1.Score {
+	return &schedv1alpha1.Score{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+		Spec:       schedv1alpha1.ScoreSpec{Weight: weight, Logic: logic},
+	}
+}
+
+func TestScoreDeleteNamespaceNotInCache(t *testing.T) {
+	mgr := newTestManager(t)
+	mgr.ScoreAdd(newScore("ns1", "score1", 1, "function score(){return 1}"))
+	// ns2 never get an add event, delete should not panic.
+	mgr.ScoreDelete(newScore("ns2", "score1", 1, "function score(){return 1}"))
+	if _, ok := mgr.score["ns1"]; !ok {
+		t.Fatalf("expect ns1 score cache still exist")
+	}
+}
+
+func newPodOBI(name, podNamespace, podName string, metrics map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo) *schedv1alpha1.ObservabilityIndicant {
+	return &schedv1alpha1.ObservabilityIndicant{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+		Spec: schedv1alpha1.ObservabilityIndicantSpec{
+			TargetRef: schedv1alpha1.ObservabilityIndicantSpecTargetRef{
+				Group:     v1.GroupName,
+				Version:   "v1",
+				Kind:      "Pod",
+				Namespace: podNamespace,
+				Name:      podName,
+			},
+		},
+		Status: schedv1alpha1.ObservabilityIndicantStatus{Metrics: metrics},
+	}
+}
+
+func TestGetPodOBI(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		obi  *schedv1alpha1.ObservabilityIndicant
+	}{
+		{
+			name: "named pod",
+			obi: newPodOBI("obi", "ns1", "pod1", map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo{
+				"cpu": {{Records: newRecords("1", "3")}},
+			}),
+		},
+		{
+			name: "pod from target item",
+			obi: newPodOBI("obi", "ns1", "", map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo{
+				"cpu": {{TargetItem: "pod1", Records: newRecords("1", "3")}},
+			}),
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			mgr := newTestManager(t)
+			mgr.ObservabilityIndicantAdd(tc.obi)
+			pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "ns1", Name: "pod1"}}
+			data, err := mgr.GetPodOBI(context.Background(), pod)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if m := data[getMetricCacheKey(tc.obi)].Metric["cpu"]; m.Avg != 2 || m.Max != 3 || m.Min != 1 {
+				t.Fatalf("unexpected pod metric %+v", m)
+			}
+			if _, err := mgr.GetPodOBI(context.Background(), &v1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "ns2", Name: "pod1"}}); !errors.Is(err, ErrNotFoundInCache) {
+				t.Fatalf("expect ErrNotFoundInCache get %v", err)
+			}
+			mgr.ObservabilityIndicantDelete(tc.obi)
+			if _, err := mgr.GetPodOBI(context.Background(), pod); !errors.Is(err, ErrNotFoundInCache) {
+				t.Fatalf("expect ErrNotFoundInCache after delete get %v", err)
+			}
+		})
+	}
+}
+
+func TestGetPodOBINoData(t *testing.T) {
+	mgr := newTestManager(t)
+	mgr.ObservabilityIndicantAdd(newPodOBI("obi", "ns1", "pod1", nil))
+	mgr.ObservabilityIndicantAdd(newPodOBI("obi", "ns1", "", map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo{"cpu": {}}))
+	if len(mgr.podMetric) != 0 {
+		t.Fatalf("expect no pod cached get %d", len(mgr.podMetric))
+	}
+}
+
+func TestConcurrentObservabilityIndicantAddAndGet(t *testing.T) {
+	mgr := newTestManager(t)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				mgr.ObservabilityIndicantAdd(newNodeOBI(fmt.Sprintf("obi-%d", j%3), fmt.Sprintf("node%d", i%3), map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo{
+					"cpu": {{Records: newRecords("1", "2", strconv.Itoa(j))}},
+				}))
+			}
+		}(i)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				data, _ := mgr.GetNodeOBI(context.Background(), fmt.Sprintf("node%d", i%3))
+				for _, o := range data {
+					for _, m := range o.Metric {
+						_ = m.Avg
+					}
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+	for i := 0; i < 3; i++ {
+		if _, err := mgr.GetNodeOBI(context.Background(), fmt.Sprintf("node%d", i)); err != nil {
+			t.Fatalf("node%d get err %v", i, err)
+		}
+	}
+}
+
+func TestGetAllNodeOBIs(t *testing.T) {
+	mgr := newTestManager(t)
+	for i, node := range []string{"node1", "node2", "node3"} {
+		mgr.ObservabilityIndicantAdd(newNodeOBI("cpu", node, map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo{
+			"cpu": {{Records: newRecords(strconv.Itoa(i * 10))}},
+		}))
+	}
+	mgr.ObservabilityIndicantAdd(newPodOBI("cpu", "ns1", "pod1", map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo{
+		"cpu": {{Records: newRecords("1")}},
+	}))
+	all, err := mgr.GetAllNodeOBIs(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 3 {
+		t.Fatalf("expect OBI of 3 nodes get %v", all)
+	}
+	for i, node := range []string{"node1", "node2", "node3"} {
+		if m := all[node]["default-cpu"].Metric["cpu"]; m.Avg != float64(i*10) {
+			t.Fatalf("expect cpu of %s %d get %+v", node, i*10, m)
+		}
+	}
+	// the result is a copy, changing it does not change the cache.
+	delete(all["node1"]["default-cpu"].Metric, "cpu")
+	if m := getNodeMetric(t, mgr, newNodeOBI("cpu", "node1", nil), "node1", "cpu"); m.Count != 1 {
+		t.Fatalf("expect cache not modified get %+v", m)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := mgr.GetAllNodeOBIs(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expect canceled get %v", err)
+	}
+}
+
+func TestObservabilityIndicantDeleteKeepOtherOBI(t *testing.T) {
+	mgr := newTestManager(t)
+	obi1 := newNodeOBI("obi1", "node1", map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo{
+		"cpu": {{Records: newRecords("1", "3")}},
+	})
+	obi2 := newNodeOBI("obi2", "node1", map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo{
+		"mem": {{Records: newRecords("4", "6")}},
+	})
+	mgr.ObservabilityIndicantAdd(obi1)
+	mgr.ObservabilityIndicantAdd(obi2)
+	mgr.ObservabilityIndicantDelete(obi1)
+	data, err := mgr.GetNodeOBI(context.Background(), "node1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := data[getMetricCacheKey(obi1)]; ok {
+		t.Fatalf("expect obi1 deleted")
+	}
+	if m := getNodeMetric(t, mgr, obi2, "node1", "mem"); m.Avg != 5 {
+		t.Fatalf("expect obi2 mem avg 5 get %v", m.Avg)
+	}
+	mgr.ObservabilityIndicantDelete(obi2)
+	if _, err := mgr.GetNodeOBI(context.Background(), "node1"); !errors.Is(err, ErrNotFoundInCache) {
+		t.Fatalf("expect ErrNotFoundInCache get %v", err)
+	}
+}
+
+func TestDeleteTombstone(t *testing.T) {
+	mgr := newTestManager(t)
+	obi := newNodeOBI("obi", "node1", map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo{
+		"cpu": {{Records: newRecords("1")}},
+	})
+	mgr.ObservabilityIndicantAdd(obi)
+	mgr.ObservabilityIndicantDelete(cache.DeletedFinalStateUnknown{Key: "default/obi", Obj: obi})
+	if _, err := mgr.GetNodeOBI(context.Background(), "node1"); !errors.Is(err, ErrNotFoundInCache) {
+		t.Fatalf("expect obi deleted by tombstone get %v", err)
+	}
+
+	score := newScore("ns1", "score1", 1, "function score(){return 1}")
+	mgr.ScoreAdd(score)
+	mgr.ScoreDelete(cache.DeletedFinalStateUnknown{Key: "ns1/score1", Obj: score})
+	if _, ok := mgr.GetScoreByName(context.Background(), "ns1", "score1"); ok {
+		t.Fatalf("expect score deleted by tombstone")
+	}
+	invalid := newScore("ns1", "invalid", 1, "function score(){")
+	mgr.ScoreAdd(invalid)
+	mgr.ScoreDelete(cache.DeletedFinalStateUnknown{Key: "ns1/invalid", Obj: invalid})
+	if err := mgr.GetScoreError("ns1", "invalid"); err != nil {
+		t.Fatalf("expect compile error of invalid score deleted by tombstone get %v", err)
+	}
+}
+
+func TestGetNodeOBIInRange(t *testing.T) {
+	mgr := newTestManager(t)
+	// timestamps are 1min, 2min, 3min and 4min.
+	obi := newNodeOBI("obi", "node1", map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo{
+		"cpu": {{Records: newRecords("100", "2", "4", "6")}},
+		"mem": {{Records: newRecords("1")}},
+	})
+	mgr.ObservabilityIndicantAdd(obi)
+	data, err := mgr.GetNodeOBIInRange(context.Background(), "node1", time.UnixMilli(2*60000), time.UnixMilli(4*60000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, ok := data[getMetricCacheKey(obi)].Metric["cpu"]
+	if !ok {
+		t.Fatalf("expect cpu in range")
+	}
+	if len(m.Records) != 3 || m.Max != 6 || m.Min != 2 || m.Avg != 4 {
+		t.Fatalf("unexpected metric in range %+v", m)
+	}
+	if _, ok := data[getMetricCacheKey(obi)].Metric["mem"]; ok {
+		t.Fatalf("expect mem out of range")
+	}
+	if full := getNodeMetric(t, mgr, obi, "node1", "cpu"); len(full.Records) != 4 || full.Max != 100 {
+		t.Fatalf("cached metric should not be changed %+v", full)
+	}
+	if _, err := mgr.GetNodeOBIInRange(context.Background(), "node2", time.Time{}, time.Now()); !errors.Is(err, ErrNotFoundInCache) {
+		t.Fatalf("expect ErrNotFoundInCache get %v", err)
+	}
+}
+
+func scoreNames(res []ScoreResult) []string {
+	names := make([]string, 0, len(res))
+	for _, r := range res {
+		names = append(names, r.NameKey)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestGetScoreNamespaceFallback(t *testing.T) {
+	t.Setenv("POD_NAMESPACE", "arbiter")
+	for _, tc := range []struct {
+		name     string
+		opts     []Option
+		scores   []*schedv1alpha1.Score
+		exp      []string
+		expTotal int64
+	}{
+		{
+			name:     "fallback to scheduler namespace",
+			scores:   []*schedv1alpha1.Score{newScore("arbiter", "score1", 2, "function score(){return 1}")},
+			exp:      []string{"arbiter/score1"},
+			expTotal: 2,
+		},
+		{
+			name:     "fallback to kube-system",
+			scores:   []*schedv1alpha1.Score{newScore(metav1.NamespaceSystem, "score1", 3, "function score(){return 1}")},
+			exp:      []string{"kube-system/score1"},
+			expTotal: 3,
+		},
+		{
+			name:   "fallback disabled",
+			opts:   []Option{WithNamespaceFallback(false)},
+			scores: []*schedv1alpha1.Score{newScore(metav1.NamespaceSystem, "score1", 3, "function score(){return 1}")},
+			exp:    []string{},
+		},
+		{
+			name: "fallback disabled with score in namespace",
+			opts: []Option{WithNamespaceFallback(false)},
+			scores: []*schedv1alpha1.Score{
+				newScore("ns1", "score1", 1, "function score(){return 1}"),
+				newScore(metav1.NamespaceSystem, "score1", 3, "function score(){return 1}"),
+			},
+			exp:      []string{"ns1/score1"},
+			expTotal: 1,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			mgr := newTestManager(t, tc.opts...)
+			for _, s := range tc.scores {
+				mgr.ScoreAdd(s)
+			}
+			res, total := mgr.GetScore(context.Background(), "ns1")
+			if names := scoreNames(res); !reflect.DeepEqual(tc.exp, names) {
+				t.Fatalf("expect %v get %v", tc.exp, names)
+			}
+			if total != tc.expTotal {
+				t.Fatalf("expect total weight %d get %d", tc.expTotal, total)
+			}
+		})
+	}
+}
+
+func TestGetScoreMerge(t *testing.T) {
+	t.Setenv("POD_NAMESPACE", "arbiter")
+	mgr := newTestManager(t, WithScoreMerge(true), WithFallbackNamespaces("policy", metav1.NamespaceSystem))
+	mgr.ScoreAdd(newScore("policy", "base", 2, "function score(){return 1}"))
+	mgr.ScoreAdd(newScore("policy", "shared", 3, "function score(){return 1}"))
+	mgr.ScoreAdd(newScore("policy", "disabled", 4, "function score(){return 1}"))
+	mgr.ScoreAdd(newScore(metav1.NamespaceSystem, "base", 5, "function score(){return 1}"))
+	mgr.ScoreAdd(newScore(metav1.NamespaceSystem, "system", 1, "function score(){return 1}"))
+	mgr.ScoreAdd(newScore("ns1", "shared", 7, "function score(){return 2}"))
+	mgr.ScoreAdd(newScore("ns1", "disabled", 0, "function score(){return 2}"))
+
+	res, total, skipped := mgr.GetScoreWithDiagnostics(context.Background(), "ns1")
+	if exp, names := []string{"kube-system/system", "ns1/shared", "policy/base"}, scoreNames(res); !reflect.DeepEqual(exp, names) {
+		t.Fatalf("expect %v get %v", exp, names)
+	}
+	if total != 10 {
+		t.Fatalf("expect total weight 10 get %d", total)
+	}
+	if exp, names := []string{"ns1/disabled"}, scoreNames(skipped); !reflect.DeepEqual(exp, names) {
+		t.Fatalf("expect skipped %v get %v", exp, names)
+	}
+
+	// a namespace without Score gets the union of the chain.
+	res, total = mgr.GetScore(context.Background(), "ns2")
+	if exp, names := []string{"kube-system/system", "policy/base", "policy/disabled", "policy/shared"}, scoreNames(res); !reflect.DeepEqual(exp, names) {
+		t.Fatalf("expect %v get %v", exp, names)
+	}
+	if total != 10 {
+		t.Fatalf("expect total weight 10 get %d", total)
+	}
+
+	// merge does nothing without fallback.
+	WithNamespaceFallback(false)(mgr)
+	if res, _ := mgr.GetScore(context.Background(), "ns1"); !reflect.DeepEqual([]string{"ns1/shared"}, scoreNames(res)) {
+		t.Fatalf("expect only ns1 score get %v", scoreNames(res))
+	}
+}
+
+// TestGetScoreConcurrentMutation evaluates the Score got by GetScore while Score and OBI are being added
+// and deleted, run it with -race.
+func TestGetScoreConcurrentMutation(t *testing.T) {
+	mgr := newTestManager(t, WithNamespaceFallback(false))
+	mgr.ScoreAdd(newScore("ns1", "stable", 1, "function score(){return 50}"))
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; ; i++ {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			score := newScore("ns1", fmt.Sprintf("churn%d", i%3), 1, "function score(){return 50}")
+			mgr.ScoreAdd(score)
+			mgr.ScoreDelete(score)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; ; i++ {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			mgr.ObservabilityIndicantAdd(newNodeOBI("cpu", "node1", map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo{
+				"cpu": {{Records: newRecords(strconv.Itoa(i))}},
+			}))
+		}
+	}()
+
+	pod := &PodWithOBI{Pod: v1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "ns1", Name: "pod1"}}}
+	for i := 0; i < 200; i++ {
+		res, total, _ := mgr.GetScoreWithDiagnostics(context.Background(), "ns1")
+		if total != int64(len(res)) {
+			t.Fatalf("expect total weight of the returned Score %d get %d", len(res), total)
+		}
+		obi, _ := mgr.GetNodeOBI(context.Background(), "node1")
+		node := NewNodeWithOBI(&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}}, obi)
+		for _, r := range res {
+			if result, err := EvaluateScoreResultInCluster(r, pod, node, ClusterMetrics{}); err != nil || result != 50 {
+				t.Fatalf("expect %s evaluated to 50 get %d %v", r.NameKey, result, err)
+			}
+		}
+	}
+	close(done)
+	wg.Wait()
+}
+
+func TestGetScoreWithDiagnostics(t *testing.T) {
+	mgr := newTestManager(t)
+	mgr.ScoreAdd(newScore("ns1", "valid1", 1, "function score(){return 1}"))
+	mgr.ScoreAdd(newScore("ns1", "valid2", 2, "function score(){return 2}"))
+	mgr.ScoreAdd(newScore("ns1", "blank", 1, "  "))
+	mgr.ScoreAdd(newScore("ns1", "zero", 0, "function score(){return 1}"))
+	res, total, skipped := mgr.GetScoreWithDiagnostics(context.Background(), "ns1")
+	if names := scoreNames(res); !reflect.DeepEqual([]string{"ns1/valid1", "ns1/valid2"}, names) {
+		t.Fatalf("unexpected valid scores %v", names)
+	}
+	if total != 3 {
+		t.Fatalf("expect total weight 3 get %d", total)
+	}
+	if names := scoreNames(skipped); !reflect.DeepEqual([]string{"ns1/blank", "ns1/zero"}, names) {
+		t.Fatalf("unexpected skipped scores %v", names)
+	}
+	for _, s := range skipped {
+		switch s.NameKey {
+		case "ns1/blank":
+			if !errors.Is(s.Err, ErrNoLogic) {
+				t.Fatalf("expect ErrNoLogic get %v", s.Err)
+			}
+		case "ns1/zero":
+			if !errors.Is(s.Err, ErrInvalidWeight) {
+				t.Fatalf("expect ErrInvalidWeight get %v", s.Err)
+			}
+		}
+	}
+	if res2, total2 := mgr.GetScore(context.Background(), "ns1"); len(res2) != 2 || total2 != 3 {
+		t.Fatalf("GetScore should keep valid scores, get %v %d", res2, total2)
+	}
+}
+
+func TestMetricTTL(t *testing.T) {
+	mgr := newTestManager(t, WithMetricTTL(50*time.Millisecond, time.Minute))
+	obi := newNodeOBI("obi", "node1", map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo{
+		"cpu": {{Records: newRecords("1")}},
+	})
+	mgr.ObservabilityIndicantAdd(obi)
+	mgr.ScoreAdd(newScore("ns1", "score1", 1, "function score(){return 1}"))
+	getNodeMetric(t, mgr, obi, "node1", "cpu")
+	time.Sleep(100 * time.Millisecond)
+	if _, err := mgr.GetNodeOBI(context.Background(), "node1"); !errors.Is(err, ErrNotFoundInCache) {
+		t.Fatalf("expect ErrNotFoundInCache after expiry get %v", err)
+	}
+	if res, _ := mgr.GetScore(context.Background(), "ns1"); len(res) != 1 {
+		t.Fatalf("score should not expire, get %v", res)
+	}
+}
+
+func TestGetNodeMetric(t *testing.T) {
+	now := time.Now()
+	newEndTimeOBI := func(name string, endTime time.Time, values ...string) *schedv1alpha1.ObservabilityIndicant {
+		return newNodeOBI(name, "node1", map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo{
+			"cpu": {{Records: newRecords(values...), EndTime: metav1.NewTime(endTime)}},
+		})
+	}
+	mgr := newTestManager(t)
+	mgr.ObservabilityIndicantAdd(newEndTimeOBI("obi-old", now.Add(-time.Minute), "1"))
+	mgr.ObservabilityIndicantAdd(newEndTimeOBI("obi-new", now, "5"))
+	mgr.ObservabilityIndicantAdd(newNodeOBI("obi-mem", "node1", map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo{
+		"mem": {{Records: newRecords("7")}},
+	}))
+
+	m, err := mgr.GetNodeMetric(context.Background(), "node1", "cpu")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Avg != 5 {
+		t.Fatalf("expect the newest cpu metric, get %+v", m)
+	}
+	if m, err = mgr.GetNodeMetric(context.Background(), "node1", "mem"); err != nil || m.Avg != 7 {
+		t.Fatalf("expect mem avg 7 get %+v %v", m, err)
+	}
+	if _, err = mgr.GetNodeMetric(context.Background(), "node1", "disk"); !errors.Is(err, ErrNotFoundInCache) {
+		t.Fatalf("expect ErrNotFoundInCache for missing metric get %v", err)
+	}
+	if _, err = mgr.GetNodeMetric(context.Background(), "node2", "cpu"); !errors.Is(err, ErrNotFoundInCache) {
+		t.Fatalf("expect ErrNotFoundInCache for missing node get %v", err)
+	}
+
+	// same EndTime, the first OBI key in lexical order wins.
+	mgr = newTestManager(t)
+	mgr.ObservabilityIndicantAdd(newEndTimeOBI("obi-b", now, "2"))
+	mgr.ObservabilityIndicantAdd(newEndTimeOBI("obi-a", now, "1"))
+	if m, err = mgr.GetNodeMetric(context.Background(), "node1", "cpu"); err != nil || m.Avg != 1 {
+		t.Fatalf("expect obi-a win the tie, get %+v %v", m, err)
+	}
+}
+
+func TestGetNodeOBIForMetrics(t *testing.T) {
+	mgr := newTestManager(t)
+	mgr.ObservabilityIndicantAdd(newNodeOBI("obi-cpu", "node1", map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo{
+		"cpu": {{Records: newRecords("1")}},
+		"mem": {{Records: newRecords("2")}},
+	}))
+	mgr.ObservabilityIndicantAdd(newNodeOBI("obi-disk", "node1", map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo{
+		"disk": {{Records: newRecords("3")}},
+	}))
+	ctx := context.Background()
+
+	obi, err := mgr.GetNodeOBIForMetrics(ctx, "node1", "cpu", "gpu")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(obi) != 1 || len(obi["default-obi-cpu"].Metric) != 1 || obi["default-obi-cpu"].Metric["cpu"].Avg != 1 {
+		t.Fatalf("expect only cpu of obi-cpu get %+v", obi)
+	}
+	if obi, err = mgr.GetNodeOBIForMetrics(ctx, "node1", "cpu", "disk"); err != nil || len(obi) != 2 || obi["default-obi-disk"].Metric["disk"].Avg != 3 {
+		t.Fatalf("expect cpu and disk of both OBI get %+v %v", obi, err)
+	}
+	if obi, err = mgr.GetNodeOBIForMetrics(ctx, "node1", "gpu"); err != nil || obi == nil || len(obi) != 0 {
+		t.Fatalf("expect empty map without error get %+v %v", obi, err)
+	}
+	if _, err = mgr.GetNodeOBIForMetrics(ctx, "node2", "cpu"); !errors.Is(err, ErrNotFoundInCache) {
+		t.Fatalf("expect ErrNotFoundInCache for missing node get %v", err)
+	}
+}
+
+func TestNodesWithMetric(t *testing.T) {
+	mgr := newTestManager(t)
+	metrics := func(metricTypes ...string) map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo {
+		res := make(map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo, len(metricTypes))
+		for _, metricType := range metricTypes {
+			res[metricType] = []schedv1alpha1.ObservabilityIndicantStatusMetricInfo{{Records: newRecords("1")}}
+		}
+		return res
+	}
+	mgr.ObservabilityIndicantAdd(newNodeOBI("cpu", "node3", metrics("cpu", "gpu_utilization")))
+	mgr.ObservabilityIndicantAdd(newNodeOBI("cpu", "node1", metrics("cpu")))
+	mgr.ObservabilityIndicantAdd(newNodeOBI("gpu", "node1", metrics("gpu_utilization")))
+	mgr.ObservabilityIndicantAdd(newNodeOBI("cpu", "node2", metrics("cpu", "mem")))
+	mgr.ObservabilityIndicantAdd(newPodOBI("gpu", "ns1", "pod1", metrics("gpu_utilization")))
+
+	for metricType, exp := range map[string][]string{
+		"gpu_utilization": {"node1", "node3"},
+		"cpu":             {"node1", "node2", "node3"},
+		"mem":             {"node2"},
+		"disk":            nil,
+	} {
+		if nodes := mgr.NodesWithMetric(metricType); !reflect.DeepEqual(exp, nodes) {
+			t.Fatalf("expect nodes %v with %s get %v", exp, metricType, nodes)
+		}
+	}
+}
+
+func TestNodeMetricTypes(t *testing.T) {
+	mgr := newTestManager(t)
+	mgr.ObservabilityIndicantAdd(newNodeOBI("cpu", "node1", map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo{
+		"cpu": {{Records: newRecords("1")}},
+		"mem": {{Records: newRecords("1")}},
+	}))
+	mgr.ObservabilityIndicantAdd(newNodeOBI("mem", "node1", map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo{
+		"mem": {{Records: newRecords("2")}},
+	}))
+	if metricTypes := mgr.NodeMetricTypes("node1"); !reflect.DeepEqual([]string{"cpu", "mem"}, metricTypes) {
+		t.Fatalf("expect cpu and mem get %v", metricTypes)
+	}
+	if metricTypes := mgr.NodeMetricTypes("node2"); metricTypes != nil {
+		t.Fatalf("expect nil for unknown node get %v", metricTypes)
+	}
+}
+
+func TestGetNodeMetricsConflict(t *testing.T) {
+	now := time.Now()
+	newEndTimeOBI := func(name string, endTime time.Time, value string) *schedv1alpha1.ObservabilityIndicant {
+		return newNodeOBI(name, "node1", map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo{
+			"cpu": {{Records: newRecords(value), EndTime: metav1.NewTime(endTime)}},
+		})
+	}
+	mgr := newTestManager(t)
+	mgr.ObservabilityIndicantAdd(newEndTimeOBI("obi-a", now.Add(-time.Minute), "1"))
+	mgr.ObservabilityIndicantAdd(newEndTimeOBI("obi-b", now, "5"))
+	mgr.ObservabilityIndicantAdd(newEndTimeOBI("obi-c", now, "9"))
+
+	metrics, err := mgr.GetNodeMetrics(context.Background(), "node1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// obi-b and obi-c are both newer than obi-a, obi-b wins the tie.
+	if len(metrics) != 1 || metrics["cpu"].Avg != 5 {
+		t.Fatalf("expect only cpu of obi-b, get %+v", metrics)
+	}
+	if m, _ := mgr.GetNodeMetric(context.Background(), "node1", "cpu"); m.Avg != metrics["cpu"].Avg {
+		t.Fatalf("expect GetNodeMetric agree with GetNodeMetrics, get %+v", m)
+	}
+	obi, _ := mgr.GetNodeOBI(context.Background(), "node1")
+	score, err := EvaluateLogic("function score() { return node.metric.cpu.avg; }", "ns1/score",
+		&PodWithOBI{}, &NodeWithOBI{OBI: obi, Metric: MergeOBIMetrics(obi)})
+	if err != nil || score != 5 {
+		t.Fatalf("expect score 5 from node.metric get %d %v", score, err)
+	}
+	if _, err = mgr.GetNodeMetrics(context.Background(), "node2"); !errors.Is(err, ErrNotFoundInCache) {
+		t.Fatalf("expect ErrNotFoundInCache for missing node get %v", err)
+	}
+}
+
+func TestObservabilityIndicantAddEvent(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		obi       *schedv1alpha1.ObservabilityIndicant
+		expReason string
+	}{
+		{
+			name:      "no metric data",
+			obi:       newNodeOBI("obi", "node1", nil),
+			expReason: NoMetricDataEventReason,
+		},
+		{
+			name: "unresolved target",
+			obi: newNodeOBI("obi", "", map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo{
+				"cpu": {{Records: newRecords("1")}},
+			}),
+			expReason: UnresolvedTargetEventReason,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			recorder := record.NewFakeRecorder(10)
+			mgr := newTestManager(t, WithEventRecorder(recorder))
+			mgr.ObservabilityIndicantAdd(tc.obi)
+			select {
+			case e := <-recorder.Events:
+				if !strings.Contains(e, tc.expReason) {
+					t.Fatalf("expect event reason %s get %s", tc.expReason, e)
+				}
+			default:
+				t.Fatalf("expect an event")
+			}
+		})
+	}
+	// no recorder, no panic.
+	newTestManager(t).ObservabilityIndicantAdd(newNodeOBI("obi", "node1", nil))
+}
+
+func TestListAllScores(t *testing.T) {
+	t.Setenv("POD_NAMESPACE", "arbiter")
+	mgr := newTestManager(t)
+	mgr.ScoreAdd(newScore("ns1", "score1", 1, "function score(){return 1}"))
+	mgr.ScoreAdd(newScore("ns1", "score2", 2, "function score(){return 1}"))
+	mgr.ScoreAdd(newScore("ns2", "score1", 1, "function score(){return 1}"))
+	mgr.ScoreAdd(newScore("ns2", "invalid", 0, "function score(){return 1}"))
+	mgr.ScoreAdd(newScore("arbiter", "score1", 1, "function score(){return 1}"))
+	mgr.ScoreAdd(newScore("ns3", "blank", 1, ""))
+	all := mgr.ListAllScores(context.Background())
+	get := make(map[string][]string, len(all))
+	for ns, res := range all {
+		get[ns] = scoreNames(res)
+	}
+	exp := map[string][]string{
+		"ns1":     {"ns1/score1", "ns1/score2"},
+		"ns2":     {"ns2/score1"},
+		"arbiter": {"arbiter/score1"},
+	}
+	if !reflect.DeepEqual(exp, get) {
+		t.Fatalf("expect %v get %v", exp, get)
+	}
+}
+
+func TestRangeScores(t *testing.T) {
+	mgr := newTestManager(t)
+	mgr.ScoreAdd(newScore("ns1", "score1", 1, "function score(){return 1}"))
+	mgr.ScoreAdd(newScore("ns1", "score2", 2, "function score(){return 2}"))
+	mgr.ScoreAdd(newScore("ns2", "score1", 3, "function score(){return 3}"))
+	mgr.ScoreAdd(newScore("ns2", "invalid", 0, "function score(){return 1}"))
+
+	exp := map[string]int64{"ns1/score1": 1, "ns1/score2": 2, "ns2/score1": 3}
+	// the order is not specified, so iterate a few times and compare the visited sets.
+	for i := 0; i < 5; i++ {
+		got := make(map[string]int64)
+		mgr.RangeScores(func(namespace, name string, spec schedv1alpha1.ScoreSpec) bool {
+			got[namespace+"/"+name] = spec.Weight
+			// fn can call the manager, the lock is not held.
+			_, _ = mgr.GetScore(context.Background(), namespace)
+			return true
+		})
+		if !reflect.DeepEqual(exp, got) {
+			t.Fatalf("expect %v get %v", exp, got)
+		}
+	}
+
+	visited := 0
+	mgr.RangeScores(func(namespace, name string, spec schedv1alpha1.ScoreSpec) bool {
+		visited++
+		return visited < 2
+	})
+	if visited != 2 {
+		t.Fatalf("expect iteration stopped after 2 Score get %d", visited)
+	}
+}
+
+func TestScoreAddInvalidLogic(t *testing.T) {
+	recorder := record.NewFakeRecorder(10)
+	mgr := newTestManager(t, WithNamespaceFallback(false), WithEventRecorder(recorder))
+	mgr.ScoreAdd(newScore("ns1", "valid", 1, "function score(){return 1}"))
+	mgr.ScoreAdd(newScore("ns1", "malformed", 1, "function score({return 1"))
+
+	res, _ := mgr.GetScore(context.Background(), "ns1")
+	if exp, get := []string{"ns1/valid"}, scoreNames(res); !reflect.DeepEqual(exp, get) {
+		t.Fatalf("expect %v get %v", exp, get)
+	}
+	if err := mgr.GetScoreError("ns1", "valid"); err != nil {
+		t.Fatalf("expect no error for valid score get %v", err)
+	}
+	if err := mgr.GetScoreError("ns1", "malformed"); err == nil {
+		t.Fatalf("expect an error for malformed score")
+	}
+	select {
+	case e := <-recorder.Events:
+		if !strings.Contains(e, InvalidLogicEventReason) {
+			t.Fatalf("expect event reason %s get %s", InvalidLogicEventReason, e)
+		}
+	default:
+		t.Fatalf("expect an event")
+	}
+
+	// an update breaking the logic drops the cached one, fixing it brings it back.
+	mgr.ScoreUpdate(nil, newScore("ns1", "valid", 1, "function score("))
+	if res, _ := mgr.GetScore(context.Background(), "ns1"); len(res) != 0 {
+		t.Fatalf("expect no score left in ns1 get %v", scoreNames(res))
+	}
+	mgr.ScoreUpdate(nil, newScore("ns1", "malformed", 1, "function score(){return 2}"))
+	if err := mgr.GetScoreError("ns1", "malformed"); err != nil {
+		t.Fatalf("expect error cleared after fix get %v", err)
+	}
+	mgr.ScoreDelete(newScore("ns1", "valid", 1, ""))
+	if err := mgr.GetScoreError("ns1", "valid"); err != nil {
+		t.Fatalf("expect error cleared after delete get %v", err)
+	}
+}
+
+func TestSchedulerNamespaceReadOnce(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "namespace")
+	if err := os.WriteFile(file, []byte("arbiter\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	oldFile := serviceAccountNamespaceFile
+	serviceAccountNamespaceFile = file
+	schedulerNamespaceOnce = sync.Once{}
+	t.Cleanup(func() {
+		serviceAccountNamespaceFile = oldFile
+		schedulerNamespaceOnce = sync.Once{}
+	})
+	t.Setenv("POD_NAMESPACE", "")
+	os.Unsetenv("POD_NAMESPACE")
+
+	if ns := SchedulerNamespace(); ns != "arbiter" {
+		t.Fatalf("expect namespace arbiter get %s", ns)
+	}
+	if err := os.WriteFile(file, []byte("changed"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if ns := SchedulerNamespace(); ns != "arbiter" {
+		t.Fatalf("expect namespace file read only once, get %s", ns)
+	}
+	// env var still takes precedence.
+	t.Setenv("POD_NAMESPACE", "env-ns")
+	if ns := SchedulerNamespace(); ns != "env-ns" {
+		t.Fatalf("expect namespace env-ns get %s", ns)
+	}
+}
+
+func TestGetNodeOBIWithAge(t *testing.T) {
+	mgr := newTestManager(t)
+	newest := time.Now().Add(-2 * time.Minute)
+	obi := newNodeOBI("obi", "node1", map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo{
+		"cpu": {{Records: []schedv1alpha1.Record{
+			{Timestamp: newest.Add(-time.Minute).UnixMilli(), Value: "1"},
+			{Timestamp: newest.UnixMilli(), Value: "2"},
+		}}},
+		"mem": {{}},
+	})
+	mgr.ObservabilityIndicantAdd(obi)
+	_, ages, err := mgr.GetNodeOBIWithAge(context.Background(), "node1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := getMetricCacheKey(obi)
+	if age := ages[key]["cpu"]; age < 2*time.Minute || age > 2*time.Minute+10*time.Second {
+		t.Fatalf("expect cpu age around 2m get %v", age)
+	}
+	if age := ages[key]["mem"]; age != UnknownAge {
+		t.Fatalf("expect mem without records has unknown age get %v", age)
+	}
+
+	now := time.Now()
+	m := FullMetrics{}
+	m.EndTime = metav1.NewTime(now.Add(-time.Hour))
+	if age := metricAge(m, now); age != time.Hour {
+		t.Fatalf("expect age from EndTime 1h get %v", age)
+	}
+	if _, _, err := mgr.GetNodeOBIWithAge(context.Background(), "node2"); err == nil {
+		t.Fatalf("expect error for node not in cache")
+	}
+}
+
+// TestConcurrentScoreAndObservabilityIndicantUpdate should be run with -race.
+func TestConcurrentScoreAndObservabilityIndicantUpdate(t *testing.T) {
+	t.Setenv("POD_NAMESPACE", "arbiter")
+	mgr := newTestManager(t)
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(3)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				score := newScore(fmt.Sprintf("ns%d", i%2), fmt.Sprintf("score%d", j%3), int64(j+1), "function score(){return 1}")
+				mgr.ScoreUpdate(nil, score)
+				if j%5 == 0 {
+					mgr.ScoreDelete(score)
+				}
+			}
+		}(i)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				mgr.ObservabilityIndicantUpdate(nil, newNodeOBI(fmt.Sprintf("obi-%d", j%3), fmt.Sprintf("node%d", i%2), map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo{
+					"cpu": {{Records: newRecords("1", strconv.Itoa(j))}},
+				}))
+			}
+		}(i)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				_, _ = mgr.GetScore(context.Background(), fmt.Sprintf("ns%d", i%2))
+				_ = mgr.ListAllScores(context.Background())
+				_, _ = mgr.GetNodeOBI(context.Background(), fmt.Sprintf("node%d", i%2))
+				_ = mgr.Stats()
+			}
+		}(i)
+	}
+	wg.Wait()
+	for i := 0; i < 2; i++ {
+		if res, _ := mgr.GetScore(context.Background(), fmt.Sprintf("ns%d", i)); len(res) == 0 {
+			t.Fatalf("ns%d expect scores left", i)
+		}
+		if _, err := mgr.GetNodeOBI(context.Background(), fmt.Sprintf("node%d", i)); err != nil {
+			t.Fatalf("node%d get err %v", i, err)
+		}
+	}
+}
+
+func TestNotFoundErrorIdentity(t *testing.T) {
+	mgr := newTestManager(t)
+	mgr.ObservabilityIndicantAdd(newNodeOBI("obi", "node1", map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo{
+		"cpu": {{Records: newRecords("1")}},
+	}))
+	_, nodeErr := mgr.GetNodeOBI(context.Background(), "missing-node")
+	_, metricErr := mgr.GetNodeMetric(context.Background(), "node1", "disk")
+	_, podErr := mgr.GetPodOBI(context.Background(), &v1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "ns1", Name: "missing-pod"}})
+	for _, tc := range []struct {
+		err      error
+		contains []string
+	}{
+		{err: nodeErr, contains: []string{"missing-node"}},
+		{err: metricErr, contains: []string{"node1", "disk"}},
+		{err: podErr, contains: []string{"ns1/missing-pod"}},
+	} {
+		if !errors.Is(tc.err, ErrNotFoundInCache) {
+			t.Fatalf("expect %v is ErrNotFoundInCache", tc.err)
+		}
+		for _, s := range tc.contains {
+			if !strings.Contains(tc.err.Error(), s) {
+				t.Fatalf("expect %q contains %q", tc.err, s)
+			}
+		}
+	}
+}
+
+func TestRegisterOnMetricUpdate(t *testing.T) {
+	mgr := newTestManager(t)
+	type update struct{ nodeName, metricType string }
+	updates := make(chan update, 10)
+	mgr.RegisterOnMetricUpdate(func(nodeName string, metricType string) {
+		// the cache is already updated when called.
+		if _, err := mgr.GetNodeMetric(context.Background(), nodeName, metricType); err != nil {
+			t.Errorf("expect %s %s in cache get %v", nodeName, metricType, err)
+		}
+		updates <- update{nodeName: nodeName, metricType: metricType}
+	})
+	mgr.ObservabilityIndicantAdd(newNodeOBI("obi", "node1", map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo{
+		"cpu": {{Records: newRecords("1")}},
+		"mem": {{Records: newRecords("2")}},
+		"bad": {{Records: newRecords("x")}},
+	}))
+	// pod metrics are not notified.
+	mgr.ObservabilityIndicantAdd(newPodOBI("pod-obi", "ns1", "pod1", map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo{
+		"cpu": {{Records: newRecords("1")}},
+	}))
+
+	var get []string
+	for len(get) < 2 {
+		select {
+		case u := <-updates:
+			get = append(get, u.nodeName+"/"+u.metricType)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timeout waiting for updates, get %v", get)
+		}
+	}
+	sort.Strings(get)
+	if exp := []string{"node1/cpu", "node1/mem"}; !reflect.DeepEqual(exp, get) {
+		t.Fatalf("expect %v get %v", exp, get)
+	}
+	select {
+	case u := <-updates:
+		t.Fatalf("unexpected update %v", u)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestGetScoreFallbackNamespaces(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		chain     []string
+		scores    []*schedv1alpha1.Score
+		namespace string
+		exp       []string
+	}{
+		{
+			name:      "first namespace of chain",
+			chain:     []string{"team-policies", "arbiter-policies", metav1.NamespaceSystem},
+			scores:    []*schedv1alpha1.Score{newScore("team-policies", "score1", 1, "function score(){return 1}"), newScore("arbiter-policies", "score1", 1, "function score(){return 1}")},
+			namespace: "ns1",
+			exp:       []string{"team-policies/score1"},
+		},
+		{
+			name:      "walk chain in order",
+			chain:     []string{"team-policies", "arbiter-policies", metav1.NamespaceSystem},
+			scores:    []*schedv1alpha1.Score{newScore("arbiter-policies", "score1", 1, "function score(){return 1}"), newScore(metav1.NamespaceSystem, "score1", 1, "function score(){return 1}")},
+			namespace: "ns1",
+			exp:       []string{"arbiter-policies/score1"},
+		},
+		{
+			name:      "continue after requested namespace in chain",
+			chain:     []string{"team-policies", "arbiter-policies", metav1.NamespaceSystem},
+			scores:    []*schedv1alpha1.Score{newScore("team-policies", "score1", 1, "function score(){return 1}"), newScore(metav1.NamespaceSystem, "score1", 1, "function score(){return 1}")},
+			namespace: "arbiter-policies",
+			exp:       []string{"kube-system/score1"},
+		},
+		{
+			name:      "duplicates in chain",
+			chain:     []string{"ns1", "team-policies", "team-policies", "ns1"},
+			scores:    []*schedv1alpha1.Score{newScore(metav1.NamespaceSystem, "score1", 1, "function score(){return 1}")},
+			namespace: "ns1",
+			exp:       []string{},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			mgr := newTestManager(t, WithFallbackNamespaces(tc.chain...))
+			for _, s := range tc.scores {
+				mgr.ScoreAdd(s)
+			}
+			res, _ := mgr.GetScore(context.Background(), tc.namespace)
+			if get := scoreNames(res); !reflect.DeepEqual(tc.exp, get) {
+				t.Fatalf("expect %v get %v", tc.exp, get)
+			}
+		})
+	}
+}
+
+func TestGetScoreByName(t *testing.T) {
+	t.Setenv("POD_NAMESPACE", "arbiter")
+	mgr := newTestManager(t)
+	mgr.ScoreAdd(newScore("ns1", "score1", 2, "function score(){return 1}"))
+	mgr.ScoreAdd(newScore("arbiter", "score2", 1, "function score(){return 1}"))
+
+	spec, ok := mgr.GetScoreByName(context.Background(), "ns1", "score1")
+	if !ok {
+		t.Fatalf("expect ns1/score1 found")
+	}
+	if exp := (schedv1alpha1.ScoreSpec{Weight: 2, Logic: "function score(){return 1}"}); !reflect.DeepEqual(exp, spec) {
+		t.Fatalf("expect %+v get %+v", exp, spec)
+	}
+	for _, key := range [][2]string{{"ns1", "score2"}, {"ns2", "score1"}, {"ns2", "score2"}} {
+		// score2 is only in the fallback namespace arbiter.
+		if _, ok := mgr.GetScoreByName(context.Background(), key[0], key[1]); ok {
+			t.Fatalf("expect %s/%s not found", key[0], key[1])
+		}
+	}
+}
+
+func TestCancelledContext(t *testing.T) {
+	mgr := newTestManager(t)
+	for i := 0; i < 100; i++ {
+		mgr.ScoreAdd(newScore("ns1", fmt.Sprintf("score%d", i), 1, "function score(){return 1}"))
+		mgr.ObservabilityIndicantAdd(newNodeOBI(fmt.Sprintf("obi%d", i), "node1", map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo{
+			"cpu": {{Records: newRecords("1")}},
+		}))
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if res, totalWeight := mgr.GetScore(ctx, "ns1"); len(res) != 0 || totalWeight != 0 {
+		t.Fatalf("expect no score for cancelled context get %d scores", len(res))
+	}
+	if obi, err := mgr.GetNodeOBI(ctx, "node1"); !errors.Is(err, context.Canceled) || obi != nil {
+		t.Fatalf("expect context canceled get %v with %d obi", err, len(obi))
+	}
+	if obi, err := getOBIFromCache(ctx, mgr.nodeMetric["node1"]); !errors.Is(err, context.Canceled) || obi != nil {
+		t.Fatalf("expect context canceled get %v with %d obi", err, len(obi))
+	}
+	if res, _, _ := scoresOf(ctx, klog.Background(), "ns1", cachedScores(mgr.score["ns1"])); len(res) != 0 {
+		t.Fatalf("expect no score for cancelled context get %d scores", len(res))
+	}
+}
+
+func TestNegativeWeightScore(t *testing.T) {
+	mgr := newTestManager(t, WithNamespaceFallback(false))
+	mgr.ScoreAdd(newScore("ns1", "cpu", 3, "function score(){return 80}"))
+	mgr.ScoreAdd(newScore("ns1", "mem", 1, "function score(){return 40}"))
+	mgr.ScoreAdd(newScore("ns1", "overload", -1, "function score(){return 50}"))
+	mgr.ScoreAdd(newScore("ns1", "zero", 0, "function score(){return 100}"))
+
+	res, totalWeight, skipped := mgr.GetScoreWithDiagnostics(context.Background(), "ns1")
+	if exp, get := []string{"ns1/cpu", "ns1/mem", "ns1/overload"}, scoreNames(res); !reflect.DeepEqual(exp, get) {
+		t.Fatalf("expect %v get %v", exp, get)
+	}
+	if exp, get := []string{"ns1/zero"}, scoreNames(skipped); !reflect.DeepEqual(exp, get) {
+		t.Fatalf("expect skipped %v get %v", exp, get)
+	}
+	if totalWeight != 4 {
+		t.Fatalf("expect totalWeight of positive weights 4 get %d", totalWeight)
+	}
+	for i := range res {
+		res[i].Result, res[i].Err = EvaluateScoreResult(res[i], &PodWithOBI{}, &NodeWithOBI{})
+	}
+	// (3*80 + 1*40 - 1*50) / 4
+	if score := WeightedScore(res, totalWeight); score != 57 {
+		t.Fatalf("expect score 57 get %d", score)
+	}
+
+	penalty := []ScoreResult{
+		{ScoreSpec: schedv1alpha1.ScoreSpec{Weight: 1}, Result: 10},
+		{ScoreSpec: schedv1alpha1.ScoreSpec{Weight: -2}, Result: 50},
+	}
+	if score := WeightedScore(penalty, 1); score != 0 {
+		t.Fatalf("expect score clamped to 0 get %d", score)
+	}
+}
+
+func TestSortScoreResults(t *testing.T) {
+	newResult := func(nodeName, nameKey string, result int64) ScoreResult {
+		return ScoreResult{NodeName: nodeName, NameKey: nameKey, Result: result}
+	}
+	exp := []ScoreResult{
+		newResult("node2", "", 90),
+		newResult("node1", "ns1/a", 50), newResult("node1", "ns1/b", 50),
+		newResult("node3", "", 50), newResult("node4", "", 50),
+		newResult("node0", "", 10),
+	}
+	for i := 0; i < 10; i++ {
+		results := make([]ScoreResult, len(exp))
+		copy(results, exp)
+		rand.Shuffle(len(results), func(i, j int) { results[i], results[j] = results[j], results[i] })
+		SortScoreResults(results)
+		if !reflect.DeepEqual(exp, results) {
+			t.Fatalf("expect %+v get %+v", exp, results)
+		}
+	}
+}
+
+func TestNormalizeScores(t *testing.T) {
+	newResult := func(nodeName string, weight, result int64) ScoreResult {
+		return ScoreResult{NodeName: nodeName, ScoreSpec: schedv1alpha1.ScoreSpec{Weight: weight}, Result: result}
+	}
+	results := []ScoreResult{
+		newResult("node1", 3, 80), newResult("node1", 1, 40),
+		newResult("node2", 1, 100), newResult("node2", 1, 50),
+		newResult("node3", 3, 10), newResult("node3", 1, 10), newResult("node3", -2, 60),
+		newResult("node4", 3, 100), newResult("node4", 1, 100),
+	}
+	for _, tc := range []struct {
+		name        string
+		totalWeight int64
+		exp         map[string]int64
+	}{
+		// (3*80 + 1*40) / 4 = 70, (100 + 50) / 4 = 37, the penalty of node3 is clamped to 0.
+		{name: "weight 4", totalWeight: 4, exp: map[string]int64{"node1": 70, "node2": 37, "node3": 0, "node4": 100}},
+		// the weighted sum over a smaller total weight is clamped to 100.
+		{name: "weight 2", totalWeight: 2, exp: map[string]int64{"node1": 100, "node2": 75, "node3": 0, "node4": 100}},
+		{name: "zero weight", totalWeight: 0, exp: map[string]int64{"node1": 0, "node2": 0, "node3": 0, "node4": 0}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if get := NormalizeScores(results, tc.totalWeight); !reflect.DeepEqual(tc.exp, get) {
+				t.Fatalf("expect %v get %v", tc.exp, get)
+			}
+		})
+	}
+	if get := NormalizeScores(nil, 4); len(get) != 0 {
+		t.Fatalf("expect no score get %v", get)
+	}
+}
+
+func TestObservabilityIndicantAddIdempotent(t *testing.T) {
+	mgr := newTestManager(t, WithMetricTTL(time.Hour, time.Hour))
+	obi := newNodeOBI("obi", "node1", map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo{
+		"cpu": {{Records: newRecords("1", "2")}},
+		"mem": {{Records: newRecords("3")}},
+	})
+	key := getMetricCacheKey(obi)
+	addTargetMetrics := func(obi *schedv1alpha1.ObservabilityIndicant) []string {
+		mgr.Lock()
+		defer mgr.Unlock()
+		return mgr.addTargetMetrics(mgr.logger, mgr.nodeMetric, "node1", key, obi.Status.Metrics, obi)
+	}
+	if updated := addTargetMetrics(obi); len(updated) != 2 {
+		t.Fatalf("expect cpu and mem updated get %v", updated)
+	}
+	item := mgr.nodeMetric["node1"].Items()[key]
+
+	// redelivery of the identical obi, e.g. on resync.
+	mgr.ObservabilityIndicantAdd(obi.DeepCopy())
+	if updated := addTargetMetrics(obi.DeepCopy()); len(updated) != 0 {
+		t.Fatalf("expect nothing updated get %v", updated)
+	}
+	if again := mgr.nodeMetric["node1"].Items()[key]; !reflect.DeepEqual(item, again) {
+		t.Fatalf("expect identical cache state %+v get %+v", item, again)
+	}
+
+	// only the changed metric type is replaced, the records are not accumulated.
+	changed := obi.DeepCopy()
+	changed.Status.Metrics["mem"] = []schedv1alpha1.ObservabilityIndicantStatusMetricInfo{{Records: newRecords("5")}}
+	if updated := addTargetMetrics(changed); !reflect.DeepEqual([]string{"mem"}, updated) {
+		t.Fatalf("expect mem updated get %v", updated)
+	}
+	data := mgr.nodeMetric["node1"].Items()[key].Object.(cachedOBI)
+	old := item.Object.(cachedOBI)
+	if !reflect.DeepEqual(old.metric["cpu"], data.metric["cpu"]) || old.expiration["cpu"] != data.expiration["cpu"] {
+		t.Fatalf("expect cpu kept as is get %+v", data.metric["cpu"])
+	}
+	if m := data.metric["mem"]; len(m.Records) != 1 || m.Avg != 5 {
+		t.Fatalf("expect mem replaced get %+v", m)
+	}
+}
+
+func TestEvictNode(t *testing.T) {
+	mgr := newTestManager(t)
+	cpu := map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo{"cpu": {{Records: newRecords("1")}}}
+	mgr.ObservabilityIndicantAdd(newNodeOBI("obi1", "node1", cpu))
+	mgr.ObservabilityIndicantAdd(newNodeOBI("obi2", "node2", cpu))
+
+	mgr.EvictNode("node1")
+	if _, err := mgr.GetNodeOBI(context.Background(), "node1"); !errors.Is(err, ErrNotFoundInCache) {
+		t.Fatalf("expect ErrNotFoundInCache get %v", err)
+	}
+	if _, ok := mgr.nodeMetric["node1"]; ok {
+		t.Fatalf("expect cache of node1 removed")
+	}
+	// evicting an unknown node is a no-op.
+	mgr.EvictNode("node3")
+
+	// the informer delete handler accepts tombstones.
+	mgr.NodeDelete(cache.DeletedFinalStateUnknown{Key: "node2", Obj: &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node2"}}})
+	if _, err := mgr.GetNodeOBI(context.Background(), "node2"); !errors.Is(err, ErrNotFoundInCache) {
+		t.Fatalf("expect ErrNotFoundInCache get %v", err)
+	}
+}
+
+func TestContextualLogging(t *testing.T) {
+	logger := ktesting.NewLogger(t, ktesting.NewConfig(ktesting.Verbosity(5)))
+	buffer := logger.GetSink().(ktesting.Underlier).GetBuffer()
+	mgr := newTestManager(t, WithLogger(logger), WithNamespaceFallback(false))
+
+	mgr.ObservabilityIndicantAdd(newNodeOBI("obi", "node1", map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo{
+		"cpu": {{Records: newRecords("1", "x")}},
+	}))
+	// the logger of ctx takes precedence over the one of the manager.
+	ctxLogger := ktesting.NewLogger(t, ktesting.NewConfig(ktesting.Verbosity(5)))
+	ctxBuffer := ctxLogger.GetSink().(ktesting.Underlier).GetBuffer()
+	ctx := klog.NewContext(context.Background(), ctxLogger)
+	if _, err := mgr.GetNodeOBI(ctx, "node2"); !errors.Is(err, ErrNotFoundInCache) {
+		t.Fatalf("expect ErrNotFoundInCache get %v", err)
+	}
+	mgr.GetScore(context.Background(), "ns1")
+	score := newScore("ns1", "invalid", 1, "function score( {")
+	mgr.ScoreAdd(score)
+	mgr.ScoreDelete(score)
+	obi := newNodeOBI("obi", "node1", nil)
+	mgr.ObservabilityIndicantDelete(obi)
+	mgr.ObservabilityIndicantAdd(newNodeOBI("obi", "node1", map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo{
+		"cpu": {{Records: newRecords("1")}},
+	}))
+	mgr.EvictNode("node1")
+
+	for _, tc := range []struct {
+		buffer ktesting.Buffer
+		msg    string
+		exp    []string
+	}{
+		{buffer: buffer, msg: "Failed to parse float", exp: []string{`obi="default/obi"`, `node="node1"`, `Value="x"`}},
+		{buffer: buffer, msg: "add obi to cache", exp: []string{`obi="default/obi"`, `node="node1"`}},
+		{buffer: ctxBuffer, msg: "Failed to get node OBI", exp: []string{`node="node2"`, `err=`}},
+		{buffer: buffer, msg: "no score in namespace", exp: []string{`namespace="ns1"`, `scoreNamespace="ns1"`}},
+		{buffer: buffer, msg: "score logic is invalid", exp: []string{`namespace="ns1"`, `score="invalid"`, `err=`}},
+		{buffer: buffer, msg: "get delete Score", exp: []string{`namespace="ns1"`, `score="invalid"`}},
+		{buffer: buffer, msg: "get delete ObservabilityIndicant", exp: []string{`obi="default/obi"`}},
+		{buffer: buffer, msg: "evict node metrics", exp: []string{`node="node1"`}},
+	} {
+		var line string
+		for _, l := range strings.Split(tc.buffer.String(), "\n") {
+			if strings.Contains(l, tc.msg) {
+				line = l
+				break
+			}
+		}
+		for _, kv := range tc.exp {
+			if !strings.Contains(line, kv) {
+				t.Fatalf("expect %s in the log of %q get %q", kv, tc.msg, tc.buffer.String())
+			}
+		}
+	}
+}
@@ -17,6 +17,9 @@ limitations under the License.
 package manager
 
 import (
+	"encoding/json"
+	"time"
+
 	v1 "k8s.io/api/core/v1"
 
 	"github.com/kube-arbiter/arbiter/pkg/apis/v1alpha1"
@@ -29,6 +32,38 @@ type OBI struct {
 type PodWithOBI struct {
 	Pod v1.Pod         `json:"raw"`
 	OBI map[string]OBI `json:"obi"` // OBI is a map, key is obi name
+	// Metric is all metrics of OBI keyed by metric type, see MergeOBIMetrics.
+	Metric map[string]FullMetrics `json:"metric"`
+	// Requests are the resources requested by Pod keyed by resource name in the same units as
+	// NodeWithOBI.Allocatable, see podRequests, e.g. fitScore(pod.requests.cpu, node.allocatable.cpu - node.metric.cpu.avg).
+	Requests map[string]float64 `json:"requests"`
+}
+
+// NewPodWithOBI returns the PodWithOBI of pod with its OBI, Requests is never nil.
+func NewPodWithOBI(pod *v1.Pod, obi map[string]OBI) *PodWithOBI {
+	return &PodWithOBI{Pod: *pod, OBI: obi, Metric: MergeOBIMetrics(obi), Requests: podRequests(pod)}
+}
+
+// podRequests returns the resources requested by pod the same way as the scheduler, the sum of its containers,
+// at least the request of any init container, plus the pod overhead. A pod without requests gets an empty map.
+func podRequests(pod *v1.Pod) map[string]float64 {
+	requests := make(map[string]float64)
+	for _, c := range pod.Spec.Containers {
+		for name, value := range resourceValues(c.Resources.Requests) {
+			requests[name] += value
+		}
+	}
+	for _, c := range pod.Spec.InitContainers {
+		for name, value := range resourceValues(c.Resources.Requests) {
+			if value > requests[name] {
+				requests[name] = value
+			}
+		}
+	}
+	for name, value := range resourceValues(pod.Spec.Overhead) {
+		requests[name] += value
+	}
+	return requests
 }
 
 type NodeWithOBI struct {
@@ -36,11 +71,160 @@ type NodeWithOBI struct {
 	CPUReq int64          `json:"cpuReq"`
 	MemReq int64          `json:"memReq"`
 	OBI    map[string]OBI `json:"obi"` // OBI is a map, key is obi name
+	// Metric is all metrics of OBI keyed by metric type, see MergeOBIMetrics.
+	Metric map[string]FullMetrics `json:"metric"`
+	// Labels and Taints are the ones of Node, so logic can use node.labels["key"] instead of node.raw.metadata.labels.
+	Labels map[string]string `json:"labels"`
+	Taints []v1.Taint        `json:"taints"`
+	// Capacity and Allocatable are the resources of Node as numbers keyed by resource name, in the canonical
+	// units of the metrics, cpu in millicores and the others in their base unit such as byte for memory,
+	// so logic can compute ratios like percent(node.metric.cpu.avg, node.capacity.cpu).
+	Capacity    map[string]float64 `json:"capacity"`
+	Allocatable map[string]float64 `json:"allocatable"`
+	// encoded is the json of the NodeWithOBI for the logic set by encode, so it is encoded once for all Score.
+	encoded []byte
+}
+
+// encode sets encoded for marshalJSON, the NodeWithOBI must not be modified afterwards.
+func (n *NodeWithOBI) encode() {
+	n.encoded = nil
+	if encoded, err := json.Marshal(n); err == nil {
+		n.encoded = encoded
+	}
+}
+
+// marshalJSON returns the json of the NodeWithOBI for the logic, the one set by encode if any.
+func (n *NodeWithOBI) marshalJSON() ([]byte, error) {
+	if n.encoded != nil {
+		return n.encoded, nil
+	}
+	return json.Marshal(n)
+}
+
+// NewNodeWithOBI returns the NodeWithOBI of node with its OBI, the requested resources are not filled.
+// Labels, Taints, Capacity and Allocatable are never nil, so logic can index them without checking.
+func NewNodeWithOBI(node *v1.Node, obi map[string]OBI) *NodeWithOBI {
+	nodeWithOBI := &NodeWithOBI{
+		Node:        *node,
+		OBI:         obi,
+		Metric:      MergeOBIMetrics(obi),
+		Labels:      node.Labels,
+		Taints:      node.Spec.Taints,
+		Capacity:    resourceValues(node.Status.Capacity),
+		Allocatable: resourceValues(node.Status.Allocatable),
+	}
+	if nodeWithOBI.Labels == nil {
+		nodeWithOBI.Labels = map[string]string{}
+	}
+	if nodeWithOBI.Taints == nil {
+		nodeWithOBI.Taints = []v1.Taint{}
+	}
+	return nodeWithOBI
+}
+
+// resourceValues converts resources to numbers keyed by resource name, cpu in millicores and the others
+// in their base unit, the same as the canonical units of the metrics.
+func resourceValues(resources v1.ResourceList) map[string]float64 {
+	values := make(map[string]float64, len(resources))
+	for name, quantity := range resources {
+		if name == v1.ResourceCPU {
+			values[string(name)] = float64(quantity.MilliValue())
+			continue
+		}
+		values[string(name)] = quantity.AsApproximateFloat64()
+	}
+	return values
 }
 
 type FullMetrics struct {
 	v1alpha1.ObservabilityIndicantStatusMetricInfo
-	Avg float64 `json:"avg"`
-	Max float64 `json:"max"`
-	Min float64 `json:"min"`
+	// CanonicalUnit is the unit of all aggregations, record values are converted from Unit to it.
+	// e.g. cpu is always in millicores "m" and memory in "byte", no matter which unit the OBI reports.
+	CanonicalUnit string `json:"canonicalUnit"`
+	// Primary is the aggregation chosen for the metric type by WithPrimaryAggregations, Avg by default,
+	// so Score logic can read node.metric.latency.primary without knowing which one fits the metric.
+	Primary float64 `json:"primary"`
+	Avg     float64 `json:"avg"`
+	Max     float64 `json:"max"`
+	Min     float64 `json:"min"`
+	// Count is the number of parsed record values and Sum is their total, Count is low if there are few samples.
+	Count int     `json:"count"`
+	Sum   float64 `json:"sum"`
+	// NonFinite is the number of +Inf, -Inf and NaN record values, they are not counted in any aggregation.
+	NonFinite int `json:"nonFinite"`
+	// WeightedAvg is the average of the record values weighted by the series label set by WithWeightLabels,
+	// it is the same as Avg if no weight is set.
+	WeightedAvg float64 `json:"weightedAvg"`
+	// Median is the middle of the record values, or the average of the two middle ones for an even count.
+	Median float64 `json:"median"`
+	// P50, P90, P95 and P99 are percentiles of the record values, see percentile for the method used.
+	// Score logic can use them like node.obi[name].metric.cpu.p95
+	P50 float64 `json:"p50"`
+	P90 float64 `json:"p90"`
+	P95 float64 `json:"p95"`
+	P99 float64 `json:"p99"`
+	// EWMA is the exponentially time-weighted moving average, recent records weigh more, see WithEWMAHalfLife.
+	EWMA float64 `json:"ewma"`
+	// Latest is the value of the record with the greatest timestamp.
+	Latest float64 `json:"latest"`
+	// Rate is the per-second increase of a counter metric, only computed for WithCounterMetrics.
+	Rate float64 `json:"rate"`
+	// Slope is the per-second trend of the values by linear regression over the record timestamps,
+	// e.g. node.metric.cpu.slope < 0 for a node cooling down. It is 0 without two distinct timestamps.
+	Slope float64 `json:"slope"`
+	// MaxGap is the longest interval between two consecutive record timestamps, in nanoseconds in the logic,
+	// HasGap means it exceeds the threshold of WithGapThreshold, e.g. the source stopped reporting for a while,
+	// so the aggregations span a discontinuity and logic can discount them.
+	MaxGap time.Duration `json:"maxGap"`
+	HasGap bool          `json:"hasGap"`
+	// Flaps is the number of direction reversals of the values in the window of the FlapPolicy of the metric type,
+	// Frozen means the aggregations are held at the last stable ones for flapping, see WithFlapDetection.
+	Flaps  int  `json:"flaps"`
+	Frozen bool `json:"frozen"`
+	// Buckets summarize the records older than the age of WithDownsampling, which are no longer in Records.
+	Buckets []RecordBucket `json:"buckets,omitempty"`
+	// Targets is the metric of each TargetItem aggregated on its own, e.g. node.metric.gpu.targets.gpu0.avg
+	// of a GPU node reporting each device. It is only set if more than one target item is reported, the
+	// time-ordered aggregations, e.g. Latest, Rate, EWMA and Slope, are then combined from them, see combineTargetItems.
+	Targets map[string]FullMetrics `json:"targets,omitempty"`
+}
+
+// DefaultPrimaryAggregation is the FullMetrics.Primary of a metric type without WithPrimaryAggregations.
+const DefaultPrimaryAggregation = "avg"
+
+// Aggregation returns the aggregation of m by its json name, e.g. "avg" or "p95", false if there is no such one.
+func (m FullMetrics) Aggregation(name string) (float64, bool) {
+	switch name {
+	case "avg":
+		return m.Avg, true
+	case "max":
+		return m.Max, true
+	case "min":
+		return m.Min, true
+	case "count":
+		return float64(m.Count), true
+	case "sum":
+		return m.Sum, true
+	case "weightedAvg":
+		return m.WeightedAvg, true
+	case "median":
+		return m.Median, true
+	case "p50":
+		return m.P50, true
+	case "p90":
+		return m.P90, true
+	case "p95":
+		return m.P95, true
+	case "p99":
+		return m.P99, true
+	case "ewma":
+		return m.EWMA, true
+	case "latest":
+		return m.Latest, true
+	case "rate":
+		return m.Rate, true
+	case "slope":
+		return m.Slope, true
+	}
+	return 0, false
 }
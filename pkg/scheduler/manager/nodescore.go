@@ -0,0 +1,175 @@
+/*
+Copyright 2022 The Arbiter Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manager
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/klog/v2"
+	"k8s.io/kubernetes/pkg/scheduler/framework"
+	"k8s.io/kubernetes/pkg/scheduler/framework/plugins/helper"
+)
+
+// NeutralNodeScore is the midpoint of the node scores, e.g. the score of ComputeNodeScoreList for every node if
+// none is scored, so no node is preferred or avoided.
+const NeutralNodeScore = (framework.MaxNodeScore + framework.MinNodeScore) / 2
+
+// ComputeNodeScoreList evaluates the Score of pod, see GetScoreForPod, on each of nodes, e.g. for a scheduler
+// framework plugin scoring all nodes at once, and returns the weighted scores normalized to
+// [framework.MinNodeScore, framework.MaxNodeScore] in the order of nodes. A node without OBI gets the midpoint of
+// the min and max normalized scores of the scored nodes, so it is neither preferred nor avoided by them, and is
+// named in the reasons of the returned status, which is still a success; so is the status of a pod without any
+// Score, every node then gets NeutralNodeScore. The status is an error only if ctx is done.
+// The NodeWithOBI of each node is built once for all Score, see GetNodeWithOBI.
+func (mgr *manager) ComputeNodeScoreList(ctx context.Context, pod *v1.Pod, nodes []*v1.Node) (framework.NodeScoreList, *framework.Status) {
+	if err := ctx.Err(); err != nil {
+		return nil, framework.AsStatus(err)
+	}
+	logger := klog.FromContext(ctx)
+	list := make(framework.NodeScoreList, len(nodes))
+	for i, node := range nodes {
+		list[i] = framework.NodeScore{Name: node.Name, Score: NeutralNodeScore}
+	}
+	scores, totalWeight, _ := mgr.GetScoreForPod(ctx, pod)
+	if totalWeight <= 0 {
+		return list, framework.NewStatus(framework.Success, fmt.Sprintf("no valid Score for pod %s/%s", pod.Namespace, pod.Name))
+	}
+	podOBI, _ := mgr.GetPodOBI(ctx, pod)
+	podWithOBI := NewPodWithOBI(pod, podOBI)
+	cluster := mgr.ClusterMetrics(ctx)
+
+	var scored framework.NodeScoreList
+	var indexes []int
+	var missing []string
+	for i, node := range nodes {
+		if err := ctx.Err(); err != nil {
+			return nil, framework.AsStatus(err)
+		}
+		nodeWithOBI, err := mgr.GetNodeWithOBI(ctx, node)
+		if err != nil {
+			logger.V(4).Info("node has no OBI, use the neutral score", "pod", klog.KObj(pod), "node", node.Name, "err", err)
+			missing = append(missing, node.Name)
+			continue
+		}
+		results := make([]ScoreResult, len(scores))
+		for j, score := range scores {
+			results[j] = score
+			results[j].Result, results[j].Err = EvaluateScoreResultInCluster(score, podWithOBI, nodeWithOBI, cluster)
+		}
+		scored = append(scored, framework.NodeScore{Name: node.Name, Score: WeightedScore(results, totalWeight)})
+		indexes = append(indexes, i)
+	}
+	if status := helper.DefaultNormalizeScore(framework.MaxNodeScore, false, scored); !status.IsSuccess() {
+		return nil, status
+	}
+	if len(missing) == 0 {
+		for j, i := range indexes {
+			list[i].Score = scored[j].Score
+		}
+		return list, nil
+	}
+	// the neutral score of the nodes without OBI is on the normalized scale of the scored ones.
+	neutral := int64(NeutralNodeScore)
+	if len(scored) != 0 {
+		min, max := scored[0].Score, scored[0].Score
+		for _, s := range scored {
+			if s.Score < min {
+				min = s.Score
+			}
+			if s.Score > max {
+				max = s.Score
+			}
+		}
+		neutral = (min + max) / 2
+	}
+	for i := range list {
+		list[i].Score = neutral
+	}
+	for j, i := range indexes {
+		list[i].Score = scored[j].Score
+	}
+	sort.Strings(missing)
+	return list, framework.NewStatus(framework.Success, "nodes without OBI: "+strings.Join(missing, ","))
+}
+
+// GetNodeWithOBI returns the NodeWithOBI of node for score logic, built once for all Score evaluated on node instead
+// of GetNodeOBI and NewNodeWithOBI for each Score. The OBI are copied out of the cache under a short read lock,
+// see viewNodeOBI, the requested resources are filled from the scheduler snapshot if any, and it is encoded for
+// the logic once, so it must not be modified. It returns the NodeWithOBI without OBI along with
+// ErrNotFoundInCache if the node has no OBI, logic can still use the node itself.
+func (mgr *manager) GetNodeWithOBI(ctx context.Context, node *v1.Node) (*NodeWithOBI, error) {
+	var obi map[string]OBI
+	err := mgr.viewNodeOBI(ctx, node.Name, func(view map[string]OBI) {
+		obi = detachOBI(view)
+	})
+	nodeWithOBI := mgr.newNodeWithOBI(node, obi)
+	nodeWithOBI.encode()
+	return nodeWithOBI, err
+}
+
+// detachOBI copies the maps of view, the cached metrics are replaced rather than modified by updates,
+// so their records are shared.
+func detachOBI(view map[string]OBI) map[string]OBI {
+	obi := make(map[string]OBI, len(view))
+	for k, o := range view {
+		metric := make(map[string]FullMetrics, len(o.Metric))
+		for metricType, m := range o.Metric {
+			metric[metricType] = m
+		}
+		obi[k] = OBI{Metric: metric}
+	}
+	return obi
+}
+
+// viewNodeOBI calls fn with the OBI of nodeName the same as GetNodeOBI, but the metrics of an OBI without any
+// expired metric type are the cached maps rather than copies. fn is called under the read lock of mgr, with updates
+// of OBI waiting for it, so it must only copy out what it needs, e.g. detachOBI: it must neither modify obi, retain
+// any reference into it, evaluate logic nor call mgr. It returns ErrNotFoundInCache without calling fn if the node
+// has no OBI.
+func (mgr *manager) viewNodeOBI(ctx context.Context, nodeName string, fn func(obi map[string]OBI)) error {
+	if err := ctx.Err(); err != nil {
+		return fmt.Errorf("node %s: %w", nodeName, err)
+	}
+	mgr.RLock()
+	defer mgr.RUnlock()
+	nodeCache, ok := mgr.nodeMetric[nodeName]
+	if !ok {
+		return fmt.Errorf("node %s: %w", nodeName, ErrNotFoundInCache)
+	}
+	items := nodeCache.Items()
+	obi := make(map[string]OBI, len(items))
+	now := time.Now().UnixNano()
+	for k, v := range items {
+		data, ok := v.Object.(cachedOBI)
+		if !ok {
+			return fmt.Errorf("node %s: cache key %s is not an OBI: %w", nodeName, k, ErrNotFoundInCache)
+		}
+		if o, ok := data.view(now); ok {
+			obi[k] = o
+		}
+	}
+	if len(obi) == 0 {
+		return fmt.Errorf("node %s: %w", nodeName, ErrNotFoundInCache)
+	}
+	fn(obi)
+	return nil
+}
@@ -0,0 +1,206 @@
+/*
+Copyright 2022 The Arbiter Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/kubernetes/pkg/scheduler/framework"
+
+	schedv1alpha1 "github.com/kube-arbiter/arbiter/pkg/apis/v1alpha1"
+)
+
+func TestComputeNodeScoreList(t *testing.T) {
+	mgr := newTestManager(t)
+	for node, cpu := range map[string]string{"node1": "80", "node2": "20"} {
+		mgr.ObservabilityIndicantAdd(newNodeOBI("cpu", node, map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo{
+			"cpu": {{Records: newRecords(cpu)}},
+		}))
+	}
+	var nodes []*v1.Node
+	for _, name := range []string{"node1", "node2", "node3"} {
+		nodes = append(nodes, &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: name}})
+	}
+	pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "ns1", Name: "pod1"}}
+
+	list, status := mgr.ComputeNodeScoreList(context.Background(), pod, nodes)
+	exp := framework.NodeScoreList{{Name: "node1", Score: NeutralNodeScore}, {Name: "node2", Score: NeutralNodeScore}, {Name: "node3", Score: NeutralNodeScore}}
+	if !status.IsSuccess() || !reflect.DeepEqual(exp, list) {
+		t.Fatalf("expect neutral scores without Score get %v %v", list, status)
+	}
+
+	mgr.ScoreAdd(newScore("ns1", "least-cpu", 1, `function score() { return 100 - node.metric.cpu.avg; }`))
+	list, status = mgr.ComputeNodeScoreList(context.Background(), pod, nodes)
+	// 20 and 80 are normalized to the max score 100, node3 has no OBI and gets their midpoint.
+	exp = framework.NodeScoreList{{Name: "node1", Score: 25}, {Name: "node2", Score: 100}, {Name: "node3", Score: 62}}
+	if !reflect.DeepEqual(exp, list) {
+		t.Fatalf("expect %v get %v", exp, list)
+	}
+	if !status.IsSuccess() || status.Message() != "nodes without OBI: node3" {
+		t.Fatalf("expect a success status naming node3 get %v", status)
+	}
+
+	// every scored node is 0, so a node without OBI is not preferred over them.
+	mgr.ScoreAdd(newScore("ns1", "least-cpu", 1, `function score() { return 0; }`))
+	list, status = mgr.ComputeNodeScoreList(context.Background(), pod, nodes)
+	exp = framework.NodeScoreList{{Name: "node1", Score: 0}, {Name: "node2", Score: 0}, {Name: "node3", Score: 0}}
+	if !status.IsSuccess() || !reflect.DeepEqual(exp, list) {
+		t.Fatalf("expect %v get %v %v", exp, list, status)
+	}
+
+	mgr.ScoreAdd(newScore("ns1", "least-cpu", 1, `function score() { return 100 - node.metric.cpu.avg; }`))
+	mgr.ObservabilityIndicantAdd(newNodeOBI("cpu", "node3", map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo{
+		"cpu": {{Records: newRecords("60")}},
+	}))
+	if list, status = mgr.ComputeNodeScoreList(context.Background(), pod, nodes); status != nil || list[2].Score != 50 {
+		t.Fatalf("expect node3 scored 50 without status get %v %v", list, status)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, status = mgr.ComputeNodeScoreList(ctx, pod, nodes); status.Code() != framework.Error {
+		t.Fatalf("expect an error status once ctx is done get %v", status)
+	}
+}
+
+func TestGetNodeWithOBI(t *testing.T) {
+	mgr := newTestManager(t, WithMetricTypeTTL(map[string]time.Duration{"disk": time.Nanosecond}))
+	for node, cpu := range map[string]string{"node1": "80", "node2": "20"} {
+		mgr.ObservabilityIndicantAdd(newNodeOBI("cpu", node, map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo{
+			"cpu":    {{Records: newRecords(cpu, "30")}},
+			"memory": {{Unit: "byte", Records: newRecords("1024")}},
+		}))
+	}
+	// disk is expired, so the OBI of node2 is copied without it.
+	mgr.ObservabilityIndicantAdd(newNodeOBI("disk", "node2", map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo{
+		"disk": {{Records: newRecords("10")}},
+		"cpu":  {{Records: newRecords("50")}},
+	}))
+	time.Sleep(time.Millisecond)
+	for _, s := range []string{
+		"function score() { return 100 - node.metric.cpu.avg; }",
+		"function score() { return node.metric.memory.max / 1024 * 10; }",
+		"function score() { return node.metric.disk === undefined ? 100 : 0; }",
+	} {
+		mgr.ScoreAdd(newScore("ns1", fmt.Sprintf("score%d", len(s)), 1, s))
+	}
+	scaled := newScore("ns1", "scaled", 1, "function score() { return node.metric.cpu.avg; }")
+	scaled.Annotations = map[string]string{MetricScaleAnnotation: `{"cpu":{"scale":0.5}}`}
+	mgr.ScoreAdd(scaled)
+	scores, _, _ := mgr.GetScoreWithDiagnostics(context.Background(), "ns1")
+	pod := &PodWithOBI{Pod: v1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "ns1", Name: "pod1"}}}
+
+	for _, name := range []string{"node1", "node2"} {
+		node := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: name}}
+		obi, err := mgr.GetNodeOBI(context.Background(), name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		nodeWithOBI, err := mgr.GetNodeWithOBI(context.Background(), node)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := nodeWithOBI.OBI["default-disk"].Metric["disk"]; ok {
+			t.Fatalf("expect the expired disk of %s dropped", name)
+		}
+		if !reflect.DeepEqual(obi, nodeWithOBI.OBI) {
+			t.Fatalf("expect the OBI of %s %+v get %+v", name, obi, nodeWithOBI.OBI)
+		}
+		for _, score := range scores {
+			exp, err := EvaluateScoreResult(score, pod, NewNodeWithOBI(node, obi))
+			if err != nil {
+				t.Fatalf("expect %s evaluated on %s get %v", score.NameKey, name, err)
+			}
+			if get, err := EvaluateScoreResult(score, pod, nodeWithOBI); err != nil || get != exp {
+				t.Fatalf("expect %s evaluated on %s to %d get %d %v", score.NameKey, name, exp, get, err)
+			}
+		}
+	}
+
+	// an update after GetNodeWithOBI does not change it.
+	nodeWithOBI, _ := mgr.GetNodeWithOBI(context.Background(), &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}})
+	mgr.ObservabilityIndicantAdd(newNodeOBI("cpu", "node1", map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo{
+		"cpu": {{Records: newRecords("10")}},
+	}))
+	if m := nodeWithOBI.OBI["default-cpu"].Metric["cpu"]; m.Avg != 55 {
+		t.Fatalf("expect the cpu avg 55 read before the update get %+v", m)
+	}
+
+	nodeWithOBI, err := mgr.GetNodeWithOBI(context.Background(), &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node3"}})
+	if !errors.Is(err, ErrNotFoundInCache) || nodeWithOBI == nil || nodeWithOBI.Node.Name != "node3" {
+		t.Fatalf("expect node3 without OBI and ErrNotFoundInCache get %+v %v", nodeWithOBI, err)
+	}
+}
+
+// BenchmarkScoreNode compares building the node of the logic once by GetNodeWithOBI with GetNodeOBI and
+// NewNodeWithOBI for each Score, the same as the scheduler plugin scores a node.
+func BenchmarkScoreNode(b *testing.B) {
+	mgr := newTestManager(b)
+	values := make([]string, 100)
+	for i := range values {
+		values[i] = strconv.Itoa(i)
+	}
+	for i := 0; i < 5; i++ {
+		mgr.ObservabilityIndicantAdd(newNodeOBI(fmt.Sprintf("obi%d", i), "node1", map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo{
+			fmt.Sprintf("cpu%d", i):    {{Records: newRecords(values...)}},
+			fmt.Sprintf("memory%d", i): {{Records: newRecords(values...)}},
+		}))
+	}
+	for i := 0; i < 5; i++ {
+		mgr.ScoreAdd(newScore("ns1", fmt.Sprintf("score%d", i), 1, "function score() { return node.metric.cpu0.avg; }"))
+	}
+	ctx := context.Background()
+	scores, _, _ := mgr.GetScoreWithDiagnostics(ctx, "ns1")
+	node := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "node1"}}
+	pod := &PodWithOBI{}
+	b.Run("GetNodeWithOBI", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			nodeWithOBI, err := mgr.GetNodeWithOBI(ctx, node)
+			if err != nil {
+				b.Fatal(err)
+			}
+			for _, score := range scores {
+				if _, err := EvaluateScoreResult(score, pod, nodeWithOBI); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+	b.Run("GetNodeOBI", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			for _, score := range scores {
+				obi, err := mgr.GetNodeOBI(ctx, "node1")
+				if err != nil {
+					b.Fatal(err)
+				}
+				if _, err := EvaluateScoreResult(score, pod, NewNodeWithOBI(node, obi)); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+}
@@ -0,0 +1,296 @@
+/*
+Copyright 2022 The Arbiter Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manager
+
+import (
+	"time"
+
+	gocache "github.com/patrickmn/go-cache"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog/v2"
+)
+
+// Option configures the manager created by NewManager.
+type Option func(*manager)
+
+// WithNamespaceFallback sets whether GetScore falls back to the namespace of arbiter-scheduler
+// and then kube-system when the requested namespace has no Score, see WithFallbackNamespaces
+// to change the chain. It is enabled by default,
+// disable it in multi-tenant clusters so a namespace is never scored by Score CRs of another namespace.
+func WithNamespaceFallback(enable bool) Option {
+	return func(mgr *manager) {
+		mgr.namespaceFallback = enable
+	}
+}
+
+// WithFallbackNamespaces sets the namespaces GetScore falls back to in order when the requested namespace
+// has no Score, e.g. a shared policy namespace before kube-system. The default chain is the namespace of
+// arbiter-scheduler and then kube-system. The falling back stops at the end of namespaces, and if the
+// requested namespace is in namespaces, it continues from the next one. No namespace is tried twice.
+func WithFallbackNamespaces(namespaces ...string) Option {
+	return func(mgr *manager) {
+		mgr.fallbackNamespaces = append(make([]string, 0, len(namespaces)), namespaces...)
+	}
+}
+
+// WithScoreMerge sets whether GetScore returns the Score of the requested namespace together with the Score
+// of every namespace in the fallback chain, instead of only the first namespace which has any. A Score overrides
+// the same-named Score of the namespaces after it in the chain, e.g. base policies in a shared namespace with
+// overrides in each team namespace. It is disabled by default and has no effect without WithNamespaceFallback.
+func WithScoreMerge(enable bool) Option {
+	return func(mgr *manager) {
+		mgr.mergeScores = enable
+	}
+}
+
+// WithMetricTTL sets how long the metrics of an OBI are kept in node and pod caches if they are not updated,
+// expired entries are removed every cleanupInterval. By default metrics never expire, see also WithMetricTypeTTL.
+// Score cache is not affected, since Score CRs are authoritative.
+func WithMetricTTL(ttl, cleanupInterval time.Duration) Option {
+	return func(mgr *manager) {
+		mgr.metricTTL = ttl
+		mgr.metricCleanupInterval = cleanupInterval
+	}
+}
+
+// WithMetricTypeTTL sets how long each metric type in ttls is kept after it is updated by an OBI,
+// the other metric types of the same OBI are kept as set by WithMetricTTL. A non-positive ttl means never expire.
+// Expired metric types are omitted by the getters, and the OBI is removed once all its metric types expire.
+func WithMetricTypeTTL(ttls map[string]time.Duration) Option {
+	return func(mgr *manager) {
+		mgr.metricTypeTTL = make(map[string]time.Duration, len(ttls))
+		for metricType, ttl := range ttls {
+			mgr.metricTypeTTL[metricType] = ttl
+		}
+	}
+}
+
+// WithValueSuffixes tolerates record values with a unit suffix like "47%" or "14.25m" for each metric type
+// in suffixes, they are stripped and the value is converted to the canonical unit of the metric.
+// Each suffix must be a known unit of the same canonical unit as the metric, e.g. "m" for cpu in "C".
+// Values in other formats are still skipped and logged. By default only bare numbers are parsed.
+func WithValueSuffixes(suffixes map[string][]string) Option {
+	return func(mgr *manager) {
+		mgr.valueSuffixes = make(map[string][]string, len(suffixes))
+		for metricType, s := range suffixes {
+			mgr.valueSuffixes[metricType] = append([]string(nil), s...)
+		}
+	}
+}
+
+// WithFlapDetection freezes each metric type in policies when it flaps, that is its values reverse direction
+// at least FlapPolicy.Threshold times in FlapPolicy.Window, e.g. alternating huge and zero values of a buggy source.
+// The aggregations of a frozen metric are held at the last stable ones, so scoring ignores the flapping values,
+// and the metric is unfrozen once an update is stable again. A flapping metric without a stable value is not cached.
+// See FrozenMetrics for the frozen metric types of a node. By default no metric is frozen.
+func WithFlapDetection(policies map[string]FlapPolicy) Option {
+	return func(mgr *manager) {
+		mgr.flapPolicies = make(map[string]FlapPolicy, len(policies))
+		for metricType, policy := range policies {
+			mgr.flapPolicies[metricType] = policy
+		}
+	}
+}
+
+// WithPrimaryAggregations sets the aggregation used as FullMetrics.Primary for each metric type in aggregations,
+// by the json name of the aggregation, e.g. {"cpu": "avg", "latency": "p95", "capacity": "latest"}, see
+// FullMetrics.Aggregation for the names. The metric types not set, or set to an unknown name, use
+// DefaultPrimaryAggregation.
+func WithPrimaryAggregations(aggregations map[string]string) Option {
+	return func(mgr *manager) {
+		mgr.primaryAggregations = make(map[string]string, len(aggregations))
+		for metricType, name := range aggregations {
+			mgr.primaryAggregations[metricType] = name
+		}
+	}
+}
+
+// WithWeightLabels weights the values of each metric type in labels by a label of their prometheus series,
+// e.g. "samples" for the number of underlying samples of a value, FullMetrics.WeightedAvg is computed by the
+// weights while the other aggregations treat each value equally. A bare number, or a series without a valid
+// label, weighs 1. By default all values weigh 1 and WeightedAvg is the same as Avg.
+func WithWeightLabels(labels map[string]string) Option {
+	return func(mgr *manager) {
+		mgr.weightLabels = make(map[string]string, len(labels))
+		for metricType, label := range labels {
+			mgr.weightLabels[metricType] = label
+		}
+	}
+}
+
+// WithEnumValues maps the categorical string values of each metric type in values to numbers, e.g.
+// {"health": {"healthy": 100, "degraded": 50, "critical": 0}}, so they are aggregated and scored like numbers.
+// The strings are matched exactly after trimming spaces, and the numbers are used as is without unit conversion.
+// Unmapped strings are skipped and logged. By default only numbers are parsed.
+func WithEnumValues(values map[string]map[string]float64) Option {
+	return func(mgr *manager) {
+		mgr.enumValues = make(map[string]map[string]float64, len(values))
+		for metricType, enums := range values {
+			mgr.enumValues[metricType] = make(map[string]float64, len(enums))
+			for s, v := range enums {
+				mgr.enumValues[metricType][s] = v
+			}
+		}
+	}
+}
+
+// WithUpdateDebounce coalesces the updates of the same OBI within window, only the last update in the window
+// is aggregated once the window ends, so a noisy OBI does not take the lock many times per second.
+// Adds and deletes are not delayed, a delete drops the held update. By default every update is aggregated at once.
+func WithUpdateDebounce(window time.Duration) Option {
+	return func(mgr *manager) {
+		mgr.debounceWindow = window
+	}
+}
+
+// WithStaleThreshold rejects the OBI whose newest record of all metrics is older than threshold when it is added
+// or updated, e.g. a controller replays old data, so stale data never gets into the cache. The OBI is logged and
+// a StaleMetricData event is emitted. An OBI without any record is not rejected. By default no OBI is rejected.
+func WithStaleThreshold(threshold time.Duration) Option {
+	return func(mgr *manager) {
+		mgr.staleThreshold = threshold
+	}
+}
+
+// WithDownsampling replaces the records of each metric older than age before its newest record by one RecordBucket
+// per bucket, DefaultDownsampleBucket if it is not positive, when an OBI is cached, so a long window of fine-grained
+// records costs a summary per bucket, and the recent records are kept at full resolution. The aggregations count
+// the buckets, see FullMetrics.Buckets, the records of each TargetItem are not downsampled. A bucket shorter than
+// a millisecond, the resolution of record timestamps, is rounded up to one. It is disabled by default or if age is
+// not positive.
+func WithDownsampling(age, bucket time.Duration) Option {
+	return func(mgr *manager) {
+		if bucket <= 0 {
+			bucket = DefaultDownsampleBucket
+		} else if bucket < time.Millisecond {
+			bucket = time.Millisecond
+		}
+		mgr.downsampleAge, mgr.downsampleBucket = age, bucket
+	}
+}
+
+// WithMaxRecordsPerMetric keeps only the n newest records of each metric by timestamp when an OBI is cached,
+// so the cache does not grow with the OBI status. All aggregations are computed over the kept records.
+// By default all records are kept.
+func WithMaxRecordsPerMetric(n int) Option {
+	return func(mgr *manager) {
+		mgr.maxRecordsPerMetric = n
+	}
+}
+
+// WithEWMAHalfLife sets the half-life of FullMetrics.EWMA, the weight of a record halves every halfLife
+// before the newest record. Default is DefaultEWMAHalfLife, a non-positive halfLife makes EWMA the newest value.
+func WithEWMAHalfLife(halfLife time.Duration) Option {
+	return func(mgr *manager) {
+		mgr.ewmaHalfLife = halfLife
+	}
+}
+
+// WithGapThreshold sets FullMetrics.HasGap of a metric if the MaxGap between its records exceeds threshold,
+// e.g. a few times the reporting interval of the sources. It is disabled by default or if threshold is not positive.
+func WithGapThreshold(threshold time.Duration) Option {
+	return func(mgr *manager) {
+		mgr.gapThreshold = threshold
+	}
+}
+
+// WithTargetKind registers an OBI TargetRef kind other than Node and Pod, the OBI of kind are cached
+// by the key returned from resolve, and can be got by GetTargetOBI.
+func WithTargetKind(kind TargetKind, resolve TargetResolver) Option {
+	return func(mgr *manager) {
+		mgr.targets[kind] = &targetHandler{resolve: resolve, metrics: make(map[string]*gocache.Cache)}
+	}
+}
+
+// WithUnresolvedBackoff sets the backoff of an OBI whose target can't be resolved, e.g. a node OBI without
+// the node name nor target items. The updates of the same spec are skipped until the backoff elapses, it starts
+// at initial and doubles on every failed retry up to max. A changed spec or changed target items in the status
+// are retried at once, and the backoff is cleared once the target is resolved. A non-positive initial disables the backoff.
+// By default it is DefaultUnresolvedBackoff up to DefaultMaxUnresolvedBackoff.
+func WithUnresolvedBackoff(initial, max time.Duration) Option {
+	return func(mgr *manager) {
+		mgr.unresolvedBackoff = initial
+		mgr.maxUnresolvedBackoff = max
+	}
+}
+
+// WithMetricScales scales the aggregations of each metric type in scales in the logic of every Score, e.g. memory
+// in GiB instead of bytes, the MetricScaleAnnotation of a Score overrides them for its metric types. The cached
+// metrics are not changed, the scaling is applied to a copy when a Score is evaluated. By default nothing is scaled.
+func WithMetricScales(scales map[string]MetricScale) Option {
+	return func(mgr *manager) {
+		mgr.metricScales = make(map[string]MetricScale, len(scales))
+		for metricType, s := range scales {
+			mgr.metricScales[metricType] = s
+		}
+	}
+}
+
+// WithAggregateHistory keeps the Aggregates of each node metric recomputed by the last depth updates of its OBI,
+// e.g. to graph how the node cpu evolved as seen by the scheduler, see GetNodeAggregateHistory.
+// The history is held in memory of depth entries for each node and metric type. It is disabled by default.
+func WithAggregateHistory(depth int) Option {
+	return func(mgr *manager) {
+		mgr.historyDepth = depth
+	}
+}
+
+// WithEventRecorder sets the recorder used to emit events on the OBI skipped by the manager,
+// such as NoMetricData and UnresolvedTarget. No event is emitted by default.
+func WithEventRecorder(recorder record.EventRecorder) Option {
+	return func(mgr *manager) {
+		mgr.recorder = recorder
+	}
+}
+
+// WithLogger sets the logger of the informer handlers, it is also used by the get methods unless their ctx
+// carries a logger. Log lines are tagged with the obi, node, pod or namespace they are about. klog.Background()
+// is used by default.
+func WithLogger(logger klog.Logger) Option {
+	return func(mgr *manager) {
+		mgr.logger = logger
+	}
+}
+
+// WithCounterMetrics marks metricTypes as monotonically increasing counters, FullMetrics.Rate is computed
+// for them with counter resets handled. Gauges should not be marked, their Rate is always 0.
+func WithCounterMetrics(metricTypes ...string) Option {
+	return func(mgr *manager) {
+		if mgr.counterMetrics == nil {
+			mgr.counterMetrics = make(map[string]struct{}, len(metricTypes))
+		}
+		for _, t := range metricTypes {
+			mgr.counterMetrics[t] = struct{}{}
+		}
+	}
+}
+
+// WithScoreEvaluator registers evaluator by name, a Score selects it by the ScoreEvaluatorAnnotation.
+// Registering DefaultScoreEvaluator replaces the JavaScriptEvaluator used by Score without the annotation.
+func WithScoreEvaluator(name string, evaluator ScoreEvaluator) Option {
+	return func(mgr *manager) {
+		mgr.evaluators[name] = evaluator
+	}
+}
+
+// WithScoreTimeout sets the evaluation timeout of Score without ScoreTimeoutAnnotation, DefaultScoreTimeout by default.
+// The node gets score 0 from a Score evaluated longer than it, no limit if timeout is not positive.
+func WithScoreTimeout(timeout time.Duration) Option {
+	return func(mgr *manager) {
+		mgr.scoreTimeout = timeout
+	}
+}
@@ -0,0 +1,217 @@
+/*
+Copyright 2022 The Arbiter Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manager
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	schedv1alpha1 "github.com/kube-arbiter/arbiter/pkg/apis/v1alpha1"
+)
+
+// promSeries is one element of a prometheus vector or matrix result.
+type promSeries struct {
+	Metric map[string]string `json:"metric"`
+	// Value is set for vector result: [timestamp, "value"]
+	Value []interface{} `json:"value"`
+	// Values is set for matrix result: [[timestamp, "value"], ...]
+	Values [][]interface{} `json:"values"`
+}
+
+// valueFormat is the configuration of parsing the record values of a metric type, see parseMetricValue.
+type valueFormat struct {
+	// suffixes are the units a bare number may be suffixed with, set by WithValueSuffixes.
+	suffixes []string
+	// enums maps string values to their numbers, set by WithEnumValues.
+	enums map[string]float64
+	// weightLabel is the label of a prometheus series weighing its samples, set by WithWeightLabels.
+	weightLabel string
+}
+
+// parseMetricValue parses the value of a record in unit to samples in the canonical unit of unit, see knownUnits.
+// The value is either a bare number like "0.47", or a prometheus vector/matrix result in json like
+// [{"metric":{},"values":[[1666949631.719,"14.25"]]}], an empty result "[]" returns no sample and no error.
+// A number suffixed with one of format.suffixes like "47%" or "250m" is converted by its suffix instead of unit,
+// and a value in format.enums is mapped to its number as is, neither is accepted without format.
+// The weight of the samples of a prometheus series is the value of format.weightLabel, e.g. the number of
+// underlying samples. Any other value, an empty weightLabel, or a missing, unparsable or negative label
+// weighs 1, so samples are weighted equally by default.
+// It returns an error for an unknown unit.
+func parseMetricValue(value, unit string, format valueFormat) (samples, weights []float64, err error) {
+	canonical, factor, ok := normalizeUnit(unit)
+	if !ok {
+		return nil, nil, fmt.Errorf("unknown unit %q of value %q", unit, value)
+	}
+	samples, weights, err = parseWeightedRecordValue(value, format.weightLabel)
+	if err == nil {
+		for i := range samples {
+			samples[i] *= factor
+		}
+		return samples, weights, nil
+	}
+	if val, ok := format.enums[strings.TrimSpace(value)]; ok {
+		return []float64{val}, []float64{1}, nil
+	}
+	if len(format.suffixes) == 0 {
+		if len(format.enums) != 0 {
+			return nil, nil, fmt.Errorf("value %q is neither a number nor an enum value", value)
+		}
+		return nil, nil, err
+	}
+	val, err := parseSuffixedValue(value, format.suffixes, canonical)
+	if err != nil {
+		return nil, nil, err
+	}
+	return []float64{val}, []float64{1}, nil
+}
+
+// parseWeightedRecordValue parses a bare number or a prometheus result as is, see parseMetricValue.
+func parseWeightedRecordValue(value, weightLabel string) (samples, weights []float64, err error) {
+	value = strings.TrimSpace(value)
+	if !strings.HasPrefix(value, "[") {
+		val, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return nil, nil, err
+		}
+		return []float64{val}, []float64{1}, nil
+	}
+	var series []promSeries
+	if err := json.Unmarshal([]byte(value), &series); err != nil {
+		return nil, nil, err
+	}
+	samples = make([]float64, 0, len(series))
+	weights = make([]float64, 0, len(series))
+	for _, s := range series {
+		pairs := s.Values
+		if len(s.Value) != 0 {
+			pairs = append(pairs, s.Value)
+		}
+		weight := seriesWeight(s, weightLabel)
+		for _, pair := range pairs {
+			val, err := parsePromSample(pair)
+			if err != nil {
+				return nil, nil, err
+			}
+			samples = append(samples, val)
+			weights = append(weights, weight)
+		}
+	}
+	return samples, weights, nil
+}
+
+// seriesWeight returns the weight of s by its weightLabel, see parseMetricValue.
+func seriesWeight(s promSeries, weightLabel string) float64 {
+	if weightLabel == "" {
+		return 1
+	}
+	weight, err := strconv.ParseFloat(s.Metric[weightLabel], 64)
+	if err != nil || weight < 0 || math.IsNaN(weight) || math.IsInf(weight, 0) {
+		return 1
+	}
+	return weight
+}
+
+// parsePromSample parses one [timestamp, "value"] pair of prometheus result.
+func parsePromSample(pair []interface{}) (float64, error) {
+	if len(pair) != 2 {
+		return 0, fmt.Errorf("invalid prometheus sample %v", pair)
+	}
+	str, ok := pair[1].(string)
+	if !ok {
+		return 0, fmt.Errorf("invalid prometheus sample value %v", pair[1])
+	}
+	return strconv.ParseFloat(str, 64)
+}
+
+// convertRecords returns a copy of records with each bare number and prometheus result multiplied by factor,
+// e.g. to merge the records of another unit, see mergeMetricInfo. Other values, e.g. suffixed or enum values,
+// do not depend on the unit of the records and are kept as is, so is a value which can not be parsed.
+func convertRecords(records []schedv1alpha1.Record, factor float64) []schedv1alpha1.Record {
+	res := make([]schedv1alpha1.Record, len(records))
+	for i, r := range records {
+		res[i] = r
+		if factor != 1 {
+			res[i].Value = convertRecordValue(r.Value, factor)
+		}
+	}
+	return res
+}
+
+// convertRecordValue multiplies a bare number or each sample of a prometheus result by factor, see convertRecords.
+func convertRecordValue(value string, factor float64) string {
+	trimmed := strings.TrimSpace(value)
+	if !strings.HasPrefix(trimmed, "[") {
+		val, err := strconv.ParseFloat(trimmed, 64)
+		if err != nil {
+			return value
+		}
+		return strconv.FormatFloat(val*factor, 'g', -1, 64)
+	}
+	var series []promSeries
+	if err := json.Unmarshal([]byte(trimmed), &series); err != nil {
+		return value
+	}
+	for _, s := range series {
+		pairs := s.Values
+		if len(s.Value) != 0 {
+			pairs = append(pairs, s.Value)
+		}
+		for _, pair := range pairs {
+			val, err := parsePromSample(pair)
+			if err != nil {
+				return value
+			}
+			pair[1] = strconv.FormatFloat(val*factor, 'g', -1, 64)
+		}
+	}
+	converted, err := json.Marshal(series)
+	if err != nil {
+		return value
+	}
+	return string(converted)
+}
+
+// parseSuffixedValue parses a bare number with a unit suffix like "47%" or "14.25m" into canonical,
+// the canonical unit of the metric. Only suffixes in suffixes are stripped, the longest matching one wins,
+// and it must be a known unit converting to canonical, e.g. "m" for a metric in cores, see knownUnits.
+func parseSuffixedValue(value string, suffixes []string, canonical string) (float64, error) {
+	value = strings.TrimSpace(value)
+	suffix := ""
+	for _, s := range suffixes {
+		if len(s) > len(suffix) && strings.HasSuffix(value, s) {
+			suffix = s
+		}
+	}
+	if suffix == "" {
+		return 0, fmt.Errorf("value %q has none of the suffixes %v", value, suffixes)
+	}
+	unit, ok := knownUnits[suffix]
+	if !ok {
+		return 0, fmt.Errorf("unknown unit %q of value %q", suffix, value)
+	}
+	if unit.unit != canonical {
+		return 0, fmt.Errorf("unit %q of value %q can not be converted to %q", suffix, value, canonical)
+	}
+	val, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(value, suffix)), 64)
+	if err != nil {
+		return 0, err
+	}
+	return val * unit.factor, nil
+}
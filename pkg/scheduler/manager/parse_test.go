@@ -0,0 +1,303 @@
+/*
+Copyright 2022 The Arbiter Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manager
+
+import (
+	"context"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	schedv1alpha1 "github.com/kube-arbiter/arbiter/pkg/apis/v1alpha1"
+)
+
+func TestParseMetricValue(t *testing.T) {
+	format := valueFormat{
+		suffixes:    []string{"%", "m", "Mi", "Gi"},
+		enums:       map[string]float64{"up": 1, "down": 0},
+		weightLabel: "samples",
+	}
+	for _, tc := range []struct {
+		value      string
+		unit       string
+		format     valueFormat
+		exp        []float64
+		expWeights []float64
+		expErr     bool
+	}{
+		{value: "0.470097", exp: []float64{0.470097}, expWeights: []float64{1}},
+		{value: " 3 ", exp: []float64{3}, expWeights: []float64{1}},
+		{value: `[{"metric":{},"values":[[1666949631.719,"14.25"]]}]`, exp: []float64{14.25}, expWeights: []float64{1}},
+		{value: `[{"metric":{},"values":[[1666949631.719,"1"],[1666949661.719,"2"]]}]`, exp: []float64{1, 2}, expWeights: []float64{1, 1}},
+		{value: `[{"metric":{},"value":[1666949631.719,"7.5"]}]`, exp: []float64{7.5}, expWeights: []float64{1}},
+		{value: "[]", exp: []float64{}, expWeights: []float64{}},
+		{value: "abc", expErr: true},
+		{value: `[{"metric":{},"values":[[1666949631.719,"x"]]}]`, expErr: true},
+		{value: `[{"metric":{},"values":[[1666949631.719]]}]`, expErr: true},
+		// values are converted to the canonical unit.
+		{value: "1.5", unit: "cores", exp: []float64{1500}, expWeights: []float64{1}},
+		{value: `[{"metric":{},"value":[1666949631.719,"2"]}]`, unit: "Ki", exp: []float64{2048}, expWeights: []float64{1}},
+		{value: "1", unit: "furlong", expErr: true},
+		// suffixes and enums are only parsed by the format.
+		{value: "47%", unit: "%", expErr: true},
+		{value: "up", expErr: true},
+		{value: "47%", unit: "%", format: format, exp: []float64{47}, expWeights: []float64{1}},
+		{value: "250m", unit: "cores", format: format, exp: []float64{250}, expWeights: []float64{1}},
+		{value: "2Gi", unit: "Mi", format: format, exp: []float64{2 << 30}, expWeights: []float64{1}},
+		{value: "2Gi", unit: "cores", format: format, expErr: true},
+		{value: " up ", unit: "%", format: format, exp: []float64{1}, expWeights: []float64{1}},
+		{value: "sideways", format: format, expErr: true},
+		{value: "1.5", unit: "cores", format: format, exp: []float64{1500}, expWeights: []float64{1}},
+		{value: `[{"metric":{"samples":"4"},"value":[1666949631.719,"2"]}]`, unit: "Ki", format: format, exp: []float64{2048}, expWeights: []float64{4}},
+		{value: "up", unit: "furlong", format: format, expErr: true},
+	} {
+		r, weights, err := parseMetricValue(tc.value, tc.unit, tc.format)
+		if tc.expErr {
+			if err == nil {
+				t.Fatalf("parse %q in %q expect error get %v", tc.value, tc.unit, r)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("parse %q in %q get err %v", tc.value, tc.unit, err)
+		}
+		if !reflect.DeepEqual(tc.exp, r) || !reflect.DeepEqual(tc.expWeights, weights) {
+			t.Fatalf("parse %q in %q expect %v weighted %v get %v weighted %v", tc.value, tc.unit, tc.exp, tc.expWeights, r, weights)
+		}
+	}
+}
+
+func FuzzParseMetricValue(f *testing.F) {
+	format := valueFormat{
+		suffixes:    []string{"%", "m", "Mi", "Gi"},
+		enums:       map[string]float64{"up": 1, "down": 0},
+		weightLabel: "samples",
+	}
+	for _, seed := range []struct{ value, unit string }{
+		// bare numbers.
+		{"0.470097", ""},
+		{" 3 ", "m"},
+		{"1e3", "byte"},
+		{"-12.5", "%"},
+		{"+Inf", ""},
+		{"NaN", "cores"},
+		// prometheus results.
+		{"[]", ""},
+		{`[{"metric":{},"values":[[1666949631.719,"14.25"]]}]`, "Gi"},
+		{`[{"metric":{"samples":"4"},"value":[1666949631.719,"7.5"]}]`, "n"},
+		{`[{"metric":{"samples":"-1"},"value":[1666949631.719,"7.5"]}]`, ""},
+		// suffixed and percent values.
+		{"14.25m", "m"},
+		{"2Mi", "Mi"},
+		{"2Gi", "cores"},
+		{"47%", "%"},
+		{" 47 % ", "%"},
+		// enum values.
+		{"up", ""},
+		{" down ", "%"},
+		// garbage.
+		{`[{"metric":{},"values":[[1666949631.719]]}]`, ""},
+		{`[{"metric":{},"value":[1666949631.719,7.5]}]`, ""},
+		{`[{`, ""},
+		{"%", "%"},
+		{"abc", "furlong"},
+		{"", ""},
+	} {
+		f.Add(seed.value, seed.unit)
+	}
+	f.Fuzz(func(t *testing.T, value, unit string) {
+		values, weights, err := parseMetricValue(value, unit, format)
+		if err != nil {
+			if values != nil || weights != nil {
+				t.Fatalf("parse %q in %q expect no value with error %v get %v weighted %v", value, unit, err, values, weights)
+			}
+			return
+		}
+		_, factor, ok := normalizeUnit(unit)
+		if !ok {
+			t.Fatalf("parse %q in unknown unit %q expect error get %v", value, unit, values)
+		}
+		if len(values) != len(weights) {
+			t.Fatalf("parse %q in %q get %v weighted %v", value, unit, values, weights)
+		}
+		for _, w := range weights {
+			if w < 0 || math.IsNaN(w) || math.IsInf(w, 0) {
+				t.Fatalf("parse %q in %q get invalid weight %v", value, unit, weights)
+			}
+		}
+		if bare, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil && !math.IsNaN(bare) {
+			if len(values) != 1 || values[0] != bare*factor {
+				t.Fatalf("parse %q in %q expect [%v] get %v", value, unit, bare*factor, values)
+			}
+		}
+		if val, ok := format.enums[strings.TrimSpace(value)]; ok {
+			if len(values) != 1 || values[0] != val {
+				t.Fatalf("parse %q in %q expect [%v] get %v", value, unit, val, values)
+			}
+		}
+	})
+}
+
+func TestConvertRecordValue(t *testing.T) {
+	for _, tc := range []struct {
+		value string
+		exp   string
+	}{
+		{value: " 1.5 ", exp: "1500"},
+		{value: `[{"metric":{"samples":"4"},"values":[[1666949631.719,"0.5"],[1666949661.719,"2"]]}]`,
+			exp: `[{"metric":{"samples":"4"},"value":null,"values":[[1666949631.719,"500"],[1666949661.719,"2000"]]}]`},
+		// suffixed, enum and unparsable values are kept.
+		{value: "250m", exp: "250m"},
+		{value: "up", exp: "up"},
+		{value: `[{"metric":{},"value":[1666949631.719,7.5]}]`, exp: `[{"metric":{},"value":[1666949631.719,7.5]}]`},
+	} {
+		if v := convertRecordValue(tc.value, 1000); v != tc.exp {
+			t.Fatalf("convert %q expect %q get %q", tc.value, tc.exp, v)
+		}
+	}
+}
+
+func TestParseWeightedRecordValue(t *testing.T) {
+	for _, tc := range []struct {
+		value      string
+		expValues  []float64
+		expWeights []float64
+	}{
+		{value: "3", expValues: []float64{3}, expWeights: []float64{1}},
+		{value: `[{"metric":{"samples":"4"},"values":[[1666949631.719,"1"],[1666949661.719,"2"]]}]`, expValues: []float64{1, 2}, expWeights: []float64{4, 4}},
+		{value: `[{"metric":{"samples":"0"},"value":[1666949631.719,"1"]},{"metric":{},"value":[1666949631.719,"2"]}]`, expValues: []float64{1, 2}, expWeights: []float64{0, 1}},
+		{value: `[{"metric":{"samples":"-1"},"value":[1666949631.719,"1"]},{"metric":{"samples":"x"},"value":[1666949631.719,"2"]}]`, expValues: []float64{1, 2}, expWeights: []float64{1, 1}},
+	} {
+		values, weights, err := parseWeightedRecordValue(tc.value, "samples")
+		if err != nil {
+			t.Fatalf("parse %q get err %v", tc.value, err)
+		}
+		if !reflect.DeepEqual(tc.expValues, values) || !reflect.DeepEqual(tc.expWeights, weights) {
+			t.Fatalf("parse %q expect %v weighted %v get %v weighted %v", tc.value, tc.expValues, tc.expWeights, values, weights)
+		}
+	}
+}
+
+func TestObservabilityIndicantAddPrometheusValue(t *testing.T) {
+	mgr := newTestManager(t)
+	obi := newNodeOBI("obi", "node1", map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo{
+		"cpu": {{Records: newRecords(`[{"metric":{},"values":[[1666949631.719,"14.25"]]}]`, "[]", "15.75")}},
+	})
+	mgr.ObservabilityIndicantAdd(obi)
+	if m := getNodeMetric(t, mgr, obi, "node1", "cpu"); m.Avg != 15 || m.Max != 15.75 || m.Min != 14.25 {
+		t.Fatalf("unexpected metric %+v", m)
+	}
+}
+
+func TestParseSuffixedValue(t *testing.T) {
+	for _, tc := range []struct {
+		value     string
+		suffixes  []string
+		canonical string
+		exp       float64
+		expErr    bool
+	}{
+		{value: "47%", suffixes: []string{"%"}, canonical: "%", exp: 47},
+		{value: " 47 % ", suffixes: []string{"%"}, canonical: "%", exp: 47},
+		{value: "14.25m", suffixes: []string{"m", "n"}, canonical: MilliCPUUnit, exp: 14.25},
+		{value: "500000n", suffixes: []string{"m", "n"}, canonical: MilliCPUUnit, exp: 0.5},
+		// the longest suffix wins, Mi is not m.
+		{value: "2Mi", suffixes: []string{"i", "Mi"}, canonical: ByteUnit, exp: 2 << 20},
+		{value: "47%", suffixes: []string{"m"}, canonical: MilliCPUUnit, expErr: true},
+		{value: "47%", suffixes: []string{"%"}, canonical: MilliCPUUnit, expErr: true},
+		{value: "14.25x", suffixes: []string{"x"}, canonical: "", expErr: true},
+		{value: "abc%", suffixes: []string{"%"}, canonical: "%", expErr: true},
+	} {
+		val, err := parseSuffixedValue(tc.value, tc.suffixes, tc.canonical)
+		if tc.expErr {
+			if err == nil {
+				t.Fatalf("parse %q expect error get %v", tc.value, val)
+			}
+			continue
+		}
+		if err != nil || val != tc.exp {
+			t.Fatalf("parse %q expect %v get %v %v", tc.value, tc.exp, val, err)
+		}
+	}
+}
+
+func TestObservabilityIndicantAddSuffixedValue(t *testing.T) {
+	metrics := map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo{
+		"usage": {{Unit: "%", Records: newRecords("47%", "53", "unknown%")}},
+		"cpu":   {{Unit: "C", Records: newRecords("14.25m", "0.5", "abc")}},
+	}
+	mgr := newTestManager(t, WithValueSuffixes(map[string][]string{"usage": {"%"}, "cpu": {"m"}}))
+	obi := newNodeOBI("obi", "node1", metrics)
+	mgr.ObservabilityIndicantAdd(obi)
+	// unparseable values are skipped.
+	if m := getNodeMetric(t, mgr, obi, "node1", "usage"); m.Count != 2 || m.Avg != 50 {
+		t.Fatalf("expect usage of 47 and 53 get %+v", m)
+	}
+	if m := getNodeMetric(t, mgr, obi, "node1", "cpu"); m.Count != 2 || m.Min != 14.25 || m.Max != 500 {
+		t.Fatalf("expect cpu of 14.25m and 500m get %+v", m)
+	}
+
+	// suffixes are not stripped by default.
+	mgr = newTestManager(t)
+	mgr.ObservabilityIndicantAdd(obi)
+	if m := getNodeMetric(t, mgr, obi, "node1", "usage"); m.Count != 1 || m.Avg != 53 {
+		t.Fatalf("expect only the bare usage get %+v", m)
+	}
+}
+
+func TestObservabilityIndicantAddEnumValue(t *testing.T) {
+	obi := newNodeOBI("obi", "node1", map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo{
+		"health": {{Records: newRecords("healthy", "degraded", " critical", "unknown", "healthy")}},
+	})
+	mgr := newTestManager(t, WithEnumValues(map[string]map[string]float64{"health": {"healthy": 100, "degraded": 50, "critical": 0}}))
+	mgr.ObservabilityIndicantAdd(obi)
+	// unknown is skipped, the rest are 100, 50, 0 and 100.
+	m := getNodeMetric(t, mgr, obi, "node1", "health")
+	if m.Count != 4 || m.Avg != 62.5 || m.Min != 0 || m.Max != 100 || m.Latest != 100 {
+		t.Fatalf("expect health mapped to numbers get %+v", m)
+	}
+
+	// no string is parsed by default.
+	mgr = newTestManager(t)
+	mgr.ObservabilityIndicantAdd(obi)
+	if _, err := mgr.GetNodeMetric(context.Background(), "node1", "health"); err == nil {
+		t.Fatalf("expect health without enum values not cached")
+	}
+}
+
+func TestObservabilityIndicantAddNonFinite(t *testing.T) {
+	records := newRecords("+Inf", "NaN", "5", "-Inf")
+	records = append(records, schedv1alpha1.Record{Timestamp: 300000, Value: `[{"metric":{},"value":[300,"+Inf"]}]`})
+	obi := newNodeOBI("obi", "node1", map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo{
+		"ratio": {{Records: records}},
+		"nan":   {{Records: newRecords("NaN")}},
+	})
+	mgr := newTestManager(t)
+	mgr.ObservabilityIndicantAdd(obi)
+	m := getNodeMetric(t, mgr, obi, "node1", "ratio")
+	if m.Count != 1 || m.Avg != 5 || m.Max != 5 || m.Min != 5 || m.Latest != 5 || m.P99 != 5 {
+		t.Fatalf("expect only the finite value aggregated get %+v", m)
+	}
+	if m.NonFinite != 4 {
+		t.Fatalf("expect 4 non-finite values get %d", m.NonFinite)
+	}
+	if _, err := mgr.GetNodeMetric(context.Background(), "node1", "nan"); err == nil {
+		t.Fatalf("expect metric without finite values not cached")
+	}
+}
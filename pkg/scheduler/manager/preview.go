@@ -0,0 +1,92 @@
+/*
+Copyright 2022 The Arbiter Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manager
+
+import (
+	"context"
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+)
+
+// PreviewScores evaluates the Score of the pod namespace selecting the pod, see GetScoreForPod, against the cached
+// OBI of each node in nodeNames, the same way as the scheduler does, without affecting any scheduling.
+// One ScoreResult is returned for each node, Result is the weighted score of all Score on the node and
+// Details is the result of each Score in the order of their names. They are ranked by SortScoreResults.
+func (mgr *manager) PreviewScores(ctx context.Context, pod *v1.Pod, nodeNames []string) ([]ScoreResult, error) {
+	scores, totalWeight, _ := mgr.GetScoreForPod(ctx, pod)
+	if totalWeight <= 0 {
+		return nil, fmt.Errorf("no valid Score for pod %s/%s", pod.Namespace, pod.Name)
+	}
+	// OBI of the pod is optional, the same as scheduling.
+	podOBI, _ := mgr.GetPodOBI(ctx, pod)
+	podWithOBI := NewPodWithOBI(pod, podOBI)
+	// the cluster metrics are the same for all nodes, the same as a scheduling cycle.
+	cluster := mgr.ClusterMetrics(ctx)
+
+	res := make([]ScoreResult, 0, len(nodeNames))
+	for _, nodeName := range nodeNames {
+		nodeResult := ScoreResult{NodeName: nodeName}
+		nodeWithOBI, err := mgr.nodeWithOBI(ctx, nodeName)
+		if err != nil {
+			nodeResult.Err = err
+			res = append(res, nodeResult)
+			continue
+		}
+		for _, score := range scores {
+			score.NodeName = nodeName
+			score.Result, score.Err = EvaluateScoreResultInCluster(score, podWithOBI, nodeWithOBI, cluster)
+			nodeResult.Details = append(nodeResult.Details, score)
+		}
+		nodeResult.Result = WeightedScore(nodeResult.Details, totalWeight)
+		res = append(res, nodeResult)
+	}
+	SortScoreResults(res)
+	return res, nil
+}
+
+// nodeWithOBI builds the NodeWithOBI of nodeName used by score logic,
+// the requested resources are only filled if the scheduler snapshot is available.
+func (mgr *manager) nodeWithOBI(ctx context.Context, nodeName string) (*NodeWithOBI, error) {
+	// OBI of the node is optional, the same as scheduling.
+	obi, _ := mgr.GetNodeOBI(ctx, nodeName)
+	if mgr.snapshotSharedLister != nil {
+		nodeInfo, err := mgr.snapshotSharedLister.NodeInfos().Get(nodeName)
+		if err == nil && nodeInfo.Node() != nil {
+			nodeWithOBI := NewNodeWithOBI(nodeInfo.Node(), obi)
+			nodeWithOBI.CPUReq, nodeWithOBI.MemReq = nodeInfo.NonZeroRequested.MilliCPU, nodeInfo.NonZeroRequested.Memory
+			return nodeWithOBI, nil
+		}
+	}
+	node, err := mgr.GetNode(nodeName)
+	if err != nil {
+		return nil, err
+	}
+	return NewNodeWithOBI(node, obi), nil
+}
+
+// newNodeWithOBI is the same as NewNodeWithOBI, with the requested resources of node filled if it is in the
+// scheduler snapshot.
+func (mgr *manager) newNodeWithOBI(node *v1.Node, obi map[string]OBI) *NodeWithOBI {
+	nodeWithOBI := NewNodeWithOBI(node, obi)
+	if mgr.snapshotSharedLister != nil {
+		if nodeInfo, err := mgr.snapshotSharedLister.NodeInfos().Get(node.Name); err == nil {
+			nodeWithOBI.CPUReq, nodeWithOBI.MemReq = nodeInfo.NonZeroRequested.MilliCPU, nodeInfo.NonZeroRequested.Memory
+		}
+	}
+	return nodeWithOBI
+}
@@ -0,0 +1,111 @@
+/*
+Copyright 2022 The Arbiter Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manager
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+
+	schedv1alpha1 "github.com/kube-arbiter/arbiter/pkg/apis/v1alpha1"
+	"github.com/kube-arbiter/arbiter/pkg/generated/clientset/versioned/fake"
+)
+
+func TestPreviewScores(t *testing.T) {
+	factory := informers.NewSharedInformerFactory(kubefake.NewSimpleClientset(), 0)
+	for _, name := range []string{"node1", "node2", "node3"} {
+		if err := factory.Core().V1().Nodes().Informer().GetIndexer().Add(&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: name}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mgr := NewManager(fake.NewSimpleClientset(), nil, factory.Core().V1().Pods(), factory.Core().V1().Nodes())
+	for node, cpu := range map[string]string{"node1": "80", "node2": "20", "node3": "50"} {
+		mgr.ObservabilityIndicantAdd(newNodeOBI("cpu", node, map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo{
+			"cpu": {{Records: newRecords(cpu)}},
+		}))
+	}
+	mgr.ScoreAdd(newScore("ns1", "least-cpu", 3, `function score() { return 100 - node.obi["default-cpu"].metric.cpu.avg; }`))
+	mgr.ScoreAdd(newScore("ns1", "constant", 1, "function score() { return 40; }"))
+
+	pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "ns1", Name: "pod1"}}
+	res, err := mgr.PreviewScores(context.Background(), pod, []string{"node1", "node2", "node3", "unknown"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var nodes []string
+	var results []int64
+	for _, r := range res {
+		nodes = append(nodes, r.NodeName)
+		results = append(results, r.Result)
+	}
+	// (3*(100-cpu) + 40) / 4, unknown node can not be scored.
+	if exp := []string{"node2", "node3", "node1", "unknown"}; !reflect.DeepEqual(exp, nodes) {
+		t.Fatalf("expect ranking %v get %v", exp, nodes)
+	}
+	if exp := []int64{70, 47, 25, 0}; !reflect.DeepEqual(exp, results) {
+		t.Fatalf("expect results %v get %v", exp, results)
+	}
+	if len(res[0].Details) != 2 || res[3].Err == nil {
+		t.Fatalf("expect details of each score and error of unknown node, get %+v", res)
+	}
+
+	if _, err := mgr.PreviewScores(context.Background(), &v1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "ns2", Name: "pod1"}}, []string{"node1"}); err == nil {
+		t.Fatalf("expect error without any Score")
+	}
+}
+
+func TestPreviewScoresNodeLabelsAndTaints(t *testing.T) {
+	factory := informers.NewSharedInformerFactory(kubefake.NewSimpleClientset(), 0)
+	for _, node := range []*v1.Node{
+		{ObjectMeta: metav1.ObjectMeta{Name: "spot", Labels: map[string]string{"node.kubernetes.io/lifecycle": "spot"}}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "normal"}},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "tainted"},
+			Spec:       v1.NodeSpec{Taints: []v1.Taint{{Key: "dedicated", Value: "gpu", Effect: v1.TaintEffectPreferNoSchedule}}},
+		},
+	} {
+		if err := factory.Core().V1().Nodes().Informer().GetIndexer().Add(node); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mgr := NewManager(fake.NewSimpleClientset(), nil, factory.Core().V1().Pods(), factory.Core().V1().Nodes())
+	mgr.ScoreAdd(newScore("ns1", "avoid-spot", 1, `function score() {
+	if (node.labels["node.kubernetes.io/lifecycle"] === "spot") { return 10; }
+	if (node.taints.length > 0) { return 50; }
+	return 90;
+}`))
+
+	res, err := mgr.PreviewScores(context.Background(), &v1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "ns1", Name: "pod1"}}, []string{"spot", "normal", "tainted"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]int64, len(res))
+	for _, r := range res {
+		if r.Err != nil {
+			t.Fatalf("expect node %s scored get %v", r.NodeName, r.Err)
+		}
+		got[r.NodeName] = r.Result
+	}
+	if exp := map[string]int64{"spot": 10, "normal": 90, "tainted": 50}; !reflect.DeepEqual(exp, got) {
+		t.Fatalf("expect scores %v get %v", exp, got)
+	}
+}
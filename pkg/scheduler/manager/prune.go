@@ -0,0 +1,58 @@
+/*
+Copyright 2022 The Arbiter Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manager
+
+import (
+	gocache "github.com/patrickmn/go-cache"
+)
+
+// PruneEmpty removes the node, pod and Score caches which hold no item anymore, e.g. all OBI of a
+// target are expired by the metric TTL. Expired items are deleted before the check.
+// It returns the number of removed caches, and is safe to call on a timer along with the informer handlers.
+func (mgr *manager) PruneEmpty() int {
+	pruned := 0
+	mgr.Lock()
+	for kind, handler := range mgr.targets {
+		n := pruneEmptyCaches(handler.metrics)
+		if n > 0 {
+			mgr.logger.V(5).Info(ManagerLogPrefix+"prune empty metric caches", "kind", kind, "count", n)
+		}
+		pruned += n
+	}
+	mgr.Unlock()
+
+	mgr.scoreLock.Lock()
+	n := pruneEmptyCaches(mgr.score)
+	mgr.scoreLock.Unlock()
+	if n > 0 {
+		mgr.logger.V(5).Info(ManagerLogPrefix+"prune empty score caches", "count", n)
+	}
+	return pruned + n
+}
+
+// pruneEmptyCaches deletes the empty caches and returns how many are deleted, the caller must hold the write lock.
+func pruneEmptyCaches(caches map[string]*gocache.Cache) int {
+	pruned := 0
+	for key, c := range caches {
+		c.DeleteExpired()
+		if c.ItemCount() == 0 {
+			delete(caches, key)
+			pruned++
+		}
+	}
+	return pruned
+}
@@ -0,0 +1,88 @@
+/*
+Copyright 2022 The Arbiter Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manager
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	gocache "github.com/patrickmn/go-cache"
+
+	schedv1alpha1 "github.com/kube-arbiter/arbiter/pkg/apis/v1alpha1"
+)
+
+func TestPruneEmpty(t *testing.T) {
+	mgr := newTestManager(t, WithMetricTTL(time.Millisecond, gocache.NoExpiration))
+	cpu := map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo{
+		"cpu": {{Records: newRecords("1")}},
+	}
+	mgr.ObservabilityIndicantAdd(newNodeOBI("cpu", "node1", cpu))
+	mgr.ObservabilityIndicantAdd(newPodOBI("pod-cpu", "ns1", "pod1", cpu))
+	mgr.ScoreAdd(newScore("ns1", "score1", 1, "function score(){return 1}"))
+	mgr.ScoreAdd(newScore("ns2", "score1", 1, "function score(){return 1}"))
+	if n := mgr.PruneEmpty(); n != 0 {
+		t.Fatalf("expect nothing pruned before caches are empty, get %d", n)
+	}
+
+	// the OBIs expire without the janitor, ns2 is emptied without the delete event.
+	time.Sleep(10 * time.Millisecond)
+	mgr.score["ns2"].Delete("score1")
+	if len(mgr.nodeMetric) != 1 || len(mgr.podMetric) != 1 || len(mgr.score) != 2 {
+		t.Fatalf("expect empty caches still in map, get %d nodes %d pods %d namespaces", len(mgr.nodeMetric), len(mgr.podMetric), len(mgr.score))
+	}
+	if n := mgr.PruneEmpty(); n != 3 {
+		t.Fatalf("expect 3 caches pruned, get %d", n)
+	}
+	if len(mgr.nodeMetric) != 0 || len(mgr.podMetric) != 0 {
+		t.Fatalf("expect metric caches pruned, get %d nodes %d pods", len(mgr.nodeMetric), len(mgr.podMetric))
+	}
+	if _, ok := mgr.score["ns1"]; !ok || len(mgr.score) != 1 {
+		t.Fatalf("expect only ns1 score cache left, get %v", mgr.score)
+	}
+
+	// a pruned target is cached again by the next add.
+	mgr.ObservabilityIndicantAdd(newNodeOBI("cpu", "node1", cpu))
+	if _, ok := mgr.nodeMetric["node1"]; !ok {
+		t.Fatalf("expect node1 cached after prune")
+	}
+}
+
+func TestPruneEmptyConcurrentAdd(t *testing.T) {
+	mgr := newTestManager(t)
+	cpu := map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo{
+		"cpu": {{Records: newRecords("1")}},
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			mgr.ObservabilityIndicantAdd(newNodeOBI("cpu", fmt.Sprintf("node%d", i), cpu))
+			mgr.ScoreAdd(newScore(fmt.Sprintf("ns%d", i), "score1", 1, "function score(){return 1}"))
+		}(i)
+		go func() {
+			defer wg.Done()
+			mgr.PruneEmpty()
+		}()
+	}
+	wg.Wait()
+	if stats := mgr.Stats(); stats.Nodes != 10 || stats.Scores != 10 {
+		t.Fatalf("expect non-empty caches survive prune, get %+v", stats)
+	}
+}
@@ -0,0 +1,78 @@
+/*
+Copyright 2022 The Arbiter Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manager
+
+import (
+	"context"
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+)
+
+// ResyncAll rebuilds the Score and OBI caches from scratch with the Score and OBI listed by the clientset,
+// e.g. the caches are out of sync after a transient informer error. The caches are replaced under the write
+// locks, so the entries of the objects which do not exist anymore are dropped, and the getters see either
+// the old or the new caches. The caches are kept as they are if listing fails.
+func (mgr *manager) ResyncAll(ctx context.Context) error {
+	logger := mgr.contextLogger(ctx)
+	scores, err := mgr.client.ArbiterV1alpha1().Scores(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("listing scores: %w", err)
+	}
+	obis, err := mgr.client.ArbiterV1alpha1().ObservabilityIndicants(metav1.NamespaceAll).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return fmt.Errorf("listing observability indicants: %w", err)
+	}
+	// compile before taking the lock, the same as ScoreAdd.
+	compiled := make([]cachedScore, len(scores.Items))
+	compileErrs := make([]error, len(scores.Items))
+	for i := range scores.Items {
+		compiled[i], compileErrs[i] = mgr.compileScore(&scores.Items[i])
+	}
+
+	defer mgr.broadcastPopulation()
+	// the Score lock is never held while acquiring the metric lock, so the order can't deadlock.
+	mgr.Lock()
+	defer mgr.Unlock()
+	mgr.scoreLock.Lock()
+	defer mgr.scoreLock.Unlock()
+	for _, handler := range mgr.targets {
+		for target := range handler.metrics {
+			delete(handler.metrics, target)
+		}
+	}
+	for ns := range mgr.score {
+		delete(mgr.score, ns)
+	}
+	for key := range mgr.invalidScores {
+		delete(mgr.invalidScores, key)
+	}
+	for i := range scores.Items {
+		score := &scores.Items[i]
+		mgr.addScoreLocked(logger.WithValues("namespace", score.Namespace, "score", score.Name), score.Namespace+"/"+score.Name, score.Namespace, score.Name, score, compiled[i], compileErrs[i])
+	}
+	for i := range obis.Items {
+		obi := &obis.Items[i]
+		obiLogger := logger.WithValues("obi", klog.KObj(obi))
+		if mgr.acceptOBI(obiLogger, obi) {
+			mgr.addOBILocked(obiLogger, obi)
+		}
+	}
+	logger.V(2).Info(ManagerLogPrefix+"resync all caches", "scores", len(scores.Items), "obis", len(obis.Items))
+	return nil
+}
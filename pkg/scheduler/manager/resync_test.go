@@ -0,0 +1,81 @@
+/*
+Copyright 2022 The Arbiter Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manager
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/informers"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+
+	schedv1alpha1 "github.com/kube-arbiter/arbiter/pkg/apis/v1alpha1"
+	"github.com/kube-arbiter/arbiter/pkg/generated/clientset/versioned/fake"
+)
+
+func TestResyncAll(t *testing.T) {
+	cpu := func(value string) map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo {
+		return map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo{"cpu": {{Records: newRecords(value)}}}
+	}
+	client := fake.NewSimpleClientset(
+		newScore("ns1", "score1", 1, "function score(){return 1}"),
+		newScore("ns1", "malformed", 1, "function score("),
+		newNodeOBI("obi1", "node1", cpu("5")),
+		newPodOBI("pod-obi", "ns1", "pod1", cpu("7")),
+	)
+	factory := informers.NewSharedInformerFactory(kubefake.NewSimpleClientset(), 0)
+	mgr := NewManager(client, nil, factory.Core().V1().Pods(), factory.Core().V1().Nodes(), WithNamespaceFallback(false))
+	ctx := context.Background()
+	// out of sync caches: a stale value of obi1, and objects which do not exist anymore.
+	mgr.ObservabilityIndicantAdd(newNodeOBI("obi1", "node1", cpu("1")))
+	mgr.ObservabilityIndicantAdd(newNodeOBI("gone", "node2", cpu("1")))
+	mgr.ScoreAdd(newScore("ns2", "gone", 1, "function score(){return 1}"))
+
+	if err := mgr.ResyncAll(ctx); err != nil {
+		t.Fatal(err)
+	}
+	obi1 := newNodeOBI("obi1", "node1", nil)
+	if m := getNodeMetric(t, mgr, obi1, "node1", "cpu"); m.Avg != 5 {
+		t.Fatalf("expect cpu of obi1 resynced to 5 get %+v", m)
+	}
+	if _, err := mgr.GetNodeOBI(ctx, "node2"); !errors.Is(err, ErrNotFoundInCache) {
+		t.Fatalf("expect node2 dropped get %v", err)
+	}
+	if all := mgr.ListAllScores(ctx); len(all) != 1 || len(all["ns1"]) != 1 || all["ns1"][0].NameKey != "ns1/score1" {
+		t.Fatalf("expect only ns1/score1 get %+v", all)
+	}
+	if err := mgr.GetScoreError("ns1", "malformed"); err == nil {
+		t.Fatalf("expect the invalid logic of ns1/malformed recorded")
+	}
+	if stats := mgr.Stats(); stats.Nodes != 1 || stats.Pods != 1 {
+		t.Fatalf("expect 1 node and 1 pod get %+v", stats)
+	}
+
+	// the caches are kept if listing fails.
+	client.PrependReactor("list", "observabilityindicants", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.New("list failed")
+	})
+	if err := mgr.ResyncAll(ctx); err == nil {
+		t.Fatalf("expect error of listing")
+	}
+	if m := getNodeMetric(t, mgr, obi1, "node1", "cpu"); m.Avg != 5 {
+		t.Fatalf("expect cpu of obi1 kept get %+v", m)
+	}
+}
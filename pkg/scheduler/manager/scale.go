@@ -0,0 +1,138 @@
+/*
+Copyright 2022 The Arbiter Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manager
+
+import (
+	"encoding/json"
+	"fmt"
+
+	schedv1alpha1 "github.com/kube-arbiter/arbiter/pkg/apis/v1alpha1"
+)
+
+// MetricScale maps the aggregations of a metric type to value*Scale + Offset in the score logic, e.g. Scale
+// 1/(1<<30) for memory in GiB instead of bytes. A zero Scale is 1, so only Offset can be set, a negative one
+// is invalid. See WithMetricScales and MetricScaleAnnotation.
+type MetricScale struct {
+	Scale  float64 `json:"scale"`
+	Offset float64 `json:"offset"`
+}
+
+func (s MetricScale) apply(value float64) float64 {
+	if s.Scale == 0 {
+		return value + s.Offset
+	}
+	return value*s.Scale + s.Offset
+}
+
+// applyRate scales a rate of change, which the Offset does not change.
+func (s MetricScale) applyRate(value float64) float64 {
+	if s.Scale == 0 {
+		return value
+	}
+	return value * s.Scale
+}
+
+// applyTo returns m with every aggregation scaled, Count and the records are unchanged.
+func (s MetricScale) applyTo(m FullMetrics) FullMetrics {
+	for _, v := range []*float64{&m.Primary, &m.Avg, &m.Max, &m.Min, &m.WeightedAvg, &m.Median,
+		&m.P50, &m.P90, &m.P95, &m.P99, &m.EWMA, &m.Latest} {
+		*v = s.apply(*v)
+	}
+	// the sum of Count scaled values.
+	m.Sum = s.applyRate(m.Sum) + s.Offset*float64(m.Count)
+	m.Rate, m.Slope = s.applyRate(m.Rate), s.applyRate(m.Slope)
+	if m.Targets != nil {
+		targets := make(map[string]FullMetrics, len(m.Targets))
+		for item, t := range m.Targets {
+			targets[item] = s.applyTo(t)
+		}
+		m.Targets = targets
+	}
+	return m
+}
+
+// metricScalesOf returns the scales of mgr set by WithMetricScales overridden by the MetricScaleAnnotation
+// of score for the same metric types, nil if there is none.
+func (mgr *manager) metricScalesOf(score *schedv1alpha1.Score) (map[string]MetricScale, error) {
+	value, ok := score.Annotations[MetricScaleAnnotation]
+	if !ok {
+		return mgr.metricScales, nil
+	}
+	var scales map[string]MetricScale
+	if err := json.Unmarshal([]byte(value), &scales); err != nil {
+		return nil, fmt.Errorf("invalid %s %q: %w", MetricScaleAnnotation, value, err)
+	}
+	merged := make(map[string]MetricScale, len(mgr.metricScales)+len(scales))
+	for metricType, s := range mgr.metricScales {
+		merged[metricType] = s
+	}
+	for metricType, s := range scales {
+		if s.Scale < 0 {
+			return nil, fmt.Errorf("invalid %s %q: negative scale of %s", MetricScaleAnnotation, value, metricType)
+		}
+		merged[metricType] = s
+	}
+	return merged, nil
+}
+
+// scaleMetrics returns a copy of metrics with the metric types in scales scaled.
+func scaleMetrics(metrics map[string]FullMetrics, scales map[string]MetricScale) map[string]FullMetrics {
+	if metrics == nil {
+		return nil
+	}
+	res := make(map[string]FullMetrics, len(metrics))
+	for metricType, m := range metrics {
+		if s, ok := scales[metricType]; ok {
+			m = s.applyTo(m)
+		}
+		res[metricType] = m
+	}
+	return res
+}
+
+// scaleOBIs returns a copy of obi with the metric types in scales scaled.
+func scaleOBIs(obi map[string]OBI, scales map[string]MetricScale) map[string]OBI {
+	if obi == nil {
+		return nil
+	}
+	res := make(map[string]OBI, len(obi))
+	for k, o := range obi {
+		res[k] = OBI{Metric: scaleMetrics(o.Metric, scales)}
+	}
+	return res
+}
+
+// scaleScoreContext returns the pod, node and cluster of a Score with the metric types in scales scaled,
+// the arguments are not modified since they are shared by the Score evaluated on the same node.
+func scaleScoreContext(pod *PodWithOBI, node *NodeWithOBI, cluster ClusterMetrics, scales map[string]MetricScale) (*PodWithOBI, *NodeWithOBI, ClusterMetrics) {
+	scaledPod, scaledNode := *pod, *node
+	scaledPod.OBI, scaledPod.Metric = scaleOBIs(pod.OBI, scales), scaleMetrics(pod.Metric, scales)
+	scaledNode.OBI, scaledNode.Metric = scaleOBIs(node.OBI, scales), scaleMetrics(node.Metric, scales)
+	// the metrics in the json encoded once for all Score are not scaled.
+	scaledNode.encoded = nil
+	if cluster.Metric != nil {
+		metrics := make(map[string]ClusterMetric, len(cluster.Metric))
+		for metricType, c := range cluster.Metric {
+			if s, ok := scales[metricType]; ok {
+				c.Mean, c.Max, c.Min = s.apply(c.Mean), s.apply(c.Max), s.apply(c.Min)
+			}
+			metrics[metricType] = c
+		}
+		cluster.Metric = metrics
+	}
+	return &scaledPod, &scaledNode, cluster
+}
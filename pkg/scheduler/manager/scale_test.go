@@ -0,0 +1,73 @@
+/*
+Copyright 2022 The Arbiter Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manager
+
+import (
+	"context"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestEvaluateScaledMetric(t *testing.T) {
+	const logic = "function score() { return node.metric.memory.avg > 1 ? 100 : 0; }"
+	mgr := newTestManager(t, WithNamespaceFallback(false), WithMetricScales(map[string]MetricScale{"memory": {Scale: 1e-3}}))
+	mgr.ScoreAdd(newScore("ns1", "unscaled", 1, logic))
+	gib := newScore("ns1", "gib", 1, logic)
+	gib.Annotations = map[string]string{MetricScaleAnnotation: `{"memory":{"scale":1e-9},"cpu":{"scale":1000}}`}
+	mgr.ScoreAdd(gib)
+	invalid := newScore("ns1", "invalid", 1, logic)
+	invalid.Annotations = map[string]string{MetricScaleAnnotation: `{"memory":{"scale":-1}}`}
+	mgr.ScoreAdd(invalid)
+	if err := mgr.GetScoreError("ns1", "invalid"); err == nil {
+		t.Fatalf("expect negative scale rejected")
+	}
+
+	node := &NodeWithOBI{Metric: map[string]FullMetrics{"memory": {Avg: 5e8, Count: 1}, "cpu": {Avg: 2}}}
+	res, _, _ := mgr.GetScoreWithDiagnostics(context.Background(), "ns1")
+	exp := map[string]int64{"ns1/gib": 0, "ns1/unscaled": 100}
+	if len(res) != len(exp) {
+		t.Fatalf("expect %d Score get %v", len(exp), scoreNames(res))
+	}
+	pod := &PodWithOBI{Pod: v1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "ns1", Name: "pod1"}}}
+	for _, r := range res {
+		if result, err := EvaluateScoreResult(r, pod, node); err != nil || result != exp[r.NameKey] {
+			t.Fatalf("expect %s evaluated to %d get %d %v", r.NameKey, exp[r.NameKey], result, err)
+		}
+	}
+	if m := node.Metric["memory"]; m.Avg != 5e8 {
+		t.Fatalf("expect the node metric unchanged get %+v", m)
+	}
+	// without scales the memory in bytes is compared.
+	unscaled := res[0] // ns1/gib
+	unscaled.MetricScales = nil
+	if result, err := EvaluateScoreResult(unscaled, pod, node); err != nil || result != 100 {
+		t.Fatalf("expect unscaled %s evaluated to 100 get %d %v", unscaled.NameKey, result, err)
+	}
+}
+
+func TestMetricScaleApplyTo(t *testing.T) {
+	s := MetricScale{Scale: 2, Offset: 1}
+	m := s.applyTo(FullMetrics{Avg: 3, Max: 4, Sum: 6, Count: 2, Rate: 5, Targets: map[string]FullMetrics{"c1": {Latest: 1}}})
+	if m.Avg != 7 || m.Max != 9 || m.Sum != 14 || m.Count != 2 || m.Rate != 10 || m.Targets["c1"].Latest != 3 {
+		t.Fatalf("expect scaled metric get %+v", m)
+	}
+	if m := (MetricScale{Offset: 1}).applyTo(FullMetrics{Avg: 3, Rate: 5}); m.Avg != 4 || m.Rate != 5 {
+		t.Fatalf("expect zero scale as 1 get %+v", m)
+	}
+}
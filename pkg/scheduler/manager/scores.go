@@ -0,0 +1,93 @@
+/*
+Copyright 2022 The Arbiter Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manager
+
+import (
+	"context"
+	"net/http"
+	"sort"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/component-base/metrics"
+	"k8s.io/klog/v2"
+)
+
+// ScoresNamespaceParam is the query param of ScoresHandler to select the namespace of Score.
+const ScoresNamespaceParam = "namespace"
+
+var descNodeScore = metrics.NewDesc(
+	"arbiter_node_score",
+	"Weighted score of a cached node computed by the Score CRs of a namespace.",
+	[]string{"namespace", "node"}, nil,
+	metrics.ALPHA,
+	"",
+)
+
+// ScoresHandler serves the weighted score of each cached node in the Prometheus text format, computed by the
+// Score of the namespace in ScoresNamespaceParam the same way as PreviewScores. There is no pod to be scheduled,
+// the logic gets an empty pod of the namespace. Nothing is emitted if the namespace has no valid Score,
+// and the nodes which can not be scored are omitted.
+func ScoresHandler(mgr Manager) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		namespace := r.URL.Query().Get(ScoresNamespaceParam)
+		if namespace == "" {
+			http.Error(w, "query param "+ScoresNamespaceParam+" is required", http.StatusBadRequest)
+			return
+		}
+		registry := metrics.NewKubeRegistry()
+		registry.CustomMustRegister(&scoresCollector{ctx: r.Context(), mgr: mgr, namespace: namespace})
+		metrics.HandlerFor(registry, metrics.HandlerOpts{}).ServeHTTP(w, r)
+	})
+}
+
+type scoresCollector struct {
+	metrics.BaseStableCollector
+
+	ctx       context.Context
+	mgr       Manager
+	namespace string
+}
+
+var _ metrics.StableCollector = &scoresCollector{}
+
+// DescribeWithStability implements the metrics.StableCollector interface.
+func (c *scoresCollector) DescribeWithStability(ch chan<- *metrics.Desc) {
+	ch <- descNodeScore
+}
+
+// CollectWithStability implements the metrics.StableCollector interface.
+func (c *scoresCollector) CollectWithStability(ch chan<- metrics.Metric) {
+	nodeOBIs := c.mgr.Stats().NodeOBIs
+	nodes := make([]string, 0, len(nodeOBIs))
+	for nodeName := range nodeOBIs {
+		nodes = append(nodes, nodeName)
+	}
+	sort.Strings(nodes)
+	pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: c.namespace}}
+	results, err := c.mgr.PreviewScores(c.ctx, pod, nodes)
+	if err != nil {
+		klog.V(5).InfoS(ManagerLogPrefix+"no node score to emit", "namespace", c.namespace, "err", err)
+		return
+	}
+	for _, res := range results {
+		if res.Err != nil {
+			continue
+		}
+		ch <- metrics.NewLazyConstMetric(descNodeScore, metrics.GaugeValue, float64(res.Result), c.namespace, res.NodeName)
+	}
+}
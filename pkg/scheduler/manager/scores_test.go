@@ -0,0 +1,86 @@
+/*
+Copyright 2022 The Arbiter Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manager
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+
+	schedv1alpha1 "github.com/kube-arbiter/arbiter/pkg/apis/v1alpha1"
+	"github.com/kube-arbiter/arbiter/pkg/generated/clientset/versioned/fake"
+)
+
+func TestScoresHandler(t *testing.T) {
+	factory := informers.NewSharedInformerFactory(kubefake.NewSimpleClientset(), 0)
+	for _, name := range []string{"node1", "node2"} {
+		if err := factory.Core().V1().Nodes().Informer().GetIndexer().Add(&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: name}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mgr := NewManager(fake.NewSimpleClientset(), nil, factory.Core().V1().Pods(), factory.Core().V1().Nodes())
+	// node3 is cached but not in the lister, it can not be scored.
+	for node, cpu := range map[string]string{"node1": "80", "node2": "20", "node3": "50"} {
+		mgr.ObservabilityIndicantAdd(newNodeOBI("cpu", node, map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo{
+			"cpu": {{Records: newRecords(cpu)}},
+		}))
+	}
+	mgr.ScoreAdd(newScore("ns1", "least-cpu", 1, "function score() { return 100 - node.metric.cpu.avg; }"))
+	srv := httptest.NewServer(ScoresHandler(mgr))
+	defer srv.Close()
+
+	for _, tc := range []struct {
+		name    string
+		query   string
+		expCode int
+		expBody string
+	}{
+		{
+			name:    "scores",
+			query:   "?namespace=ns1",
+			expCode: http.StatusOK,
+			expBody: `# HELP arbiter_node_score [ALPHA] Weighted score of a cached node computed by the Score CRs of a namespace.
+# TYPE arbiter_node_score gauge
+arbiter_node_score{namespace="ns1",node="node1"} 20
+arbiter_node_score{namespace="ns1",node="node2"} 80
+`,
+		},
+		{name: "no score", query: "?namespace=ns2", expCode: http.StatusOK, expBody: ""},
+		{name: "no namespace", expCode: http.StatusBadRequest, expBody: "query param namespace is required\n"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			resp, err := http.Get(srv.URL + tc.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			body, err := io.ReadAll(resp.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tc.expCode || string(body) != tc.expBody {
+				t.Fatalf("expect %d %q get %d %q", tc.expCode, tc.expBody, resp.StatusCode, body)
+			}
+		})
+	}
+}
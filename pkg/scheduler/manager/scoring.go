@@ -0,0 +1,66 @@
+/*
+Copyright 2022 The Arbiter Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manager
+
+import (
+	"context"
+	"errors"
+)
+
+// ScoringData is what scoring a pod on some nodes needs, see PrepareScoring.
+type ScoringData struct {
+	// Scores and TotalWeight are the same as the ones returned by GetScore.
+	Scores      []ScoreResult
+	TotalWeight int64
+	// NodeOBI is the OBI of each node keyed by node name, the same as GetNodeOBI.
+	// A node without OBI is omitted, OBI of a node is optional in score logic.
+	NodeOBI map[string]map[string]OBI
+}
+
+// PrepareScoring returns the Score of namespace the same as GetScore, along with the OBI of each node in
+// nodeNames, in one acquisition of the metric and Score locks instead of one for each call of GetScore and
+// GetNodeOBI. The returned data is a point-in-time snapshot, it is not updated by the OBI and Score
+// informer handlers afterwards. The error of ctx is returned once ctx is done.
+func (mgr *manager) PrepareScoring(ctx context.Context, namespace string, nodeNames []string) (ScoringData, error) {
+	if err := ctx.Err(); err != nil {
+		return ScoringData{}, err
+	}
+	// the Score lock is never held while acquiring the metric lock, so the order can't deadlock.
+	mgr.RLock()
+	defer mgr.RUnlock()
+	mgr.scoreLock.RLock()
+	defer mgr.scoreLock.RUnlock()
+
+	var data ScoringData
+	data.Scores, data.TotalWeight, _ = mgr.getScoreLocked(ctx, namespace)
+	data.NodeOBI = make(map[string]map[string]OBI, len(nodeNames))
+	for _, nodeName := range nodeNames {
+		obi, err := mgr.getNodeOBILocked(ctx, nodeName)
+		if errors.Is(err, ErrNotFoundInCache) {
+			continue
+		}
+		if err != nil {
+			return ScoringData{}, err
+		}
+		data.NodeOBI[nodeName] = obi
+	}
+	// the Score are dropped without error once ctx is done, see GetScore.
+	if err := ctx.Err(); err != nil {
+		return ScoringData{}, err
+	}
+	return data, nil
+}
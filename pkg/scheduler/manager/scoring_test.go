@@ -0,0 +1,137 @@
+/*
+Copyright 2022 The Arbiter Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manager
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"testing"
+
+	schedv1alpha1 "github.com/kube-arbiter/arbiter/pkg/apis/v1alpha1"
+)
+
+func newScoringManager(tb testing.TB, nodes int) (*manager, []string) {
+	mgr := newTestManager(tb, WithNamespaceFallback(false))
+	nodeNames := make([]string, 0, nodes)
+	for i := 0; i < nodes; i++ {
+		nodeName := fmt.Sprintf("node%d", i)
+		nodeNames = append(nodeNames, nodeName)
+		mgr.ObservabilityIndicantAdd(newNodeOBI("obi-"+nodeName, nodeName, map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo{
+			"cpu": {{Records: newRecords("1", "2", "3")}},
+		}))
+	}
+	mgr.ScoreAdd(newScore("ns1", "cpu", 2, "function score(){return 80}"))
+	mgr.ScoreAdd(newScore("ns1", "mem", 1, "function score(){return 40}"))
+	return mgr, nodeNames
+}
+
+func TestPrepareScoring(t *testing.T) {
+	mgr, nodeNames := newScoringManager(t, 2)
+	ctx := context.Background()
+	// node without OBI is omitted.
+	data, err := mgr.PrepareScoring(ctx, "ns1", append(nodeNames, "unknown"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	scores, totalWeight := mgr.GetScore(ctx, "ns1")
+	if !reflect.DeepEqual(scoreNames(scores), scoreNames(data.Scores)) || totalWeight != data.TotalWeight {
+		t.Fatalf("expect scores %v weight %d get %v weight %d", scoreNames(scores), totalWeight, scoreNames(data.Scores), data.TotalWeight)
+	}
+	if len(data.NodeOBI) != len(nodeNames) {
+		t.Fatalf("expect OBI of %v get %v", nodeNames, data.NodeOBI)
+	}
+	for _, nodeName := range nodeNames {
+		obi, err := mgr.GetNodeOBI(ctx, nodeName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(obi, data.NodeOBI[nodeName]) {
+			t.Fatalf("expect OBI of %s %+v get %+v", nodeName, obi, data.NodeOBI[nodeName])
+		}
+	}
+
+	// the data is a snapshot, later updates are not reflected.
+	mgr.ObservabilityIndicantAdd(newNodeOBI("obi-node0", "node0", map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo{
+		"cpu": {{Records: newRecords("9")}},
+	}))
+	if m := data.NodeOBI["node0"]["default-obi-node0"].Metric["cpu"]; m.Avg != 2 {
+		t.Fatalf("expect avg 2 of the snapshot get %v", m.Avg)
+	}
+
+	if data, err = mgr.PrepareScoring(ctx, "ns2", nodeNames); err != nil || len(data.Scores) != 0 || data.TotalWeight != 0 {
+		t.Fatalf("expect no score in ns2 get %+v %v", data, err)
+	}
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err = mgr.PrepareScoring(cancelled, "ns1", nodeNames); err != context.Canceled {
+		t.Fatalf("expect context.Canceled get %v", err)
+	}
+}
+
+// BenchmarkPrepareScoring compares one lock acquisition for all nodes with one for GetScore and each GetNodeOBI,
+// while the OBI informer handler keeps taking the write lock.
+func BenchmarkPrepareScoring(b *testing.B) {
+	mgr, nodeNames := newScoringManager(b, 100)
+	ctx := context.Background()
+	for _, bc := range []struct {
+		name    string
+		prepare func() error
+	}{
+		{name: "PrepareScoring", prepare: func() error {
+			_, err := mgr.PrepareScoring(ctx, "ns1", nodeNames)
+			return err
+		}},
+		{name: "GetScoreAndGetNodeOBI", prepare: func() error {
+			mgr.GetScore(ctx, "ns1")
+			for _, nodeName := range nodeNames {
+				if _, err := mgr.GetNodeOBI(ctx, nodeName); err != nil {
+					return err
+				}
+			}
+			return nil
+		}},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			done := make(chan struct{})
+			defer close(done)
+			go func() {
+				obi := newNodeOBI("obi-writer", "node0", map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo{
+					"cpu": {{Records: newRecords("1")}},
+				})
+				for i := 0; ; i++ {
+					select {
+					case <-done:
+						return
+					default:
+					}
+					obi.Status.Metrics["cpu"][0].Records[0].Value = fmt.Sprint(i)
+					mgr.ObservabilityIndicantAdd(obi)
+				}
+			}()
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					if err := bc.prepare(); err != nil {
+						b.Error(err)
+						return
+					}
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,97 @@
+/*
+Copyright 2022 The Arbiter Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+
+	schedv1alpha1 "github.com/kube-arbiter/arbiter/pkg/apis/v1alpha1"
+)
+
+// podSelectorOf returns the selector set by PodSelectorAnnotation of score, nil if it is not set.
+func podSelectorOf(score *schedv1alpha1.Score) (labels.Selector, error) {
+	value, ok := score.Annotations[PodSelectorAnnotation]
+	if !ok {
+		return nil, nil
+	}
+	selector, err := labels.Parse(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s %q: %w", PodSelectorAnnotation, value, err)
+	}
+	return selector, nil
+}
+
+// GetScoreForPod is the same as GetScoreWithDiagnostics of the pod namespace, but only the Score whose
+// PodSelectorAnnotation matches the pod labels are returned, totalWeight only sums the returned ones.
+// The Weight of each Score is the one of the pod profile in ProfileWeights if any, see PodProfileLabel,
+// so a Score of zero Weight applies to the pods of a profile with a non-zero weight, and the other way around.
+func (mgr *manager) GetScoreForPod(ctx context.Context, pod *v1.Pod) (res []ScoreResult, totalWeight int64, skipped []ScoreResult) {
+	all, _, allSkipped := mgr.GetScoreWithDiagnostics(ctx, pod.Namespace)
+	podLabels := labels.Set(pod.Labels)
+	profile := podProfileOf(pod)
+	res = make([]ScoreResult, 0, len(all))
+	add := func(s ScoreResult) {
+		if weight, ok := s.ProfileWeights[profile]; profile != "" && ok {
+			s.Weight, s.Err = weight, nil
+		}
+		if s.Weight == 0 {
+			s.Err = fmt.Errorf("%w: %d", ErrInvalidWeight, s.Weight)
+			skipped = append(skipped, s)
+			return
+		}
+		res = append(res, s)
+		if s.Weight > 0 {
+			totalWeight += s.Weight
+		}
+	}
+	for _, s := range all {
+		if selectsPod(s, podLabels) {
+			add(s)
+		}
+	}
+	for _, s := range allSkipped {
+		if !selectsPod(s, podLabels) {
+			continue
+		}
+		if errors.Is(s.Err, ErrInvalidWeight) {
+			add(s)
+			continue
+		}
+		skipped = append(skipped, s)
+	}
+	sortByNameKey(res)
+	sortByNameKey(skipped)
+	return res, totalWeight, skipped
+}
+
+// podProfileOf returns the profile of pod by PodProfileLabel, empty if it is not set.
+func podProfileOf(pod *v1.Pod) string {
+	if profile, ok := pod.Labels[PodProfileLabel]; ok {
+		return profile
+	}
+	return pod.Annotations[PodProfileLabel]
+}
+
+// selectsPod returns true if score applies to the pod with podLabels.
+func selectsPod(score ScoreResult, podLabels labels.Set) bool {
+	return score.Selector == nil || score.Selector.Matches(podLabels)
+}
@@ -0,0 +1,142 @@
+/*
+Copyright 2022 The Arbiter Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manager
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	schedv1alpha1 "github.com/kube-arbiter/arbiter/pkg/apis/v1alpha1"
+)
+
+func TestGetScoreForPod(t *testing.T) {
+	mgr := newTestManager(t, WithNamespaceFallback(false))
+	gpu := newScore("ns1", "gpu", 3, "function score(){return 1}")
+	gpu.Annotations = map[string]string{PodSelectorAnnotation: "accelerator=nvidia"}
+	blank := newScore("ns1", "blank", 1, " ")
+	blank.Annotations = map[string]string{PodSelectorAnnotation: "accelerator=nvidia"}
+	invalid := newScore("ns1", "invalid", 1, "function score(){return 1}")
+	invalid.Annotations = map[string]string{PodSelectorAnnotation: "accelerator in nvidia"}
+	for _, s := range []*schedv1alpha1.Score{gpu, blank, invalid, newScore("ns1", "all", 1, "function score(){return 1}")} {
+		mgr.ScoreAdd(s)
+	}
+	if err := mgr.GetScoreError("ns1", "invalid"); err == nil {
+		t.Fatalf("expect invalid selector rejected")
+	}
+
+	for _, tc := range []struct {
+		name       string
+		labels     map[string]string
+		exp        []string
+		expTotal   int64
+		expSkipped []string
+	}{
+		{
+			name:       "matching pod",
+			labels:     map[string]string{"accelerator": "nvidia", "app": "train"},
+			exp:        []string{"ns1/all", "ns1/gpu"},
+			expTotal:   4,
+			expSkipped: []string{"ns1/blank"},
+		},
+		{
+			name:       "non-matching pod",
+			labels:     map[string]string{"app": "web"},
+			exp:        []string{"ns1/all"},
+			expTotal:   1,
+			expSkipped: []string{},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "ns1", Name: "pod1", Labels: tc.labels}}
+			res, total, skipped := mgr.GetScoreForPod(context.Background(), pod)
+			if names := scoreNames(res); !reflect.DeepEqual(tc.exp, names) {
+				t.Fatalf("expect %v get %v", tc.exp, names)
+			}
+			if total != tc.expTotal {
+				t.Fatalf("expect total weight %d get %d", tc.expTotal, total)
+			}
+			if names := scoreNames(skipped); !reflect.DeepEqual(tc.expSkipped, names) {
+				t.Fatalf("expect skipped %v get %v", tc.expSkipped, names)
+			}
+		})
+	}
+}
+
+func TestGetScoreForPodProfile(t *testing.T) {
+	mgr := newTestManager(t, WithNamespaceFallback(false))
+	spread := newScore("ns1", "spread", 2, "function score(){return 1}")
+	spread.Spec.ProfileWeights = map[string]int64{"batch": 5}
+	latency := newScore("ns1", "latency", 0, "function score(){return 1}")
+	latency.Spec.ProfileWeights = map[string]int64{"latency-sensitive": 3}
+	penalty := newScore("ns1", "penalty", 1, "function score(){return 1}")
+	penalty.Spec.ProfileWeights = map[string]int64{"batch": 0}
+	for _, s := range []*schedv1alpha1.Score{spread, latency, penalty} {
+		mgr.ScoreAdd(s)
+	}
+
+	for _, tc := range []struct {
+		name        string
+		labels      map[string]string
+		annotations map[string]string
+		expWeights  map[string]int64
+		expTotal    int64
+		expSkipped  []string
+	}{
+		{
+			name:       "no profile",
+			expWeights: map[string]int64{"ns1/penalty": 1, "ns1/spread": 2},
+			expTotal:   3,
+			expSkipped: []string{"ns1/latency"},
+		},
+		{
+			name:       "batch label",
+			labels:     map[string]string{PodProfileLabel: "batch"},
+			expWeights: map[string]int64{"ns1/spread": 5},
+			expTotal:   5,
+			expSkipped: []string{"ns1/latency", "ns1/penalty"},
+		},
+		{
+			name:        "latency-sensitive annotation",
+			annotations: map[string]string{PodProfileLabel: "latency-sensitive"},
+			expWeights:  map[string]int64{"ns1/latency": 3, "ns1/penalty": 1, "ns1/spread": 2},
+			expTotal:    6,
+			expSkipped:  []string{},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "ns1", Name: "pod1", Labels: tc.labels, Annotations: tc.annotations}}
+			res, total, skipped := mgr.GetScoreForPod(context.Background(), pod)
+			weights := make(map[string]int64, len(res))
+			for _, r := range res {
+				weights[r.NameKey] = r.Weight
+			}
+			if !reflect.DeepEqual(tc.expWeights, weights) {
+				t.Fatalf("expect weights %v get %v", tc.expWeights, weights)
+			}
+			if total != tc.expTotal {
+				t.Fatalf("expect total weight %d get %d", tc.expTotal, total)
+			}
+			if names := scoreNames(skipped); !reflect.DeepEqual(tc.expSkipped, names) {
+				t.Fatalf("expect skipped %v get %v", tc.expSkipped, names)
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+/*
+Copyright 2022 The Arbiter Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manager
+
+import (
+	"context"
+	"encoding/json"
+
+	gocache "github.com/patrickmn/go-cache"
+
+	schedv1alpha1 "github.com/kube-arbiter/arbiter/pkg/apis/v1alpha1"
+)
+
+// ManagerSnapshot is everything the manager caches, used to analyze or reproduce scheduling offline.
+// All maps are encoded in key order by encoding/json, so one cache state always gets the same JSON.
+type ManagerSnapshot struct {
+	// Nodes are the unexpired OBI of each node keyed by node name and OBI key.
+	Nodes map[string]map[string]OBI `json:"nodes"`
+	// Pods are the unexpired OBI of each pod keyed by namespace/name and OBI key.
+	Pods map[string]map[string]OBI `json:"pods"`
+	// Scores are the cached Score keyed by namespace and name.
+	Scores map[string]map[string]schedv1alpha1.ScoreSpec `json:"scores"`
+	// InvalidScores are the compile errors of Score keyed by namespace/name.
+	InvalidScores map[string]string `json:"invalidScores,omitempty"`
+}
+
+// SnapshotJSON returns ManagerSnapshot in JSON, the metric and Score caches are read under their own lock.
+// Record timestamps and float aggregations round-trip exactly, StartTime and EndTime keep the precision
+// of metav1.Time, which is second.
+func (mgr *manager) SnapshotJSON() ([]byte, error) {
+	ctx := context.Background()
+	mgr.RLock()
+	snapshot := ManagerSnapshot{
+		Nodes: snapshotOBI(ctx, mgr.nodeMetric),
+		Pods:  snapshotOBI(ctx, mgr.podMetric),
+	}
+	mgr.RUnlock()
+
+	mgr.scoreLock.RLock()
+	snapshot.Scores = make(map[string]map[string]schedv1alpha1.ScoreSpec, len(mgr.score))
+	for ns, scoreCache := range mgr.score {
+		specs := make(map[string]schedv1alpha1.ScoreSpec, scoreCache.ItemCount())
+		for name, v := range scoreCache.Items() {
+			if s, ok := v.Object.(cachedScore); ok {
+				specs[name] = s.spec
+			}
+		}
+		snapshot.Scores[ns] = specs
+	}
+	if len(mgr.invalidScores) != 0 {
+		snapshot.InvalidScores = make(map[string]string, len(mgr.invalidScores))
+		for key, err := range mgr.invalidScores {
+			snapshot.InvalidScores[key] = err.Error()
+		}
+	}
+	mgr.scoreLock.RUnlock()
+	return json.Marshal(snapshot)
+}
+
+func snapshotOBI(ctx context.Context, caches map[string]*gocache.Cache) map[string]map[string]OBI {
+	res := make(map[string]map[string]OBI, len(caches))
+	for key, c := range caches {
+		if obi, err := getOBIFromCache(ctx, c); err == nil {
+			res[key] = obi
+		}
+	}
+	return res
+}
@@ -0,0 +1,85 @@
+/*
+Copyright 2022 The Arbiter Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manager
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	schedv1alpha1 "github.com/kube-arbiter/arbiter/pkg/apis/v1alpha1"
+)
+
+func TestSnapshotJSON(t *testing.T) {
+	mgr := newTestManager(t)
+	// the window covers the records of newRecords.
+	start := time.UnixMilli(60000)
+	cpu := map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo{
+		"cpu": {{
+			Records:   newRecords("0.470097", "0.466142", "0.1"),
+			Unit:      "C",
+			StartTime: metav1.NewTime(start),
+			EndTime:   metav1.NewTime(start.Add(time.Hour)),
+		}},
+	}
+	mgr.ObservabilityIndicantAdd(newNodeOBI("cpu", "node1", cpu))
+	mgr.ObservabilityIndicantAdd(newPodOBI("pod-cpu", "ns1", "pod1", cpu))
+	mgr.ScoreAdd(newScore("ns1", "score1", 2, "function score(){return 1}"))
+	mgr.ScoreAdd(newScore("ns1", "malformed", 1, "function score("))
+
+	data, err := mgr.SnapshotJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := mgr.SnapshotJSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, again) {
+		t.Fatalf("expect the same JSON of the same cache\n%s\n%s", data, again)
+	}
+
+	var snapshot ManagerSnapshot
+	if err = json.Unmarshal(data, &snapshot); err != nil {
+		t.Fatal(err)
+	}
+	nodeOBI, err := mgr.GetNodeOBI(context.Background(), "node1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(map[string]map[string]OBI{"node1": nodeOBI}, snapshot.Nodes) {
+		t.Fatalf("expect node OBI %+v get %+v", nodeOBI, snapshot.Nodes)
+	}
+	if m := snapshot.Nodes["node1"]["default-cpu"].Metric["cpu"]; !m.EndTime.Equal(&cpu["cpu"][0].EndTime) || m.Avg != nodeOBI["default-cpu"].Metric["cpu"].Avg {
+		t.Fatalf("expect EndTime and Avg round-trip get %+v", m)
+	}
+	if _, ok := snapshot.Pods["ns1/pod1"]["default-pod-cpu"]; !ok || len(snapshot.Pods) != 1 {
+		t.Fatalf("expect OBI of pod ns1/pod1 get %+v", snapshot.Pods)
+	}
+	expScores := map[string]map[string]schedv1alpha1.ScoreSpec{"ns1": {"score1": {Weight: 2, Logic: "function score(){return 1}"}}}
+	if !reflect.DeepEqual(expScores, snapshot.Scores) {
+		t.Fatalf("expect scores %+v get %+v", expScores, snapshot.Scores)
+	}
+	if _, ok := snapshot.InvalidScores["ns1/malformed"]; !ok || len(snapshot.InvalidScores) != 1 {
+		t.Fatalf("expect the malformed Score in InvalidScores get %v", snapshot.InvalidScores)
+	}
+}
@@ -0,0 +1,73 @@
+/*
+Copyright 2022 The Arbiter Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manager
+
+import (
+	gocache "github.com/patrickmn/go-cache"
+)
+
+// ManagerStats is a snapshot of what the manager has cached.
+type ManagerStats struct {
+	// Nodes and Pods are the number of nodes and pods which have OBI in cache.
+	Nodes int
+	Pods  int
+	// Scores is the number of cached Score of all namespaces, InvalidScores are not counted.
+	Scores        int
+	InvalidScores int
+	// OBIs is the number of OBI entries of all nodes and pods.
+	OBIs int
+	// NodeOBIs and PodOBIs are the number of OBI entries of each node, and each pod keyed by namespace/name.
+	NodeOBIs map[string]int
+	PodOBIs  map[string]int
+	// NamespaceScores is the number of cached Score of each namespace.
+	NamespaceScores map[string]int
+}
+
+// Stats returns the statistics of the manager cache, the metric and Score caches are read under their own lock.
+func (mgr *manager) Stats() ManagerStats {
+	mgr.RLock()
+	stats := ManagerStats{
+		Nodes:    len(mgr.nodeMetric),
+		Pods:     len(mgr.podMetric),
+		NodeOBIs: itemCounts(mgr.nodeMetric),
+		PodOBIs:  itemCounts(mgr.podMetric),
+	}
+	mgr.RUnlock()
+
+	mgr.scoreLock.RLock()
+	stats.InvalidScores = len(mgr.invalidScores)
+	stats.NamespaceScores = itemCounts(mgr.score)
+	mgr.scoreLock.RUnlock()
+	for _, count := range stats.NodeOBIs {
+		stats.OBIs += count
+	}
+	for _, count := range stats.PodOBIs {
+		stats.OBIs += count
+	}
+	for _, count := range stats.NamespaceScores {
+		stats.Scores += count
+	}
+	return stats
+}
+
+func itemCounts(caches map[string]*gocache.Cache) map[string]int {
+	counts := make(map[string]int, len(caches))
+	for key, c := range caches {
+		counts[key] = c.ItemCount()
+	}
+	return counts
+}
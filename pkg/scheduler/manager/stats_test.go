@@ -0,0 +1,53 @@
+/*
+Copyright 2022 The Arbiter Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manager
+
+import (
+	"reflect"
+	"testing"
+
+	schedv1alpha1 "github.com/kube-arbiter/arbiter/pkg/apis/v1alpha1"
+)
+
+func TestStats(t *testing.T) {
+	mgr := newTestManager(t)
+	cpu := map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo{
+		"cpu": {{Records: newRecords("1")}},
+	}
+	mgr.ObservabilityIndicantAdd(newNodeOBI("cpu", "node1", cpu))
+	mgr.ObservabilityIndicantAdd(newNodeOBI("mem", "node1", cpu))
+	mgr.ObservabilityIndicantAdd(newNodeOBI("cpu", "node2", cpu))
+	mgr.ObservabilityIndicantAdd(newPodOBI("pod-cpu", "ns1", "pod1", cpu))
+	mgr.ScoreAdd(newScore("ns1", "score1", 1, "function score(){return 1}"))
+	mgr.ScoreAdd(newScore("ns1", "score2", 1, "function score(){return 1}"))
+	mgr.ScoreAdd(newScore("ns2", "score1", 1, "function score(){return 1}"))
+	mgr.ScoreAdd(newScore("ns2", "malformed", 1, "function score("))
+
+	exp := ManagerStats{
+		Nodes:           2,
+		Pods:            1,
+		Scores:          3,
+		InvalidScores:   1,
+		OBIs:            4,
+		NodeOBIs:        map[string]int{"node1": 2, "node2": 1},
+		PodOBIs:         map[string]int{"ns1/pod1": 1},
+		NamespaceScores: map[string]int{"ns1": 2, "ns2": 1},
+	}
+	if get := mgr.Stats(); !reflect.DeepEqual(exp, get) {
+		t.Fatalf("expect %+v get %+v", exp, get)
+	}
+}
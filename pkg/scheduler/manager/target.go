@@ -0,0 +1,169 @@
+/*
+Copyright 2022 The Arbiter Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manager
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	gocache "github.com/patrickmn/go-cache"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/klog/v2"
+
+	schedv1alpha1 "github.com/kube-arbiter/arbiter/pkg/apis/v1alpha1"
+)
+
+// TargetKind is the group, version and kind of the resource which an OBI point to.
+type TargetKind struct {
+	Group   string
+	Version string
+	Kind    string
+}
+
+// TargetResolver returns the key of the target resource in its metric cache,
+// an empty key means the target can't be resolved and the OBI is dropped.
+type TargetResolver func(obi *schedv1alpha1.ObservabilityIndicant) string
+
+var (
+	NodeTargetKind = TargetKind{Group: v1.GroupName, Version: "v1", Kind: "Node"}
+	PodTargetKind  = TargetKind{Group: v1.GroupName, Version: "v1", Kind: "Pod"}
+)
+
+// targetHandler maps the OBI of one TargetKind into its metric cache.
+type targetHandler struct {
+	resolve TargetResolver
+	// metrics is keyed by the result of resolve.
+	metrics map[string]*gocache.Cache
+}
+
+func targetKindOf(o schedv1alpha1.ObservabilityIndicantSpecTargetRef) TargetKind {
+	return TargetKind{Group: o.Group, Version: o.Version, Kind: o.Kind}
+}
+
+// ResolveNodeTarget resolves the node name of obi.
+func ResolveNodeTarget(obi *schedv1alpha1.ObservabilityIndicant) string {
+	return getTargetName(obi)
+}
+
+// ResolvePodTarget resolves the namespace/name of the pod of obi.
+func ResolvePodTarget(obi *schedv1alpha1.ObservabilityIndicant) string {
+	podName := getTargetName(obi)
+	if podName == "" {
+		return ""
+	}
+	return getPodKey(getTargetNamespace(obi), podName)
+}
+
+// GetTargetOBI returns OBI of the target resource of kind, key is the result of the TargetResolver of kind.
+// Node and Pod are registered by default, other kinds are registered by WithTargetKind.
+func (mgr *manager) GetTargetOBI(ctx context.Context, kind TargetKind, key string) (obi map[string]OBI, err error) {
+	mgr.RLock()
+	defer mgr.RUnlock()
+	handler, ok := mgr.targets[kind]
+	if !ok {
+		err = fmt.Errorf("target kind %v is not registered: %w", kind, ErrNotFoundInCache)
+		klog.V(4).ErrorS(err, "Failed to get target OBI, kind not registered", "kind", kind, "key", key)
+		return
+	}
+	targetCache, ok := handler.metrics[key]
+	if !ok {
+		err = fmt.Errorf("%s %s: %w", kind.Kind, key, ErrNotFoundInCache)
+		klog.V(4).ErrorS(err, "Failed to get target OBI", "kind", kind, "key", key)
+		return
+	}
+	obi, err = getOBIFromCache(ctx, targetCache)
+	if err != nil {
+		err = fmt.Errorf("%s %s: %w", kind.Kind, key, err)
+	}
+	return
+}
+
+// targetKinds returns the registered target kinds sorted by their string form. mgr.RLock must be held.
+func (mgr *manager) targetKinds() []TargetKind {
+	kinds := make([]TargetKind, 0, len(mgr.targets))
+	for kind := range mgr.targets {
+		kinds = append(kinds, kind)
+	}
+	sort.Slice(kinds, func(i, j int) bool {
+		return kinds[i].String() < kinds[j].String()
+	})
+	return kinds
+}
+
+// String returns the kind as group/version, Kind=kind, the same as schema.GroupVersionKind.
+func (k TargetKind) String() string {
+	return schema.GroupVersionKind(k).String()
+}
+
+// targetRefMismatch returns why ref matches none of kinds, nil if it matches one. ref is compared with the kinds
+// of the same Kind ignoring case, and each of its group, version and Kind not as expected is told, e.g.
+// "expected version v1, got v1beta1" for a node OBI of a wrong version. The closest kind is told if there are many.
+func targetRefMismatch(ref schedv1alpha1.ObservabilityIndicantSpecTargetRef, kinds []TargetKind) error {
+	got := targetKindOf(ref)
+	if got.Kind == "" {
+		return fmt.Errorf("%w: kind is empty", ErrInvalidTargetRef)
+	}
+	var closest []string
+	for _, kind := range kinds {
+		if !strings.EqualFold(kind.Kind, got.Kind) {
+			continue
+		}
+		if kind == got {
+			return nil
+		}
+		var reasons []string
+		if kind.Group != got.Group {
+			expected := strconv.Quote(kind.Group)
+			if kind.Group == v1.GroupName {
+				expected += " (the core group)"
+			}
+			reasons = append(reasons, fmt.Sprintf("expected group %s, got %q", expected, got.Group))
+		}
+		if kind.Version != got.Version {
+			reasons = append(reasons, fmt.Sprintf("expected version %s, got %s", kind.Version, got.Version))
+		}
+		if kind.Kind != got.Kind {
+			reasons = append(reasons, fmt.Sprintf("expected kind %s, got %s", kind.Kind, got.Kind))
+		}
+		if closest == nil || len(reasons) < len(closest) {
+			closest = reasons
+		}
+	}
+	if closest == nil {
+		names := make([]string, 0, len(kinds))
+		for _, kind := range kinds {
+			names = append(names, kind.String())
+		}
+		return fmt.Errorf("%w: unknown kind %s, registered kinds are %s", ErrInvalidTargetRef, got.Kind, strings.Join(names, "; "))
+	}
+	return fmt.Errorf("%w %s: %s", ErrInvalidTargetRef, got, strings.Join(closest, ", "))
+}
+
+// targetLogKey returns the log key of the target of ref, e.g. node for a node OBI.
+func targetLogKey(ref schedv1alpha1.ObservabilityIndicantSpecTargetRef) string {
+	switch targetKindOf(ref) {
+	case NodeTargetKind:
+		return "node"
+	case PodTargetKind:
+		return "pod"
+	}
+	return "target"
+}
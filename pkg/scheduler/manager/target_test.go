@@ -0,0 +1,170 @@
+/*
+Copyright 2022 The Arbiter Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manager
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"k8s.io/client-go/tools/record"
+
+	schedv1alpha1 "github.com/kube-arbiter/arbiter/pkg/apis/v1alpha1"
+)
+
+func TestCustomTargetKind(t *testing.T) {
+	nodePool := TargetKind{Group: "example.com", Version: "v1", Kind: "NodePool"}
+	mgr := newTestManager(t, WithTargetKind(nodePool, ResolveNodeTarget))
+	obi := newNodeOBI("obi", "pool1", map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo{
+		"cpu": {{Records: newRecords("1", "3")}},
+	})
+	obi.Spec.TargetRef.Group, obi.Spec.TargetRef.Kind = "example.com", "NodePool"
+	mgr.ObservabilityIndicantAdd(obi)
+
+	data, err := mgr.GetTargetOBI(context.Background(), nodePool, "pool1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m := data[getMetricCacheKey(obi)].Metric["cpu"]; m.Avg != 2 {
+		t.Fatalf("expect avg 2 get %+v", m)
+	}
+	if _, err := mgr.GetNodeOBI(context.Background(), "pool1"); !errors.Is(err, ErrNotFoundInCache) {
+		t.Fatalf("custom kind should not be cached as node, get %v", err)
+	}
+	mgr.ObservabilityIndicantDelete(obi)
+	if _, err := mgr.GetTargetOBI(context.Background(), nodePool, "pool1"); !errors.Is(err, ErrNotFoundInCache) {
+		t.Fatalf("expect ErrNotFoundInCache after delete get %v", err)
+	}
+
+	// unregistered kind is dropped.
+	other := obi.DeepCopy()
+	other.Spec.TargetRef.Kind = "Other"
+	mgr.ObservabilityIndicantAdd(other)
+	if _, err := mgr.GetTargetOBI(context.Background(), targetKindOf(other.Spec.TargetRef), "pool1"); !errors.Is(err, ErrNotFoundInCache) {
+		t.Fatalf("expect ErrNotFoundInCache for unregistered kind get %v", err)
+	}
+	// node is registered by default.
+	mgr.ObservabilityIndicantAdd(newNodeOBI("obi", "node1", obi.Status.Metrics))
+	if _, err := mgr.GetTargetOBI(context.Background(), NodeTargetKind, "node1"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestObservabilityIndicantAddMultipleNodeTargetItems(t *testing.T) {
+	mgr := newTestManager(t)
+	obi := newNodeOBI("obi", "", map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo{
+		"cpu": {
+			{TargetItem: "node1", Records: newRecords("1")},
+			{TargetItem: "node2", Records: newRecords("2")},
+			{TargetItem: "node3", Records: newRecords("3")},
+		},
+		"mem": {
+			{TargetItem: "node1", Records: newRecords("10")},
+		},
+	})
+	mgr.ObservabilityIndicantAdd(obi)
+	for i, nodeName := range []string{"node1", "node2", "node3"} {
+		if m := getNodeMetric(t, mgr, obi, nodeName, "cpu"); m.Avg != float64(i+1) {
+			t.Fatalf("%s: expect cpu avg %d get %v", nodeName, i+1, m.Avg)
+		}
+	}
+	if m := getNodeMetric(t, mgr, obi, "node1", "mem"); m.Avg != 10 {
+		t.Fatalf("expect node1 mem avg 10 get %v", m.Avg)
+	}
+	data, _ := mgr.GetNodeOBI(context.Background(), "node2")
+	if _, ok := data[getMetricCacheKey(obi)].Metric["mem"]; ok {
+		t.Fatalf("expect node2 has no mem")
+	}
+
+	mgr.ObservabilityIndicantDelete(obi)
+	if len(mgr.nodeMetric) != 0 {
+		t.Fatalf("expect all node caches deleted get %v", mgr.nodeMetric)
+	}
+}
+
+func TestTargetRefMismatch(t *testing.T) {
+	deployment := TargetKind{Group: "apps", Version: "v1", Kind: "Deployment"}
+	kinds := []TargetKind{NodeTargetKind, PodTargetKind, deployment}
+	for _, tc := range []struct {
+		name string
+		ref  schedv1alpha1.ObservabilityIndicantSpecTargetRef
+		exp  string
+	}{
+		{name: "node", ref: schedv1alpha1.ObservabilityIndicantSpecTargetRef{Version: "v1", Kind: "Node"}},
+		{
+			name: "wrong version",
+			ref:  schedv1alpha1.ObservabilityIndicantSpecTargetRef{Version: "v1beta1", Kind: "Node"},
+			exp:  "invalid target ref /v1beta1, Kind=Node: expected version v1, got v1beta1",
+		},
+		{
+			name: "core group name",
+			ref:  schedv1alpha1.ObservabilityIndicantSpecTargetRef{Group: "core", Version: "v1", Kind: "Pod"},
+			exp:  `invalid target ref core/v1, Kind=Pod: expected group "" (the core group), got "core"`,
+		},
+		{
+			name: "empty group of non-core kind",
+			ref:  schedv1alpha1.ObservabilityIndicantSpecTargetRef{Version: "v1", Kind: "Deployment"},
+			exp:  `invalid target ref /v1, Kind=Deployment: expected group "apps", got ""`,
+		},
+		{
+			name: "kind case and version",
+			ref:  schedv1alpha1.ObservabilityIndicantSpecTargetRef{Version: "v2", Kind: "node"},
+			exp:  "invalid target ref /v2, Kind=node: expected version v1, got v2, expected kind Node, got node",
+		},
+		{
+			name: "unknown kind",
+			ref:  schedv1alpha1.ObservabilityIndicantSpecTargetRef{Version: "v1", Kind: "Service"},
+			exp:  "invalid target ref: unknown kind Service, registered kinds are /v1, Kind=Node; /v1, Kind=Pod; apps/v1, Kind=Deployment",
+		},
+		{name: "empty kind", exp: "invalid target ref: kind is empty"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			err := targetRefMismatch(tc.ref, kinds)
+			if tc.exp == "" {
+				if err != nil {
+					t.Fatalf("expect match get %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrInvalidTargetRef) || err.Error() != tc.exp {
+				t.Fatalf("expect %q get %v", tc.exp, err)
+			}
+		})
+	}
+}
+
+func TestObservabilityIndicantAddInvalidTargetRef(t *testing.T) {
+	recorder := record.NewFakeRecorder(1)
+	mgr := newTestManager(t, WithEventRecorder(recorder))
+	obi := newNodeOBI("obi", "node1", map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo{
+		"cpu": {{Records: newRecords("1")}},
+	})
+	obi.Spec.TargetRef.Version = "v1beta1"
+	mgr.ObservabilityIndicantAdd(obi)
+	if _, err := mgr.GetNodeOBI(context.Background(), "node1"); err == nil {
+		t.Fatalf("expect obi of an invalid TargetRef skipped")
+	}
+	select {
+	case event := <-recorder.Events:
+		if !strings.Contains(event, InvalidTargetRefEventReason) || !strings.Contains(event, "expected version v1, got v1beta1") {
+			t.Fatalf("unexpected event %q", event)
+		}
+	default:
+		t.Fatalf("expect an %s event", InvalidTargetRefEventReason)
+	}
+}
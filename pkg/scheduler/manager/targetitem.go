@@ -0,0 +1,156 @@
+/*
+Copyright 2022 The Arbiter Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manager
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"k8s.io/klog/v2"
+
+	schedv1alpha1 "github.com/kube-arbiter/arbiter/pkg/apis/v1alpha1"
+)
+
+// mergeTargetItems groups the entries of metricType by TargetItem and merges each group by mergeMetricInfo,
+// records beyond maxRecords are trimmed the same as the merged metric if it is positive.
+// It returns nil unless the entries report more than one target item, e.g. the devices of a GPU node.
+func mergeTargetItems(logger klog.Logger, metricType string, infos []schedv1alpha1.ObservabilityIndicantStatusMetricInfo, maxRecords int) map[string]schedv1alpha1.ObservabilityIndicantStatusMetricInfo {
+	groups := make(map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo)
+	for _, info := range infos {
+		groups[info.TargetItem] = append(groups[info.TargetItem], info)
+	}
+	if len(groups) < 2 {
+		return nil
+	}
+	merged := make(map[string]schedv1alpha1.ObservabilityIndicantStatusMetricInfo, len(groups))
+	for item, group := range groups {
+		info := mergeMetricInfo(logger.WithValues("targetItem", item), metricType, group)
+		if maxRecords > 0 && len(info.Records) > maxRecords {
+			info.Records = append([]schedv1alpha1.Record(nil), info.Records[len(info.Records)-maxRecords:]...)
+		}
+		merged[item] = info
+	}
+	return merged
+}
+
+// sameTargetInfos reports whether targets are aggregated from infos, so they need no re-aggregation.
+func sameTargetInfos(targets map[string]FullMetrics, infos map[string]schedv1alpha1.ObservabilityIndicantStatusMetricInfo) bool {
+	if len(targets) != len(infos) {
+		return false
+	}
+	for item, info := range infos {
+		m, ok := targets[item]
+		if !ok || !reflect.DeepEqual(m.ObservabilityIndicantStatusMetricInfo, info) {
+			return false
+		}
+	}
+	return true
+}
+
+// aggregateTargetItems aggregates each of infos the same as the merged metric, target items without
+// any parsable record are dropped. It returns nil if infos is empty.
+func (mgr *manager) aggregateTargetItems(logger klog.Logger, metricType string, infos map[string]schedv1alpha1.ObservabilityIndicantStatusMetricInfo) map[string]FullMetrics {
+	if len(infos) == 0 {
+		return nil
+	}
+	targets := make(map[string]FullMetrics, len(infos))
+	for item, info := range infos {
+		m := FullMetrics{ObservabilityIndicantStatusMetricInfo: info}
+		if len(info.Records) == 0 || !mgr.aggregate(logger.WithValues("targetItem", item), metricType, &m) {
+			continue
+		}
+		targets[item] = m
+	}
+	return targets
+}
+
+// combineTargetItems replaces the time-ordered aggregations of m merged from several target items, e.g. the
+// devices of a GPU node, by combining the ones of each item in m.Targets. The records of different items
+// interleave by timestamp and are not one series: a counter of one item looks reset by a lower value of another,
+// and Latest is any item reporting at the newest timestamp.
+// Rate and Flaps are summed over the items, e.g. the total rate of all devices, EWMA and Slope are averaged
+// over them, the same as Avg over their records, and Latest is the average of the items reporting the newest
+// record. Primary is computed again from the combined values.
+// It does nothing if m has no Targets.
+func (mgr *manager) combineTargetItems(logger klog.Logger, metricType string, m *FullMetrics) {
+	if len(m.Targets) == 0 {
+		return
+	}
+	items := make([]string, 0, len(m.Targets))
+	for item := range m.Targets {
+		items = append(items, item)
+	}
+	// sum in a fixed order, so the same OBI always gets the same values.
+	sort.Strings(items)
+	var latest, ewma, slope float64
+	var newest int64
+	latestItems := 0
+	m.Rate, m.Flaps = 0, 0
+	for _, item := range items {
+		t := m.Targets[item]
+		m.Rate += t.Rate
+		m.Flaps += t.Flaps
+		ewma += t.EWMA
+		slope += t.Slope
+		// records of each item are sorted by timestamp.
+		switch last := t.Records[len(t.Records)-1].Timestamp; {
+		case latestItems == 0 || last > newest:
+			newest, latest, latestItems = last, t.Latest, 1
+		case last == newest:
+			latest += t.Latest
+			latestItems++
+		}
+	}
+	n := float64(len(items))
+	m.Latest, m.EWMA, m.Slope = latest/float64(latestItems), ewma/n, slope/n
+	m.Primary = mgr.primaryOf(logger, metricType, *m)
+}
+
+// GetNodeMetricByTarget returns the metricType of one target item of the node, e.g. a device of a GPU node.
+// A metric reported by a single target item is returned if it is that item.
+func (mgr *manager) GetNodeMetricByTarget(ctx context.Context, nodeName, metricType, targetItem string) (metric FullMetrics, err error) {
+	m, err := mgr.GetNodeMetric(ctx, nodeName, metricType)
+	if err != nil {
+		return FullMetrics{}, err
+	}
+	if metric, ok := m.Targets[targetItem]; ok {
+		return metric, nil
+	}
+	if m.Targets == nil && m.TargetItem == targetItem {
+		return m, nil
+	}
+	err = fmt.Errorf("target item %s of metric %s of node %s: %w", targetItem, metricType, nodeName, ErrNotFoundInCache)
+	mgr.contextLogger(ctx).V(4).Info("Failed to get node metric by target", "node", nodeName, "metricType", metricType, "targetItem", targetItem, "err", err)
+	return FullMetrics{}, err
+}
+
+// MaxTarget returns the target item of m with the greatest value, e.g. the busiest device by
+// MaxTarget(m, func(m FullMetrics) float64 { return m.Avg }). ok is false if m has no target items.
+func MaxTarget(m FullMetrics, value func(FullMetrics) float64) (targetItem string, metric FullMetrics, ok bool) {
+	var max float64
+	for item, t := range m.Targets {
+		v := value(t)
+		// break ties by the item name to be deterministic.
+		if ok && (v < max || v == max && item > targetItem) {
+			continue
+		}
+		targetItem, metric, max, ok = item, t, v, true
+	}
+	return
+}
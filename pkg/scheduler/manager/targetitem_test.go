@@ -0,0 +1,128 @@
+/*
+Copyright 2022 The Arbiter Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manager
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	schedv1alpha1 "github.com/kube-arbiter/arbiter/pkg/apis/v1alpha1"
+)
+
+func TestGetNodeMetricByTarget(t *testing.T) {
+	mgr := newTestManager(t)
+	obi := newNodeOBI("gpu", "node1", map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo{
+		"gpu": {
+			{TargetItem: "gpu0", Records: newRecords("10", "30")},
+			{TargetItem: "gpu1", Records: newRecords("60", "80")},
+		},
+		"cpu": {{TargetItem: "node1", Records: newRecords("5")}},
+	})
+	mgr.ObservabilityIndicantAdd(obi)
+
+	m := getNodeMetric(t, mgr, obi, "node1", "gpu")
+	if m.Count != 4 || m.Max != 80 || len(m.Targets) != 2 {
+		t.Fatalf("expect the merged metric of both devices get %+v", m)
+	}
+	for item, exp := range map[string][2]float64{"gpu0": {20, 30}, "gpu1": {70, 80}} {
+		got, err := mgr.GetNodeMetricByTarget(context.Background(), "node1", "gpu", item)
+		if err != nil {
+			t.Fatalf("GetNodeMetricByTarget(%s) get err: %v", item, err)
+		}
+		if got.TargetItem != item || got.Count != 2 || got.Avg != exp[0] || got.Max != exp[1] {
+			t.Fatalf("expect %s avg %v max %v get %+v", item, exp[0], exp[1], got)
+		}
+	}
+	if _, err := mgr.GetNodeMetricByTarget(context.Background(), "node1", "gpu", "gpu2"); !errors.Is(err, ErrNotFoundInCache) {
+		t.Fatalf("expect unknown device not found get %v", err)
+	}
+	// a metric of a single target item has no Targets, but it is still retrievable by the item.
+	if cpu, err := mgr.GetNodeMetricByTarget(context.Background(), "node1", "cpu", "node1"); err != nil || cpu.Targets != nil || cpu.Avg != 5 {
+		t.Fatalf("expect cpu of the single target item get %+v %v", cpu, err)
+	}
+
+	item, busiest, ok := MaxTarget(m, func(m FullMetrics) float64 { return m.Avg })
+	if !ok || item != "gpu1" || busiest.Avg != 70 {
+		t.Fatalf("expect gpu1 the busiest device get %s %+v %v", item, busiest, ok)
+	}
+	item, _, ok = MaxTarget(m, func(m FullMetrics) float64 { return m.Min })
+	if !ok || item != "gpu1" {
+		t.Fatalf("expect gpu1 with the greatest min get %s %v", item, ok)
+	}
+	if _, _, ok := MaxTarget(FullMetrics{}, func(m FullMetrics) float64 { return m.Avg }); ok {
+		t.Fatalf("expect no target item of an empty metric")
+	}
+
+	nodeOBI, _ := mgr.GetNodeOBI(context.Background(), "node1")
+	score, err := EvaluateScore(schedv1alpha1.ScoreSpec{Logic: "function score() { return node.metric.gpu.targets.gpu0.max; }"}, nodeOBI)
+	if err != nil || score != 30 {
+		t.Fatalf("expect score logic reads a device get %d %v", score, err)
+	}
+}
+
+func TestCombineTargetItems(t *testing.T) {
+	mgr := newTestManager(t, WithCounterMetrics("requests"), WithPrimaryAggregations(map[string]string{"requests": "rate"}))
+	obi := newNodeOBI("requests", "node1", map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo{
+		"requests": {
+			// counters of two devices interleave by timestamp, neither is ever reset.
+			{TargetItem: "gpu0", Records: newRecords("100", "160", "220")},
+			{TargetItem: "gpu1", Records: newRecords("10", "40", "70")},
+			// gpu2 stopped reporting, it does not count for Latest.
+			{TargetItem: "gpu2", Records: newRecords("500")},
+		},
+	})
+	mgr.ObservabilityIndicantAdd(obi)
+	m := getNodeMetric(t, mgr, obi, "node1", "requests")
+	if len(m.Targets) != 3 {
+		t.Fatalf("expect the metric of each device get %+v", m.Targets)
+	}
+	gpu0, gpu1, gpu2 := m.Targets["gpu0"], m.Targets["gpu1"], m.Targets["gpu2"]
+	// 120 and 60 increase in 2 minutes.
+	if !floatEqual(gpu0.Rate, 1) || !floatEqual(gpu1.Rate, 0.5) || !floatEqual(m.Rate, 1.5) || !floatEqual(m.Primary, 1.5) {
+		t.Fatalf("expect the total rate 1.5 of all devices get %v of %v and %v", m.Rate, gpu0.Rate, gpu1.Rate)
+	}
+	if m.Latest != 145 {
+		t.Fatalf("expect the average latest 145 of the devices reporting the newest record get %v", m.Latest)
+	}
+	if !floatEqual(m.EWMA, (gpu0.EWMA+gpu1.EWMA+gpu2.EWMA)/3) || !floatEqual(m.Slope, (gpu0.Slope+gpu1.Slope+gpu2.Slope)/3) {
+		t.Fatalf("expect the average ewma and slope of the devices get %+v", m)
+	}
+	if m.Count != 7 || m.Max != 500 {
+		t.Fatalf("expect the other aggregations over all records get %+v", m)
+	}
+}
+
+func TestObservabilityIndicantAddTargetItemChanged(t *testing.T) {
+	mgr := newTestManager(t)
+	metrics := func(gpu0, gpu1 string) map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo {
+		return map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo{"gpu": {
+			{TargetItem: "gpu0", Records: newRecords(gpu0)},
+			{TargetItem: "gpu1", Records: newRecords(gpu1)},
+		}}
+	}
+	mgr.ObservabilityIndicantAdd(newNodeOBI("gpu", "node1", metrics("10", "60")))
+	// the same records swapped between devices, the merged metric is the same but the devices are not.
+	obi := newNodeOBI("gpu", "node1", metrics("60", "10"))
+	mgr.ObservabilityIndicantAdd(obi)
+	if gpu0, err := mgr.GetNodeMetricByTarget(context.Background(), "node1", "gpu", "gpu0"); err != nil || gpu0.Avg != 60 {
+		t.Fatalf("expect gpu0 updated to 60 get %+v %v", gpu0, err)
+	}
+	if m := getNodeMetric(t, mgr, obi, "node1", "gpu"); len(m.Targets) != 2 {
+		t.Fatalf("expect both devices kept get %+v", m.Targets)
+	}
+}
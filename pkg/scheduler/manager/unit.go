@@ -0,0 +1,60 @@
+/*
+Copyright 2022 The Arbiter Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manager
+
+// canonicalUnit is the unit a record value is converted to before aggregation.
+type canonicalUnit struct {
+	unit   string
+	factor float64
+}
+
+const (
+	// MilliCPUUnit is the canonical unit of cpu, the same as the cpu request of node.cpuReq.
+	MilliCPUUnit = "m"
+	// ByteUnit is the canonical unit of memory, the same as the memory request of node.memReq.
+	ByteUnit = "byte"
+)
+
+// knownUnits maps the unit of an OBI metric to its canonical unit.
+// A metric without unit is dimensionless and kept as it is.
+var knownUnits = map[string]canonicalUnit{
+	"":      {unit: "", factor: 1},
+	"%":     {unit: "%", factor: 1},
+	"n":     {unit: MilliCPUUnit, factor: 1e-6},
+	"m":     {unit: MilliCPUUnit, factor: 1},
+	"C":     {unit: MilliCPUUnit, factor: 1000},
+	"c":     {unit: MilliCPUUnit, factor: 1000},
+	"core":  {unit: MilliCPUUnit, factor: 1000},
+	"cores": {unit: MilliCPUUnit, factor: 1000},
+	"B":     {unit: ByteUnit, factor: 1},
+	"byte":  {unit: ByteUnit, factor: 1},
+	"bytes": {unit: ByteUnit, factor: 1},
+	"KB":    {unit: ByteUnit, factor: 1e3},
+	"MB":    {unit: ByteUnit, factor: 1e6},
+	"GB":    {unit: ByteUnit, factor: 1e9},
+	"Ki":    {unit: ByteUnit, factor: 1 << 10},
+	"Mi":    {unit: ByteUnit, factor: 1 << 20},
+	"Gi":    {unit: ByteUnit, factor: 1 << 30},
+	"Ti":    {unit: ByteUnit, factor: 1 << 40},
+}
+
+// normalizeUnit returns the canonical unit of unit and the factor to convert a value to it.
+// ok is false if the unit is unknown.
+func normalizeUnit(unit string) (canonical string, factor float64, ok bool) {
+	c, ok := knownUnits[unit]
+	return c.unit, c.factor, ok
+}
@@ -0,0 +1,61 @@
+/*
+Copyright 2022 The Arbiter Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manager
+
+import (
+	"context"
+	"testing"
+
+	schedv1alpha1 "github.com/kube-arbiter/arbiter/pkg/apis/v1alpha1"
+)
+
+func TestAggregateNormalizeUnit(t *testing.T) {
+	mgr := newTestManager(t)
+	cores := newNodeOBI("cores", "node1", map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo{
+		"cpu": {{Unit: "C", Records: newRecords("0.5", "1.5")}},
+	})
+	millicores := newNodeOBI("millicores", "node1", map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo{
+		"cpu": {{Unit: "m", Records: newRecords("500", "1500")}},
+	})
+	mgr.ObservabilityIndicantAdd(cores)
+	mgr.ObservabilityIndicantAdd(millicores)
+	for _, obi := range []*schedv1alpha1.ObservabilityIndicant{cores, millicores} {
+		m := getNodeMetric(t, mgr, obi, "node1", "cpu")
+		if m.CanonicalUnit != MilliCPUUnit {
+			t.Fatalf("%s: expect canonical unit %s get %s", obi.Name, MilliCPUUnit, m.CanonicalUnit)
+		}
+		if !floatEqual(m.Avg, 1000) || !floatEqual(m.Max, 1500) || !floatEqual(m.Min, 500) {
+			t.Fatalf("%s: expect avg 1000 max 1500 min 500 get %+v", obi.Name, m)
+		}
+	}
+
+	mgr.ObservabilityIndicantAdd(newNodeOBI("unknown", "node2", map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo{
+		"cpu": {{Unit: "furlong", Records: newRecords("1")}},
+		"mem": {{Unit: "Mi", Records: newRecords("1")}},
+	}))
+	data, err := mgr.GetNodeOBI(context.Background(), "node2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	metrics := data["default-unknown"].Metric
+	if _, ok := metrics["cpu"]; ok {
+		t.Fatalf("expect metric with unknown unit skipped")
+	}
+	if m := metrics["mem"]; m.CanonicalUnit != ByteUnit || m.Avg != 1<<20 {
+		t.Fatalf("expect mem 1Mi in bytes get %+v", m)
+	}
+}
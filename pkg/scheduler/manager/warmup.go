@@ -0,0 +1,72 @@
+/*
+Copyright 2022 The Arbiter Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manager
+
+import (
+	"context"
+	"fmt"
+)
+
+// WarmUp blocks until at least minNodes nodes have cached metrics, e.g. at startup before the scheduler
+// advertises readiness, since scoring without any metric is useless. It returns the error of ctx if it is
+// done earlier. It waits on a condition signaled by each OBI add instead of polling the caches.
+func (mgr *manager) WarmUp(ctx context.Context, minNodes int) error {
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-ctx.Done():
+			// wake up the wait below to return.
+			mgr.broadcastPopulation()
+		case <-stop:
+		}
+	}()
+
+	mgr.populationLock.Lock()
+	defer mgr.populationLock.Unlock()
+	for {
+		n := mgr.populatedNodes()
+		if n >= minNodes {
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("warm up with %d of %d nodes: %w", n, minNodes, err)
+		}
+		mgr.populationCond.Wait()
+	}
+}
+
+// populatedNodes returns the number of nodes with any cached OBI.
+// The metric lock is taken inside populationLock, so it must not be held by the caller.
+func (mgr *manager) populatedNodes() int {
+	mgr.RLock()
+	defer mgr.RUnlock()
+	n := 0
+	for _, nodeCache := range mgr.nodeMetric {
+		if nodeCache.ItemCount() != 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// broadcastPopulation wakes up WarmUp to check the caches again, the metric lock must not be held.
+func (mgr *manager) broadcastPopulation() {
+	mgr.populationLock.Lock()
+	defer mgr.populationLock.Unlock()
+	mgr.populationCond.Broadcast()
+}
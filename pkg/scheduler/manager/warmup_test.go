@@ -0,0 +1,66 @@
+/*
+Copyright 2022 The Arbiter Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package manager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	schedv1alpha1 "github.com/kube-arbiter/arbiter/pkg/apis/v1alpha1"
+)
+
+func TestWarmUp(t *testing.T) {
+	mgr := newTestManager(t)
+	if err := mgr.WarmUp(context.Background(), 0); err != nil {
+		t.Fatalf("expect no wait for 0 nodes get %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	warm := make(chan error, 1)
+	go func() {
+		warm <- mgr.WarmUp(ctx, 3)
+	}()
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			time.Sleep(time.Duration(i) * 10 * time.Millisecond)
+			mgr.ObservabilityIndicantAdd(newNodeOBI("cpu", fmt.Sprintf("node%d", i), map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo{
+				"cpu": {{Records: newRecords("1")}},
+			}))
+		}(i)
+	}
+	if err := <-warm; err != nil {
+		t.Fatalf("expect warmed up get %v", err)
+	}
+	if n := mgr.populatedNodes(); n < 3 {
+		t.Fatalf("expect at least 3 nodes once warmed up get %d", n)
+	}
+	wg.Wait()
+
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := mgr.WarmUp(ctx, 10); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expect deadline exceeded with 5 of 10 nodes get %v", err)
+	}
+}
@@ -20,38 +20,94 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net"
+	"net/http"
+	"os"
 	"strings"
+	"sync"
 	"time"
 
-	"github.com/dop251/goja"
-	"github.com/dop251/goja_nodejs/console"
-	"github.com/dop251/goja_nodejs/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/runtime"
-	"k8s.io/apimachinery/pkg/util/json"
+	"k8s.io/apimachinery/pkg/util/wait"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
 	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/component-base/metrics/legacyregistry"
 	"k8s.io/klog/v2"
 	"k8s.io/kubernetes/pkg/scheduler/framework"
 	"k8s.io/kubernetes/pkg/scheduler/framework/plugins/helper"
 
+	"github.com/kube-arbiter/arbiter/pkg/apis/scheme"
 	"github.com/kube-arbiter/arbiter/pkg/generated/clientset/versioned"
 	informers "github.com/kube-arbiter/arbiter/pkg/generated/informers/externalversions"
+	"github.com/kube-arbiter/arbiter/pkg/proto/lib/score"
 	"github.com/kube-arbiter/arbiter/pkg/scheduler/manager"
+	"github.com/kube-arbiter/arbiter/pkg/scheduler/scoreserver"
 )
 
 const (
 	Name       = "Arbiter"
 	LogPrefix  = "[arbiter] "
-	DebugLogic = `console.log("[arbiter]", "pod:", JSON.stringify(pod), "node:", JSON.stringify(node));`
+	DebugLogic = manager.DebugLogic
+
+	// PruneInterval is how often the empty manager caches are removed.
+	PruneInterval = 10 * time.Minute
+
+	// ScoreServerAddressEnv is the env of the tcp address to serve the score gRPC service, it is disabled if empty.
+	ScoreServerAddressEnv = "SCORE_SERVER_ADDRESS"
+	// MetricMaxAge is how old the newest node metric can be before the score server reports not serving.
+	MetricMaxAge = 10 * time.Minute
+	// ScoresAddressEnv is the env of the tcp address to serve the node scores at /scores in the Prometheus
+	// text format, it is disabled if empty.
+	ScoresAddressEnv = "SCORES_ADDRESS"
 )
 
 var (
-	ErrNoScoreFunction = errors.New("no score function found")
+	ErrNoScoreFunction = manager.ErrNoScoreFunction
 )
 
 type Arbiter struct {
 	frameworkHandler framework.Handle
 	manager          manager.Manager
+	// stateLock guards adding clusterState to the CycleState, Score is called for nodes in parallel.
+	stateLock sync.Mutex
+}
+
+// clusterStateKey is the CycleState key of clusterState.
+const clusterStateKey framework.StateKey = Name + "/cluster"
+
+// clusterState holds the cluster metrics of a scheduling cycle, computed on first use by any node.
+type clusterState struct {
+	once    sync.Once
+	metrics manager.ClusterMetrics
+}
+
+// Clone shares the state, it is never modified after computed.
+func (s *clusterState) Clone() framework.StateData {
+	return s
+}
+
+// clusterMetrics returns the cluster metrics of the scheduling cycle of state, they are computed only once
+// for all nodes, rather than once for each node.
+func (ex *Arbiter) clusterMetrics(ctx context.Context, state *framework.CycleState) manager.ClusterMetrics {
+	ex.stateLock.Lock()
+	var s *clusterState
+	if data, err := state.Read(clusterStateKey); err == nil {
+		s, _ = data.(*clusterState)
+	}
+	if s == nil {
+		s = &clusterState{}
+		state.Write(clusterStateKey, s)
+	}
+	ex.stateLock.Unlock()
+	s.once.Do(func() {
+		s.metrics = ex.manager.ClusterMetrics(ctx)
+	})
+	return s.metrics
 }
 
 var _ framework.PostBindPlugin = &Arbiter{}
@@ -78,189 +134,72 @@ func (ex *Arbiter) Score(ctx context.Context, state *framework.CycleState, pod *
 			score, newState = ex.backToDefaultScore(ctx, state, pod, nodeName)
 		}
 	}()
-	scoreResults, totalWeight := ex.manager.GetScore(ctx, pod.GetNamespace())
+	scoreResults, totalWeight, skipped := ex.manager.GetScoreForPod(ctx, pod)
+	for _, v := range skipped {
+		klog.V(2).ErrorS(v.Err, LogPrefix+"skip invalid scoreCR", "pod", klog.KObj(pod), "node", nodeName, "scoreCR", v.NameKey)
+	}
 	if totalWeight <= 0 {
-		klog.V(1).ErrorS(errors.New("all scoreCR totalWeight <= 0"), LogPrefix+"all scoreCR totalWeight <=0", "pod", klog.KObj(pod), "node", nodeName)
+		klog.V(1).ErrorS(errors.New("no scoreCR with positive weight"), LogPrefix+"all scoreCR totalWeight <=0", "pod", klog.KObj(pod), "node", nodeName)
 		return ex.backToDefaultScore(ctx, state, pod, nodeName)
 	}
+	// the pod and node of the logic are the same for all scoreCR, build them once rather than for each.
+	podWithOBI, nodeWithOBI, err := ex.scoringInput(ctx, pod, nodeName)
 	ex.frameworkHandler.Parallelizer().Until(ctx, len(scoreResults), func(piece int) {
+		if err != nil {
+			scoreResults[piece].Result, scoreResults[piece].Err = 0, err
+			return
+		}
 		subCtx, cancel := context.WithTimeout(ctx, time.Minute)
 		defer cancel()
-		logic := scoreResults[piece].Logic
-		nameKey := scoreResults[piece].NameKey
-		scoreResults[piece].Result, scoreResults[piece].Err = ex.scoreOne(subCtx, state, pod, nodeName, logic, nameKey)
+		scoreResults[piece].Result, scoreResults[piece].Err = ex.scoreOne(subCtx, state, pod, nodeName, scoreResults[piece], podWithOBI, nodeWithOBI)
 	})
 	msg := strings.Builder{}
 	for _, v := range scoreResults {
-		score += v.Result * v.Weight
 		_, _ = msg.WriteString(fmt.Sprintf("| scoreCR=%s weight=%d score=%d ", v.NameKey, v.Weight, v.Result))
 		if v.Err != nil {
 			_, _ = msg.WriteString(fmt.Sprintf("err=%s ", v.Err))
 		}
 		_, _ = msg.WriteString("|")
 	}
-	score /= totalWeight
+	score = manager.WeightedScore(scoreResults, totalWeight)
 	klog.V(1).InfoS(LogPrefix+"Score Result", "pod", klog.KObj(pod), "node", nodeName, "score", score, "scoreDetail", msg.String())
-	if score < 0 || score > 100 {
-		return 0, framework.AsStatus(errors.New(msg.String()))
-	}
 	return
 }
 
-func (ex *Arbiter) scoreOne(ctx context.Context, state *framework.CycleState, pod *v1.Pod, nodeName, logic, scoreKey string) (score int64, err error) {
+func (ex *Arbiter) scoreOne(ctx context.Context, state *framework.CycleState, pod *v1.Pod, nodeName string, scoreResult manager.ScoreResult, podWithOBI *manager.PodWithOBI, nodeWithOBI *manager.NodeWithOBI) (score int64, err error) {
 	klog.V(5).InfoS(LogPrefix+"Score One", "pod", klog.KObj(pod), "node", nodeName)
+	logic, scoreKey := scoreResult.Logic, scoreResult.NameKey
 	if strings.TrimSpace(logic) == "" {
 		return 0, errors.New("no logic")
 	}
 	klog.V(5).InfoS(LogPrefix+"ScoreLogic", "pod", klog.KObj(pod), "node", nodeName, "scoreCR", scoreKey, "logicStr", logic)
+	return manager.EvaluateScoreResultInCluster(scoreResult, podWithOBI, nodeWithOBI, ex.clusterMetrics(ctx, state))
+}
 
+// scoringInput builds the pod and node of the score logic of pod on nodeName, the OBI of both are optional.
+// The node is read from the manager by GetNodeWithOBI, with the requested resources of the scheduler snapshot.
+func (ex *Arbiter) scoringInput(ctx context.Context, pod *v1.Pod, nodeName string) (*manager.PodWithOBI, *manager.NodeWithOBI, error) {
 	nodeInfo, err := ex.frameworkHandler.SnapshotSharedLister().NodeInfos().Get(nodeName)
 	if err != nil {
-		return 0, fmt.Errorf("getting node %q from Snapshot: %w", nodeName, err)
+		return nil, nil, fmt.Errorf("getting node %q from Snapshot: %w", nodeName, err)
 	}
 
-	registry := new(require.Registry)
-	vm := goja.New()
-	registry.Enable(vm)
-	console.Enable(vm)
-	vm.SetFieldNameMapper(goja.TagFieldNameMapper("json", true))
-
 	podOBI, err := ex.manager.GetPodOBI(ctx, pod)
 	if err != nil {
-		klog.V(4).InfoS(LogPrefix+"GetPodOBI failed, use default value instead", "pod", klog.KObj(pod), "node", nodeName, "scoreCR", scoreKey)
+		klog.V(4).InfoS(LogPrefix+"GetPodOBI failed, use default value instead", "pod", klog.KObj(pod), "node", nodeName)
 	}
 	node := nodeInfo.Node()
-	nodeOBI, err := ex.manager.GetNodeOBI(ctx, node.Name)
-	if err != nil {
-		klog.V(4).InfoS(LogPrefix+"GetNodeOBI failed, use default value instead", "pod", klog.KObj(pod), "node", nodeName, "scoreCR", scoreKey)
-	}
-	podWithOBI := &manager.PodWithOBI{Pod: *pod, OBI: podOBI}
-
-	/*
-		same with node
-	*/
-	pt, err := json.Marshal(podWithOBI)
-	if err != nil {
-		if klog.V(5).Enabled() {
-			klog.V(5).ErrorS(err, LogPrefix+"pod json.Marshal error", "pod", klog.KObj(&podWithOBI.Pod), "node", nodeName, "scoreCR", scoreKey)
-		} else if klog.V(4).Enabled() {
-			klog.V(4).ErrorS(err, LogPrefix+"pod json.Marshal error", "pod", klog.KObj(&podWithOBI.Pod), "node", nodeName, "scoreCR", scoreKey, "podWithOBI", podWithOBI)
-		}
-		return 0, err
-	}
-	var po map[string]interface{}
-	if err = json.Unmarshal(pt, &po); err != nil {
-		if klog.V(5).Enabled() {
-			klog.V(5).ErrorS(err, LogPrefix+"pod json.Unmarshal error", "pod", klog.KObj(&podWithOBI.Pod), "node", nodeName, "scoreCR", scoreKey)
-		} else if klog.V(4).Enabled() {
-			klog.V(4).ErrorS(err, LogPrefix+"pod json.Unmarshal error", "pod", klog.KObj(&podWithOBI.Pod), "node", nodeName, "scoreCR", scoreKey, "podWithOBI", podWithOBI)
+	if node == nil {
+		// the node is removed from the snapshot, fall back to the node lister of the manager.
+		if node, err = ex.manager.GetNode(nodeName); err != nil {
+			return nil, nil, err
 		}
-		return 0, err
 	}
-
-	err = vm.Set("pod", po)
+	nodeWithOBI, err := ex.manager.GetNodeWithOBI(ctx, node)
 	if err != nil {
-		if klog.V(5).Enabled() {
-			klog.V(5).ErrorS(err, LogPrefix+"js vm set pod get err", "pod", klog.KObj(&podWithOBI.Pod), "node", nodeName, "scoreCR", scoreKey, "logic", logic)
-		} else if klog.V(4).Enabled() {
-			klog.V(4).ErrorS(err, LogPrefix+"js vm set pod get err", "pod", klog.KObj(&podWithOBI.Pod), "node", nodeName, "scoreCR", scoreKey, "logic", logic, "podWithOBI", podWithOBI)
-		}
-		return 0, err
-	}
-	nodeWithOBI := manager.NodeWithOBI{Node: *node, OBI: nodeOBI, CPUReq: nodeInfo.NonZeroRequested.MilliCPU, MemReq: nodeInfo.NonZeroRequested.Memory}
-
-	/*
-		try to resolve 'node.Status.Capacity cant import' issue.
-	*/
-	t, err := json.Marshal(nodeWithOBI)
-	if err != nil {
-		if klog.V(5).Enabled() {
-			klog.V(5).ErrorS(err, LogPrefix+"node json.Marshal error", "pod", klog.KObj(&podWithOBI.Pod), "node", nodeName, "scoreCR", scoreKey)
-		} else if klog.V(4).Enabled() {
-			klog.V(4).ErrorS(err, LogPrefix+"node json.Marshal error", "pod", klog.KObj(&podWithOBI.Pod), "node", nodeName, "scoreCR", scoreKey, "nodeWithOBI", nodeWithOBI)
-		}
-		return 0, err
+		klog.V(4).InfoS(LogPrefix+"GetNodeWithOBI failed, use default value instead", "pod", klog.KObj(pod), "node", nodeName, "err", err)
 	}
-	var no map[string]interface{}
-	if err = json.Unmarshal(t, &no); err != nil {
-		if klog.V(5).Enabled() {
-			klog.V(5).ErrorS(err, LogPrefix+"node json.Unmarshal error", "pod", klog.KObj(&podWithOBI.Pod), "node", nodeName, "scoreCR", scoreKey)
-		} else if klog.V(4).Enabled() {
-			klog.V(4).ErrorS(err, LogPrefix+"node json.Unmarshal error", "pod", klog.KObj(&podWithOBI.Pod), "node", nodeName, "scoreCR", scoreKey, "nodeWithOBI", nodeWithOBI)
-		}
-		return 0, err
-	}
-
-	err = vm.Set("node", no)
-	if err != nil {
-		if klog.V(5).Enabled() {
-			klog.V(5).ErrorS(err, LogPrefix+"js vm set node get err", "pod", klog.KObj(&podWithOBI.Pod), "node", nodeName, "scoreCR", scoreKey)
-		} else if klog.V(4).Enabled() {
-			klog.V(4).ErrorS(err, LogPrefix+"js vm set node get err", "pod", klog.KObj(&podWithOBI.Pod), "node", nodeName, "scoreCR", scoreKey, "logic", logic, "node Unmarshal", no)
-		}
-		return 0, err
-	}
-	klog.Infoln(LogPrefix+"get js val finish", "pod", klog.KObj(pod), "node", nodeName)
-
-	if klog.V(5).Enabled() {
-		if _, err = vm.RunString(DebugLogic); err != nil {
-			klog.ErrorS(err, LogPrefix+"run debug logic error", "pod", klog.KObj(pod), "node", nodeName, "scoreCR", scoreKey, "debugLogic", DebugLogic)
-		}
-		klog.Infoln(LogPrefix+"debug logic finish", "pod", klog.KObj(pod), "node", nodeName, "debugLogic", DebugLogic, "scoreCR", scoreKey)
-	}
-
-	if _, err = vm.RunString(logic); err != nil {
-		if klog.V(4).Enabled() {
-			klog.V(4).ErrorS(err, LogPrefix+"score js logic is not right", "pod", klog.KObj(pod), "node", nodeName, "scoreCR", scoreKey, "logic", logic, "podWithOBI", podWithOBI, "nodeWithOBI", nodeWithOBI)
-		} else {
-			klog.V(1).ErrorS(err, LogPrefix+"score js logic is not right", "pod", klog.KObj(pod), "node", nodeName, "scoreCR", scoreKey, "logic", logic)
-		}
-		return 0, err
-	}
-	klog.V(5).Infoln(LogPrefix+"run js logic finish", "pod", klog.KObj(pod), "node", nodeName, "scoreCR", scoreKey)
-
-	if v := vm.Get("score"); v == nil {
-		if klog.V(4).Enabled() {
-			klog.V(4).ErrorS(ErrNoScoreFunction, LogPrefix+"should write a function score(){...} in score crd, back to default score logic", "pod", klog.KObj(pod), "node", nodeName, "scoreCR", scoreKey)
-		} else {
-			klog.V(1).ErrorS(ErrNoScoreFunction, LogPrefix+"should write a function score(){...} in score crd, back to default score logic", "pod", klog.KObj(pod), "node", nodeName, "scoreCR", scoreKey, "logic", logic)
-		}
-		return 0, err
-	}
-	klog.V(5).Infoln(LogPrefix+"defined there is a score function in js", "pod", klog.KObj(pod), "node", nodeName, "scoreCR", scoreKey)
-
-	var fn func() float64
-	if err = vm.ExportTo(vm.Get("score"), &fn); err != nil {
-		klog.V(4).ErrorS(err, LogPrefix+"Score get error result", "pod", klog.KObj(pod), "node", nodeName, "scoreCR", scoreKey, "logic", logic)
-		return 0, err
-	}
-	klog.V(5).InfoS(LogPrefix+"get score value finish", "pod", klog.KObj(pod), "node", nodeName, "scoreCR", scoreKey)
-
-	defer func() {
-		if r := recover(); r != nil {
-			if err, ok := r.(error); ok {
-				if klog.V(4).Enabled() {
-					klog.V(4).ErrorS(err, LogPrefix+"Score js logic get panic", "pod", klog.KObj(&podWithOBI.Pod), "node", nodeName, "scoreCR", scoreKey, "logic", logic, "podWithOBI", podWithOBI, "nodeWithOBI", nodeWithOBI)
-				} else {
-					klog.V(1).ErrorS(err, LogPrefix+"Score js logic get panic", "pod", klog.KObj(&podWithOBI.Pod), "node", nodeName, "scoreCR", scoreKey)
-				}
-			} else {
-				if klog.V(4).Enabled() {
-					klog.V(4).ErrorS(fmt.Errorf("get panic:%v", r), LogPrefix+"Score js logic get panic", "pod", klog.KObj(&podWithOBI.Pod), "node", nodeName, "scoreCR", scoreKey, "logic", logic, "podWithOBI", podWithOBI, "nodeWithOBI", nodeWithOBI)
-				} else {
-					klog.V(1).ErrorS(fmt.Errorf("get panic:%v", r), LogPrefix+"Score js logic get panic", "pod", klog.KObj(&podWithOBI.Pod), "node", nodeName, "scoreCR", scoreKey)
-				}
-			}
-		}
-	}()
-	score = int64(fn())
-	klog.V(5).InfoS(LogPrefix+"all finish", "pod", klog.KObj(pod), "node", nodeName, "scoreCR", scoreKey, "score", score)
-	if score < 0 || score > 100 {
-		msg := fmt.Sprintf("ScoreCR:%s returns an invalid score %d, it should in the range of [%v, %v]", scoreKey, score, framework.MinNodeScore, framework.MaxNodeScore)
-		klog.ErrorS(errors.New(msg), msg, "pod", klog.KObj(pod), "node", nodeName, "scoreCR", scoreKey, "score", score)
-		return 0, errors.New(msg)
-	}
-	return score, nil
+	return manager.NewPodWithOBI(pod, podOBI), nodeWithOBI, nil
 }
 
 func (ex *Arbiter) ScoreExtensions() framework.ScoreExtensions {
@@ -282,7 +221,22 @@ func New(obj runtime.Object, handle framework.Handle) (framework.Plugin, error)
 	podInformer := handle.SharedInformerFactory().Core().V1().Pods()
 	nodeInformer := handle.SharedInformerFactory().Core().V1().Nodes()
 
-	mgr := manager.NewManager(client, handle.SnapshotSharedLister(), podInformer, nodeInformer)
+	eventBroadcaster := record.NewBroadcaster()
+	eventBroadcaster.StartStructuredLogging(0)
+	eventBroadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: handle.ClientSet().CoreV1().Events("")})
+	recorder := eventBroadcaster.NewRecorder(scheme.Scheme, v1.EventSource{Component: Name})
+
+	mgr := manager.NewManagerFromConfig(manager.ManagerConfig{
+		Client:               client,
+		SnapshotSharedLister: handle.SnapshotSharedLister(),
+		PodInformer:          podInformer,
+		NodeInformer:         nodeInformer,
+		EventRecorder:        recorder,
+	})
+	// expose manager cache on the scheduler /metrics endpoint, only the first profile can register.
+	if err := legacyregistry.CustomRegister(manager.NewManagerCollector(mgr)); err != nil {
+		klog.V(4).ErrorS(err, LogPrefix+"register manager collector failed")
+	}
 	plugin := &Arbiter{
 		frameworkHandler: handle,
 		manager:          mgr,
@@ -297,7 +251,18 @@ func New(obj runtime.Object, handle framework.Handle) (framework.Plugin, error)
 		UpdateFunc: mgr.ObservabilityIndicantUpdate,
 		DeleteFunc: mgr.ObservabilityIndicantDelete,
 	})
+	// the node informer is started by the scheduler.
+	nodeInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		DeleteFunc: mgr.NodeDelete,
+	})
 	informerFactory.Start(ctx.Done())
+	go wait.Until(func() { mgr.PruneEmpty() }, PruneInterval, ctx.Done())
+	if address := os.Getenv(ScoreServerAddressEnv); address != "" {
+		serveScore(ctx, address, mgr)
+	}
+	if address := os.Getenv(ScoresAddressEnv); address != "" {
+		serveScores(ctx, address, mgr)
+	}
 	if !cache.WaitForCacheSync(ctx.Done(), scoreInformer.Informer().HasSynced) {
 		err := fmt.Errorf("WaitForCacheSync failed")
 		klog.ErrorS(err, LogPrefix+"Cannot sync caches")
@@ -307,6 +272,27 @@ func New(obj runtime.Object, handle framework.Handle) (framework.Plugin, error)
 	return plugin, nil
 }
 
+// serveScore serves the score gRPC service of mgr on address in background, along with the gRPC health
+// service as the readiness of metric freshness. Only the first profile can listen on the address.
+func serveScore(ctx context.Context, address string, mgr manager.Manager) {
+	lis, err := net.Listen("tcp", address)
+	if err != nil {
+		klog.V(4).ErrorS(err, LogPrefix+"listen score server failed", "address", address)
+		return
+	}
+	srv := grpc.NewServer()
+	score.RegisterScoreServer(srv, scoreserver.NewServer(mgr))
+	healthSrv := health.NewServer()
+	healthpb.RegisterHealthServer(srv, healthSrv)
+	go scoreserver.UpdateHealth(ctx, mgr, healthSrv, MetricMaxAge, time.Minute)
+	go func() {
+		if err := srv.Serve(lis); err != nil {
+			klog.ErrorS(err, LogPrefix+"score server stopped", "address", address)
+		}
+	}()
+	klog.V(2).InfoS(LogPrefix+"score server started", "address", address)
+}
+
 func (ex *Arbiter) Name() string {
 	return Name
 }
@@ -318,3 +304,20 @@ func (ex *Arbiter) PreFilterExtensions() framework.PreFilterExtensions {
 func (ex *Arbiter) PostBind(ctx context.Context, _ *framework.CycleState, pod *v1.Pod, nodeName string) {
 	klog.V(5).InfoS(LogPrefix+"PostBind", "pod", klog.KObj(pod), "node", nodeName)
 }
+
+// serveScores serves the node scores of mgr over http on address in background until ctx is done.
+func serveScores(ctx context.Context, address string, mgr manager.Manager) {
+	mux := http.NewServeMux()
+	mux.Handle("/scores", manager.ScoresHandler(mgr))
+	srv := &http.Server{Addr: address, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	go func() {
+		<-ctx.Done()
+		_ = srv.Close()
+	}()
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			klog.ErrorS(err, LogPrefix+"scores server stopped", "address", address)
+		}
+	}()
+	klog.V(2).InfoS(LogPrefix+"scores server started", "address", address)
+}
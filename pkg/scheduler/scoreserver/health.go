@@ -0,0 +1,49 @@
+/*
+Copyright 2022 The Arbiter Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scoreserver
+
+import (
+	"context"
+	"time"
+
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/klog/v2"
+
+	"github.com/kube-arbiter/arbiter/pkg/proto/lib/score"
+	"github.com/kube-arbiter/arbiter/pkg/scheduler/manager"
+)
+
+// UpdateHealth sets the status of srv by the metric freshness of mgr every interval until ctx is done,
+// so a gRPC readiness probe fails once no node metric is newer than maxAge, see Manager.IsMetricDataFresh.
+// Both the overall status and the one of the Score service are set.
+func UpdateHealth(ctx context.Context, mgr manager.Manager, srv *health.Server, maxAge, interval time.Duration) {
+	wait.UntilWithContext(ctx, func(context.Context) {
+		setHealth(mgr, srv, maxAge)
+	}, interval)
+}
+
+func setHealth(mgr manager.Manager, srv *health.Server, maxAge time.Duration) {
+	status := healthpb.HealthCheckResponse_SERVING
+	if !mgr.IsMetricDataFresh(maxAge) {
+		klog.V(2).InfoS(LogPrefix+"metric data is stale, report not serving", "maxAge", maxAge)
+		status = healthpb.HealthCheckResponse_NOT_SERVING
+	}
+	srv.SetServingStatus("", status)
+	srv.SetServingStatus(score.Score_ServiceDesc.ServiceName, status)
+}
@@ -0,0 +1,66 @@
+/*
+Copyright 2022 The Arbiter Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scoreserver
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"k8s.io/client-go/informers"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+
+	schedv1alpha1 "github.com/kube-arbiter/arbiter/pkg/apis/v1alpha1"
+	"github.com/kube-arbiter/arbiter/pkg/generated/clientset/versioned/fake"
+	"github.com/kube-arbiter/arbiter/pkg/proto/lib/score"
+	"github.com/kube-arbiter/arbiter/pkg/scheduler/manager"
+)
+
+func TestSetHealth(t *testing.T) {
+	newOBI := func(age time.Duration) *schedv1alpha1.ObservabilityIndicant {
+		obi := newCPUOBI("node1", "1")
+		obi.Status.Metrics["cpu"][0].Records[0].Timestamp = time.Now().Add(-age).UnixMilli()
+		return obi
+	}
+	for _, tc := range []struct {
+		name string
+		age  time.Duration
+		exp  healthpb.HealthCheckResponse_ServingStatus
+	}{
+		{name: "fresh", age: time.Minute, exp: healthpb.HealthCheckResponse_SERVING},
+		{name: "stale", age: time.Hour, exp: healthpb.HealthCheckResponse_NOT_SERVING},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			factory := informers.NewSharedInformerFactory(kubefake.NewSimpleClientset(), 0)
+			mgr := manager.NewManager(fake.NewSimpleClientset(), nil, factory.Core().V1().Pods(), factory.Core().V1().Nodes())
+			mgr.ObservabilityIndicantAdd(newOBI(tc.age))
+			srv := health.NewServer()
+			setHealth(mgr, srv, 10*time.Minute)
+			for _, service := range []string{"", score.Score_ServiceDesc.ServiceName} {
+				resp, err := srv.Check(context.Background(), &healthpb.HealthCheckRequest{Service: service})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if resp.Status != tc.exp {
+					t.Fatalf("expect status %v of service %q get %v", tc.exp, service, resp.Status)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,148 @@
+/*
+Copyright 2022 The Arbiter Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package scoreserver exposes the node scores of the scheduler manager over gRPC,
+// so schedulers outside of the kube-scheduler can reuse the Score of arbiter.
+package scoreserver
+
+import (
+	"context"
+	"sync"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/klog/v2"
+
+	"github.com/kube-arbiter/arbiter/pkg/proto/lib/score"
+	"github.com/kube-arbiter/arbiter/pkg/scheduler/manager"
+)
+
+const LogPrefix = "[arbiter-score-server] "
+
+// Server implements score.ScoreServer with the Score and the node OBI cached by the manager.
+type Server struct {
+	score.UnimplementedScoreServer
+
+	manager manager.Manager
+
+	// lock guards watchers.
+	lock     sync.Mutex
+	watchers map[*watcher]struct{}
+}
+
+// watcher is one WatchNodeScores stream, notified when the metric of any of its nodes is updated.
+type watcher struct {
+	nodes  map[string]struct{}
+	notify chan struct{}
+}
+
+var _ score.ScoreServer = &Server{}
+
+// NewServer returns a Server of mgr, it registers a metric update callback on mgr for WatchNodeScores.
+func NewServer(mgr manager.Manager) *Server {
+	s := &Server{
+		manager:  mgr,
+		watchers: make(map[*watcher]struct{}),
+	}
+	mgr.RegisterOnMetricUpdate(s.onMetricUpdate)
+	return s
+}
+
+// GetNodeScores returns the weighted score of each node in the request the same as the scheduler,
+// except that there is no pod to be scheduled, the logic gets an empty pod of the namespace.
+func (s *Server) GetNodeScores(ctx context.Context, req *score.GetNodeScoresRequest) (*score.GetNodeScoresResponse, error) {
+	if len(req.GetNodeNames()) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "node_names should not be empty")
+	}
+	return s.nodeScores(ctx, req)
+}
+
+// WatchNodeScores sends the scores of the nodes in the request at once, then sends all of them again
+// each time the metric of any of the nodes is updated, until the stream is done.
+// Updates happen during one evaluation are merged into the next one.
+func (s *Server) WatchNodeScores(req *score.GetNodeScoresRequest, stream score.Score_WatchNodeScoresServer) error {
+	if len(req.GetNodeNames()) == 0 {
+		return status.Error(codes.InvalidArgument, "node_names should not be empty")
+	}
+	w := &watcher{nodes: make(map[string]struct{}, len(req.GetNodeNames())), notify: make(chan struct{}, 1)}
+	for _, nodeName := range req.GetNodeNames() {
+		w.nodes[nodeName] = struct{}{}
+	}
+	s.lock.Lock()
+	s.watchers[w] = struct{}{}
+	s.lock.Unlock()
+	defer func() {
+		s.lock.Lock()
+		delete(s.watchers, w)
+		s.lock.Unlock()
+	}()
+
+	ctx := stream.Context()
+	for {
+		resp, err := s.nodeScores(ctx, req)
+		if err != nil {
+			return err
+		}
+		if err = stream.Send(resp); err != nil {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-w.notify:
+		}
+	}
+}
+
+func (s *Server) onMetricUpdate(nodeName, _ string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for w := range s.watchers {
+		if _, ok := w.nodes[nodeName]; !ok {
+			continue
+		}
+		select {
+		case w.notify <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (s *Server) nodeScores(ctx context.Context, req *score.GetNodeScoresRequest) (*score.GetNodeScoresResponse, error) {
+	pod := &v1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: req.GetNamespace()}}
+	results, err := s.manager.PreviewScores(ctx, pod, req.GetNodeNames())
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, status.FromContextError(ctx.Err()).Err()
+		}
+		klog.V(4).ErrorS(err, LogPrefix+"get node scores failed", "namespace", req.GetNamespace())
+		return nil, status.Error(codes.NotFound, err.Error())
+	}
+	resp := &score.GetNodeScoresResponse{Scores: make(map[string]int64, len(results))}
+	for _, res := range results {
+		if res.Err != nil {
+			if resp.Errors == nil {
+				resp.Errors = make(map[string]string)
+			}
+			resp.Errors[res.NodeName] = res.Err.Error()
+			continue
+		}
+		resp.Scores[res.NodeName] = res.Result
+	}
+	return resp, nil
+}
@@ -0,0 +1,152 @@
+/*
+Copyright 2022 The Arbiter Authors.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package scoreserver
+
+import (
+	"context"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	kubefake "k8s.io/client-go/kubernetes/fake"
+
+	schedv1alpha1 "github.com/kube-arbiter/arbiter/pkg/apis/v1alpha1"
+	"github.com/kube-arbiter/arbiter/pkg/generated/clientset/versioned/fake"
+	"github.com/kube-arbiter/arbiter/pkg/proto/lib/score"
+	"github.com/kube-arbiter/arbiter/pkg/scheduler/manager"
+)
+
+func newCPUOBI(nodeName, cpu string) *schedv1alpha1.ObservabilityIndicant {
+	return &schedv1alpha1.ObservabilityIndicant{
+		ObjectMeta: metav1.ObjectMeta{Name: "cpu-" + nodeName, Namespace: "default"},
+		Spec: schedv1alpha1.ObservabilityIndicantSpec{
+			TargetRef: schedv1alpha1.ObservabilityIndicantSpecTargetRef{Group: v1.GroupName, Version: "v1", Kind: "Node", Name: nodeName},
+		},
+		Status: schedv1alpha1.ObservabilityIndicantStatus{Metrics: map[string][]schedv1alpha1.ObservabilityIndicantStatusMetricInfo{
+			"cpu": {{Records: []schedv1alpha1.Record{{Timestamp: 60000, Value: cpu}}}},
+		}},
+	}
+}
+
+// newTestClient serves a Server of a manager with node1 and node2 on bufconn,
+// it also returns the OBI add handler of the manager.
+func newTestClient(t *testing.T) (score.ScoreClient, func(obj interface{})) {
+	t.Helper()
+	factory := informers.NewSharedInformerFactory(kubefake.NewSimpleClientset(), 0)
+	for _, name := range []string{"node1", "node2"} {
+		if err := factory.Core().V1().Nodes().Informer().GetIndexer().Add(&v1.Node{ObjectMeta: metav1.ObjectMeta{Name: name}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mgr := manager.NewManager(fake.NewSimpleClientset(), nil, factory.Core().V1().Pods(), factory.Core().V1().Nodes())
+	mgr.ObservabilityIndicantAdd(newCPUOBI("node1", "80"))
+	mgr.ObservabilityIndicantAdd(newCPUOBI("node2", "20"))
+	mgr.ScoreAdd(&schedv1alpha1.Score{
+		ObjectMeta: metav1.ObjectMeta{Name: "least-cpu", Namespace: "ns1"},
+		Spec:       schedv1alpha1.ScoreSpec{Weight: 1, Logic: "function score() { return 100 - node.metric.cpu.avg; }"},
+	})
+
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer()
+	score.RegisterScoreServer(srv, NewServer(mgr))
+	go func() {
+		_ = srv.Serve(lis)
+	}()
+	t.Cleanup(srv.Stop)
+	conn, err := grpc.Dial("bufnet", grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_ = conn.Close()
+	})
+	return score.NewScoreClient(conn), mgr.ObservabilityIndicantAdd
+}
+
+func TestGetNodeScores(t *testing.T) {
+	client, _ := newTestClient(t)
+	ctx := context.Background()
+	resp, err := client.GetNodeScores(ctx, &score.GetNodeScoresRequest{Namespace: "ns1", NodeNames: []string{"node1", "node2", "unknown"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp := map[string]int64{"node1": 20, "node2": 80}; !reflect.DeepEqual(exp, resp.Scores) {
+		t.Fatalf("expect scores %v get %v", exp, resp.Scores)
+	}
+	if _, ok := resp.Errors["unknown"]; !ok || len(resp.Errors) != 1 {
+		t.Fatalf("expect only error of unknown node, get %v", resp.Errors)
+	}
+
+	for _, tc := range []struct {
+		name string
+		req  *score.GetNodeScoresRequest
+		code codes.Code
+	}{
+		{name: "no node", req: &score.GetNodeScoresRequest{Namespace: "ns1"}, code: codes.InvalidArgument},
+		{name: "no score", req: &score.GetNodeScoresRequest{Namespace: "ns2", NodeNames: []string{"node1"}}, code: codes.NotFound},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := client.GetNodeScores(ctx, tc.req); status.Code(err) != tc.code {
+				t.Fatalf("expect code %v get %v", tc.code, err)
+			}
+		})
+	}
+}
+
+func TestWatchNodeScores(t *testing.T) {
+	client, addOBI := newTestClient(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	stream, err := client.WatchNodeScores(ctx, &score.GetNodeScoresRequest{Namespace: "ns1", NodeNames: []string{"node1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := stream.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Scores["node1"] != 20 {
+		t.Fatalf("expect the initial score 20 of node1 get %v", resp.Scores)
+	}
+
+	// node2 is not watched, only the update of node1 is sent.
+	addOBI(newCPUOBI("node2", "30"))
+	addOBI(newCPUOBI("node1", "60"))
+	for {
+		if resp, err = stream.Recv(); err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := resp.Scores["node2"]; ok {
+			t.Fatalf("expect only node1 in the stream get %v", resp.Scores)
+		}
+		if resp.Scores["node1"] == 40 {
+			break
+		}
+	}
+}